@@ -2,14 +2,37 @@ package impl
 
 import (
 	"encoding/binary"
+	"errors"
 	"github.com/SchnorcherSepp/storage/interfaces"
 	"github.com/coocood/freecache"
 	"github.com/oxtoacart/bpool"
 	"runtime/debug"
 )
 
-// interface check: interf.Cache
+// interface check: interf.Cache, ExpireCache, BatchCache, FileStatsCache
 var _ interf.Cache = (*_Cache)(nil)
+var _ ExpireCache = (*_Cache)(nil)
+var _ BatchCache = (*_Cache)(nil)
+var _ FileStatsCache = (*_Cache)(nil)
+
+// FileStatsCache is an optional interface of interf.Cache for caches without an own index (e.g. NewCache).
+// Their Stats() returns only the counters, Bytes and Files are counted on request with FileStats().
+// Implemented by NewCache and the wrappers NewCompressedCache and NewLayeredCache (@see FullStats).
+type FileStatsCache interface {
+
+	// FileStats returns Stats() with Bytes and Files.
+	// This method iterates over all entries and copies them, so it is slow for big caches.
+	FileStats() interf.CacheStats
+}
+
+// FullStats returns the statistics of the cache with Bytes and Files (@see FileStatsCache).
+// This call can be slow, use cache.Stats() for the counters only.
+func FullStats(cache interf.Cache) interf.CacheStats {
+	if c, ok := cache.(FileStatsCache); ok {
+		return c.FileStats()
+	}
+	return cache.Stats()
+}
 
 // @see interf.Cache
 //
@@ -24,6 +47,8 @@ type _Cache struct {
 
 // NewCache return the default implementation of interf.Cache.
 // cacheSizeMB can't be less than 17 (min. 1024 * SectorSize =~ 17 MB).
+// A large sequential read can flush the whole cache; @see NewLFUCache for a scan-resistant alternative.
+// The cache can be saved on shutdown and reloaded on startup (@see CacheSaver, LoadCache).
 func NewCache(cacheSizeMB int) interf.Cache {
 	// cache min. size
 	min := ((1024 * interf.SectorSize) / (1024 * 1024)) + 1
@@ -48,7 +73,7 @@ func NewCache(cacheSizeMB int) interf.Cache {
 // Get returns the value or 'not found' error.
 // This method doesn't allocate memory when the capacity of buf is greater or equal to value.
 func (c *_Cache) Get(fileId string, sector uint64, buf []byte) ([]byte, error) {
-	key := c.calcCacheKey(fileId, sector)
+	key := calcCacheKey(fileId, sector)
 	return c.cache.GetWithBuf(key, buf)
 }
 
@@ -58,10 +83,21 @@ func (c *_Cache) Get(fileId string, sector uint64, buf []byte) ([]byte, error) {
 // Old data can be deleted if the cache is full.
 // The value expires after interf.CacheExpireSeconds.
 func (c *_Cache) Set(fileId string, sector uint64, data []byte) error {
-	key := c.calcCacheKey(fileId, sector)
+	key := calcCacheKey(fileId, sector)
 	return c.cache.Set(key, data, interf.CacheExpireSeconds)
 }
 
+// @see ExpireCache
+//
+// SetExpire stores the value in the cache. The value expires after expireSeconds.
+func (c *_Cache) SetExpire(fileId string, sector uint64, data []byte, expireSeconds int) error {
+	if expireSeconds <= 0 {
+		return errors.New("invalid expire")
+	}
+	key := calcCacheKey(fileId, sector)
+	return c.cache.Set(key, data, expireSeconds)
+}
+
 // @see interf.Cache
 //
 // Pool returns a byte pool. This means that the small byte buffers can be reused and the allocation is reduced.
@@ -81,11 +117,86 @@ func (c *_Cache) Size() int64 {
 	return c.cacheSize
 }
 
+// @see interf.Cache
+//
+// InvalidateFile removes all sectors of the file from the cache (all scopes or the namespace, @see ScopedFileId).
+// This method iterates over all entries and copies them, so it is slow for big caches (@see InvalidateFiles).
+func (c *_Cache) InvalidateFile(fileId string) int {
+	return c.InvalidateFiles([]string{fileId})
+}
+
+// @see BatchCache
+//
+// InvalidateFiles removes all sectors of the files from the cache with a single iteration over all entries.
+func (c *_Cache) InvalidateFiles(fileIds []string) int {
+	if len(fileIds) == 0 {
+		return 0
+	}
+	ids := fileIdSet(fileIds)
+
+	// collect keys (the iterator locks the segments)
+	var keys [][]byte
+	it := c.cache.NewIterator()
+	for e := it.Next(); e != nil; e = it.Next() {
+		if id, _ := parseCacheKey(e.Key); cacheIdMatch(id, ids) { // all scopes (@see ScopedFileId)
+			keys = append(keys, e.Key)
+		}
+	}
+
+	// delete
+	n := 0
+	for _, k := range keys {
+		if c.cache.Del(k) {
+			n++
+		}
+	}
+	return n
+}
+
+// @see interf.Cache
+//
+// Stats returns the current statistics of this cache (freecache counter).
+// Bytes and Files are empty: freecache has no index to count them (@see FileStats).
+func (c *_Cache) Stats() interf.CacheStats {
+	return interf.CacheStats{
+		Entries:     c.cache.EntryCount(),
+		Hits:        c.cache.HitCount(),
+		Misses:      c.cache.MissCount(),
+		HitRate:     c.cache.HitRate(),
+		Evictions:   c.cache.EvacuateCount(),
+		Expirations: c.cache.ExpiredCount(),
+		Files:       make(map[string]int64),
+	}
+}
+
+// @see FileStatsCache
+//
+// FileStats returns Stats() with Bytes and Files.
+// This method iterates over all entries and copies them, so it is slow for big caches.
+func (c *_Cache) FileStats() interf.CacheStats {
+	stats := c.Stats()
+	it := c.cache.NewIterator()
+	for e := it.Next(); e != nil; e = it.Next() {
+		id, _ := parseCacheKey(e.Key)
+		stats.Bytes += int64(len(e.Value))
+		stats.Files[cacheFileId(id)]++
+	}
+	return stats
+}
+
 //-----  HELPER  -----------------------------------------------------------------------------------------------------//
 
 // calcCacheKey converts fileId and a sector into a byte key for freeCache.
-func (c *_Cache) calcCacheKey(fileId string, sector uint64) []byte {
+func calcCacheKey(fileId string, sector uint64) []byte {
 	var bKey [8]byte
 	binary.LittleEndian.PutUint64(bKey[:], sector)
 	return append(bKey[:], []byte(fileId)...)
 }
+
+// parseCacheKey is the reverse function of calcCacheKey.
+func parseCacheKey(key []byte) (fileId string, sector uint64) {
+	if len(key) < 8 {
+		return "", 0 // invalid key
+	}
+	return string(key[8:]), binary.LittleEndian.Uint64(key[:8])
+}
@@ -75,6 +75,127 @@ func TestNewCache(t *testing.T) {
 	}
 }
 
+func TestCache_Stats(t *testing.T) {
+	c := impl.NewCache(0)
+
+	// empty
+	stats := c.Stats()
+	if stats.Entries != 0 || stats.Bytes != 0 || stats.HitRate != 0 || len(stats.Files) != 0 {
+		t.Fatalf("wrong stats: %+v", stats)
+	}
+
+	// 3 sectors of two files, 1 hit, 3 misses
+	_ = c.Set("a", 0, make([]byte, interf.SectorSize))
+	_ = c.Set("a", 1, make([]byte, 100))
+	_ = c.Set("b", 0, make([]byte, 10))
+	_, _ = c.Get("a", 0, nil)
+	_, _ = c.Get("a", 2, nil)
+	_, _ = c.Get("b", 1, nil)
+	_, _ = c.Get("c", 0, nil)
+
+	stats = c.Stats()
+	if stats.Entries != 3 || stats.Bytes != 0 || stats.Hits != 1 || stats.Misses != 3 || stats.HitRate != 0.25 || len(stats.Files) != 0 {
+		t.Fatalf("wrong stats: %+v", stats)
+	}
+
+	// Bytes and Files on request
+	stats = impl.FullStats(c)
+	if stats.Entries != 3 || stats.Bytes != interf.SectorSize+110 || stats.Hits != 1 || stats.Misses != 3 || stats.HitRate != 0.25 {
+		t.Fatalf("wrong stats: %+v", stats)
+	}
+	if len(stats.Files) != 2 || stats.Files["a"] != 2 || stats.Files["b"] != 1 {
+		t.Fatalf("wrong file stats: %v", stats.Files)
+	}
+
+	// evictions
+	for i := uint64(0); i < 2000; i++ {
+		_ = c.Set("c", i, make([]byte, interf.SectorSize))
+	}
+	if stats = impl.FullStats(c); stats.Evictions == 0 || stats.Bytes > c.Size() {
+		t.Fatalf("wrong stats: %+v", stats)
+	}
+}
+
+func TestCache_InvalidateFile(t *testing.T) {
+	c := impl.NewCache(0)
+	for i := uint64(0); i < 100; i++ {
+		_ = c.Set("a", i, []byte{1})
+		_ = c.Set("ab", i, []byte{1})
+	}
+
+	if n := c.InvalidateFile("a"); n != 100 {
+		t.Fatalf("wrong count: %d", n)
+	}
+	if _, err := c.Get("a", 5, nil); err == nil {
+		t.Fatal("sector not removed")
+	}
+	if stats := impl.FullStats(c); stats.Entries != 100 || stats.Files["ab"] != 100 {
+		t.Fatalf("wrong stats: %+v", stats)
+	}
+	if n := c.InvalidateFile("a"); n != 0 {
+		t.Fatalf("wrong count: %d", n)
+	}
+}
+
+func TestInvalidateFiles(t *testing.T) {
+	disk, err := impl.NewDiskCache(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caches := map[string]interf.Cache{
+		"ram":        impl.NewCache(0),
+		"lfu":        impl.NewLFUCache(0),
+		"disk":       disk,
+		"compressed": impl.NewCompressedCache(impl.NewCache(0)),
+		"layered":    impl.NewLayeredCache(impl.NewCache(0), impl.NewLFUCache(0)),
+	}
+
+	for name, c := range caches {
+		// unscoped and scoped ids (@see ReaderAtOption)
+		for _, id := range []string{"a", "a\x00ns\x00", "b", "c", "ab"} {
+			_ = c.Set(id, 0, []byte{1})
+			_ = c.Set(id, 1, []byte{1})
+		}
+
+		bc, ok := c.(impl.BatchCache)
+		if !ok {
+			t.Fatalf("%s: no BatchCache", name)
+		}
+		if n := bc.InvalidateFiles(nil); n != 0 {
+			t.Fatalf("%s: wrong count: %d", name, n)
+		}
+		want := 6 // a (2 scopes) and b
+		if name == "layered" {
+			want = 12 // both levels
+		}
+		if n := bc.InvalidateFiles([]string{"a", "b", "x"}); n != want {
+			t.Fatalf("%s: wrong count: %d", name, n)
+		}
+		for _, id := range []string{"a", "a\x00ns\x00", "b"} {
+			if _, err := c.Get(id, 1, nil); err == nil {
+				t.Fatalf("%s: sector not removed: %q", name, id)
+			}
+		}
+		for _, id := range []string{"c", "ab"} {
+			if _, err := c.Get(id, 1, nil); err != nil {
+				t.Fatalf("%s: valid sector removed: %q", name, id)
+			}
+		}
+
+		// only a namespace (@see ScopedFileId)
+		_ = c.Set("c\x00ns\x00v1", 0, []byte{1})
+		_ = c.Set("c\x00other\x00", 0, []byte{1})
+		if n := bc.InvalidateFiles([]string{impl.ScopedFileId("c", impl.WithCacheNamespace("ns"))}); n != want/6 { // 1 sector per level
+			t.Fatalf("%s: wrong count: %d", name, n)
+		}
+		for _, id := range []string{"c", "c\x00other\x00"} {
+			if _, err := c.Get(id, 0, nil); err != nil {
+				t.Fatalf("%s: valid sector removed: %q", name, id)
+			}
+		}
+	}
+}
+
 //--------------------------------------------------------------------------------------------------------------------//
 
 func TestRace_Cache(t *testing.T) {
@@ -0,0 +1,120 @@
+package impl
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	interf "github.com/SchnorcherSepp/storage/interfaces"
+	"io"
+	"time"
+)
+
+// CacheSaver is implemented by caches that can write all entries to a stream.
+// The RAM cache (@see NewCache) implements this interface, the dump can be loaded with LoadCache().
+//
+// Example of use:
+//   // shutdown
+//   err := cache.(impl.CacheSaver).SaveTo(fh)
+//   // startup
+//   cache, err := impl.LoadCache(fh, 500)
+type CacheSaver interface {
+
+	// SaveTo writes all entries with their expiry time to w.
+	// This method is thread-safe, but entries set during the dump may be missing.
+	SaveTo(w io.Writer) error
+}
+
+// interface check: CacheSaver
+var _ CacheSaver = (*_Cache)(nil)
+
+// cacheDumpVersion identifies the dump format.
+const cacheDumpVersion = "impl/Cache/1"
+
+// _CacheDump is the header of a dump. The entries follow, the last entry has no key.
+type _CacheDump struct {
+	Version string
+}
+
+// _DumpEntry is a cache entry with exported attributes for serialization.
+type _DumpEntry struct {
+	Key      []byte // @see calcCacheKey
+	Value    []byte
+	ExpireAt int64 // unix time, 0 = never
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+
+// SaveTo writes all entries with their expiry time to w.
+// The format is a gob stream: a header followed by one message per entry and an end mark.
+// This method is thread-safe.
+func (c *_Cache) SaveTo(w io.Writer) error {
+	enc := gob.NewEncoder(w)
+	if err := enc.Encode(_CacheDump{Version: cacheDumpVersion}); err != nil {
+		return err
+	}
+
+	it := c.cache.NewIterator()
+	for e := it.Next(); e != nil; e = it.Next() {
+		ttl, err := c.cache.TTL(e.Key) // doesn't change the hit counter
+		if err != nil {
+			continue // expired or evicted in the meantime
+		}
+		entry := _DumpEntry{Key: e.Key, Value: e.Value}
+		if ttl > 0 {
+			entry.ExpireAt = time.Now().Unix() + int64(ttl)
+		}
+		if err := enc.Encode(entry); err != nil {
+			return err
+		}
+	}
+
+	// end mark: a truncated dump is detected
+	return enc.Encode(_DumpEntry{})
+}
+
+// LoadCache reads a dump (@see CacheSaver) and returns a new RAM cache (@see NewCache) with these entries.
+// The entries keep their original expiry time; expired entries are skipped.
+// If the dump is bigger than cacheSizeMB, some entries are lost.
+func LoadCache(r io.Reader, cacheSizeMB int) (interf.Cache, error) {
+	if r == nil {
+		return nil, errors.New("nil reader")
+	}
+	dec := gob.NewDecoder(r)
+
+	// header
+	dump := new(_CacheDump)
+	if err := dec.Decode(dump); err != nil {
+		return nil, err
+	}
+	if dump.Version != cacheDumpVersion {
+		return nil, fmt.Errorf("unsupported cache dump version '%s'", dump.Version)
+	}
+
+	// entries
+	c := NewCache(cacheSizeMB).(*_Cache)
+	for {
+		var e _DumpEntry
+		if err := dec.Decode(&e); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF // no end mark
+			}
+			return nil, err
+		}
+		if len(e.Key) == 0 {
+			break // end mark
+		}
+
+		expire := 0 // never
+		if e.ExpireAt > 0 {
+			expire = int(e.ExpireAt - time.Now().Unix())
+			if expire <= 0 {
+				continue // expired
+			}
+		}
+		if e.Value == nil {
+			e.Value = make([]byte, 0) // gob doesn't transmit empty slices
+		}
+		_ = c.cache.Set(e.Key, e.Value, expire) // too large entries are skipped
+	}
+	return c, nil
+}
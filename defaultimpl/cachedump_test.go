@@ -0,0 +1,133 @@
+package impl_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	impl "github.com/SchnorcherSepp/storage/defaultimpl"
+	interf "github.com/SchnorcherSepp/storage/interfaces"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCache_SaveTo(t *testing.T) {
+	c := impl.NewCache(0)
+	data := bytes.Repeat([]byte{0xff}, interf.SectorSize)
+	for i := uint64(0); i < 100; i++ {
+		if err := c.Set("fileId", i, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = c.Set("empty", 1, []byte{})
+
+	// dump
+	dump := new(bytes.Buffer)
+	if err := c.(impl.CacheSaver).SaveTo(dump); err != nil {
+		t.Fatal(err)
+	}
+	if stats := c.Stats(); stats.Hits != 0 {
+		t.Fatalf("dump changed the stats: %+v", stats)
+	}
+
+	// load
+	c2, err := impl.LoadCache(bytes.NewReader(dump.Bytes()), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := uint64(0); i < 100; i++ {
+		if b, err := c2.Get("fileId", i, nil); err != nil || !bytes.Equal(b, data) {
+			t.Fatalf("sector %d: %v", i, err)
+		}
+	}
+	if b, err := c2.Get("empty", 1, nil); err != nil || len(b) != 0 {
+		t.Fatalf("empty sector: %v", err)
+	}
+
+	// truncated dump
+	if _, err := impl.LoadCache(bytes.NewReader(dump.Bytes()[:dump.Len()-10]), 0); err == nil {
+		t.Fatal("no error with truncated dump")
+	}
+
+	// invalid dump
+	if _, err := impl.LoadCache(bytes.NewReader([]byte("invalid")), 0); err == nil {
+		t.Fatal("no error with invalid dump")
+	}
+	if _, err := impl.LoadCache(nil, 0); err == nil {
+		t.Fatal("no error with nil reader")
+	}
+}
+
+func TestLoadCache_Expiry(t *testing.T) {
+	// same fields as the dump format
+	type header struct{ Version string }
+	type entry struct {
+		Key      []byte
+		Value    []byte
+		ExpireAt int64
+	}
+	key := func(id string, sector uint64) []byte {
+		var b [8]byte
+		binary.LittleEndian.PutUint64(b[:], sector)
+		return append(b[:], id...)
+	}
+
+	now := time.Now().Unix()
+	dump := new(bytes.Buffer)
+	enc := gob.NewEncoder(dump)
+	_ = enc.Encode(header{Version: "impl/Cache/1"})
+	_ = enc.Encode(entry{Key: key("fileId", 1), Value: []byte{1}, ExpireAt: now - 10}) // expired
+	_ = enc.Encode(entry{Key: key("fileId", 2), Value: []byte{2}, ExpireAt: now + 2})  // expires soon
+	_ = enc.Encode(entry{Key: key("fileId", 3), Value: []byte{3}, ExpireAt: 0})        // never
+	_ = enc.Encode(entry{})
+
+	c, err := impl.LoadCache(dump, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Get("fileId", 1, nil); err == nil {
+		t.Fatal("expired entry loaded")
+	}
+	if b, err := c.Get("fileId", 2, nil); err != nil || b[0] != 2 {
+		t.Fatalf("entry not loaded: %v", err)
+	}
+
+	// the original expiry time is respected
+	time.Sleep(3 * time.Second)
+	if _, err := c.Get("fileId", 2, nil); err == nil {
+		t.Fatal("entry not expired")
+	}
+	if b, err := c.Get("fileId", 3, nil); err != nil || b[0] != 3 {
+		t.Fatalf("entry expired: %v", err)
+	}
+
+	// wrong version
+	dump.Reset()
+	_ = gob.NewEncoder(dump).Encode(header{Version: "impl/Cache/0"})
+	if _, err := impl.LoadCache(dump, 0); err == nil {
+		t.Fatal("no error with wrong version")
+	}
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+
+func TestRace_CacheSaveTo(t *testing.T) {
+	c := impl.NewCache(0)
+
+	var wg sync.WaitGroup
+	wg.Add(5)
+	for n := 0; n < 5; n++ {
+		go func() {
+			//------------------------------
+			for i := 0; i < 50; i++ {
+				_ = c.Set("fileId", uint64(i), []byte{0xff})
+				if err := c.(impl.CacheSaver).SaveTo(new(bytes.Buffer)); err != nil {
+					t.Fail()
+				}
+			}
+			//------------------------------
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,225 @@
+package impl
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	interf "github.com/SchnorcherSepp/storage/interfaces"
+	"github.com/oxtoacart/bpool"
+	"io"
+	"sync"
+)
+
+// interface check: interf.Cache, ExpireCache, BatchCache, FileStatsCache
+var _ interf.Cache = (*_CompressedCache)(nil)
+var _ ExpireCache = (*_CompressedCache)(nil)
+var _ BatchCache = (*_CompressedCache)(nil)
+var _ FileStatsCache = (*_CompressedCache)(nil)
+
+// entry modes of the compressed cache (first byte of a value)
+const (
+	compressRaw   byte = 0 // <mode> <data>
+	compressFlate byte = 1 // <mode> <uvarint size> <flate data>
+)
+
+// compressMinSize is the min. value size for compression. Smaller values are stored raw.
+const compressMinSize = 128
+
+// @see interf.Cache
+//
+// CompressedCache compresses the sectors (flate) before they are stored in the inner cache.
+// Values that don't shrink by at least 1/8 are stored uncompressed.
+type _CompressedCache struct {
+	inner interf.Cache
+
+	writers sync.Pool // *_Compressor
+	readers sync.Pool // *_Decompressor
+	buffers sync.Pool // *[]byte, for the compressed values of Get()
+}
+
+// _Compressor is a reusable flate writer with its output buffer.
+type _Compressor struct {
+	w   *flate.Writer
+	out *bytes.Buffer
+}
+
+// _Decompressor is a reusable flate reader with its input.
+type _Decompressor struct {
+	r   io.ReadCloser
+	src *bytes.Reader
+}
+
+// NewCompressedCache returns a interf.Cache that stores the sectors compressed in the inner cache.
+// The same RAM budget holds more sectors, if the files are compressible. Get() and Set() need more CPU.
+// The inner cache must accept values of SectorSize + 1 byte (@see NewCache, NewLFUCache, NewDiskCache).
+//
+// Example of use:
+//   cache := impl.NewCompressedCache(impl.NewCache(500))
+func NewCompressedCache(inner interf.Cache) interf.Cache {
+	c := &_CompressedCache{inner: inner}
+	c.writers.New = func() interface{} {
+		out := new(bytes.Buffer)
+		w, _ := flate.NewWriter(out, flate.BestSpeed) // err only with invalid level
+		return &_Compressor{w: w, out: out}
+	}
+	c.readers.New = func() interface{} {
+		src := bytes.NewReader(nil)
+		return &_Decompressor{r: flate.NewReader(src), src: src}
+	}
+	c.buffers.New = func() interface{} {
+		b := make([]byte, interf.SectorSize+binary.MaxVarintLen64+1)
+		return &b
+	}
+	return c
+}
+
+// @see interf.Cache
+//
+// Get returns the value or 'not found' error.
+// This method doesn't allocate memory when the capacity of buf is greater or equal to value.
+func (c *_CompressedCache) Get(fileId string, sector uint64, buf []byte) ([]byte, error) {
+	tmp := c.buffers.Get().(*[]byte)
+	defer c.buffers.Put(tmp)
+
+	v, err := c.inner.Get(fileId, sector, *tmp)
+	if err != nil {
+		return nil, err
+	}
+	if len(v) < 1 {
+		return nil, errors.New("corrupt cache entry")
+	}
+
+	switch v[0] {
+	case compressRaw:
+		buf = resize(buf, len(v)-1)
+		copy(buf, v[1:])
+		return buf, nil
+
+	case compressFlate:
+		size, n := binary.Uvarint(v[1:])
+		if n <= 0 || size > interf.SectorSize {
+			return nil, errors.New("corrupt cache entry")
+		}
+		buf = resize(buf, int(size))
+
+		d := c.readers.Get().(*_Decompressor)
+		defer c.readers.Put(d)
+		d.src.Reset(v[1+n:])
+		if err := d.r.(flate.Resetter).Reset(d.src, nil); err != nil {
+			return nil, err
+		}
+		if _, err := io.ReadFull(d.r, buf); err != nil {
+			return nil, errors.New("corrupt cache entry")
+		}
+		return buf, nil
+
+	default:
+		return nil, errors.New("corrupt cache entry")
+	}
+}
+
+// @see interf.Cache
+//
+// Set compresses the value and stores it in the inner cache.
+// Old data can be deleted if the cache is full.
+// The value expires after interf.CacheExpireSeconds.
+func (c *_CompressedCache) Set(fileId string, sector uint64, data []byte) error {
+	return c.set(fileId, sector, data, 0)
+}
+
+// @see ExpireCache
+//
+// SetExpire compresses the value and stores it in the inner cache. The value expires after expireSeconds.
+// The inner cache must implement ExpireCache.
+func (c *_CompressedCache) SetExpire(fileId string, sector uint64, data []byte, expireSeconds int) error {
+	if expireSeconds <= 0 {
+		return errors.New("invalid expire")
+	}
+	return c.set(fileId, sector, data, expireSeconds)
+}
+
+// set compresses the value and stores it in the inner cache (@see cacheSet).
+func (c *_CompressedCache) set(fileId string, sector uint64, data []byte, expire int) error {
+	if len(data) > interf.SectorSize {
+		return errors.New("entry too large")
+	}
+
+	z := c.writers.Get().(*_Compressor)
+	defer c.writers.Put(z)
+	z.out.Reset()
+
+	// compress
+	if len(data) >= compressMinSize {
+		var hdr [binary.MaxVarintLen64 + 1]byte
+		hdr[0] = compressFlate
+		n := binary.PutUvarint(hdr[1:], uint64(len(data)))
+		z.out.Write(hdr[:1+n])
+		z.w.Reset(z.out)
+		_, err := z.w.Write(data)
+		if errC := z.w.Close(); err == nil {
+			err = errC
+		}
+		if err == nil && z.out.Len() <= len(data)-len(data)/8 {
+			return cacheSet(c.inner, fileId, sector, z.out.Bytes(), expire) // the inner cache copies the value
+		}
+	}
+
+	// doesn't pay off: raw
+	z.out.Reset()
+	z.out.WriteByte(compressRaw)
+	z.out.Write(data)
+	return cacheSet(c.inner, fileId, sector, z.out.Bytes(), expire)
+}
+
+// @see interf.Cache
+//
+// Pool returns the byte pool of the inner cache.
+func (c *_CompressedCache) Pool() *bpool.BytePool {
+	return c.inner.Pool()
+}
+
+// @see interf.Cache
+//
+// Size returns the max. capacity of the inner cache in bytes (compressed data).
+func (c *_CompressedCache) Size() int64 {
+	return c.inner.Size()
+}
+
+// @see interf.Cache
+//
+// InvalidateFile removes all sectors of the file from the inner cache.
+func (c *_CompressedCache) InvalidateFile(fileId string) int {
+	return c.inner.InvalidateFile(fileId)
+}
+
+// @see BatchCache
+//
+// InvalidateFiles removes all sectors of the files from the inner cache.
+func (c *_CompressedCache) InvalidateFiles(fileIds []string) int {
+	return invalidateFiles(c.inner, fileIds)
+}
+
+// @see interf.Cache
+//
+// Stats returns the statistics of the inner cache. Bytes is the size of the compressed data.
+func (c *_CompressedCache) Stats() interf.CacheStats {
+	return c.inner.Stats()
+}
+
+// @see FileStatsCache
+//
+// FileStats returns the statistics of the inner cache with Bytes and Files (@see FullStats).
+func (c *_CompressedCache) FileStats() interf.CacheStats {
+	return FullStats(c.inner)
+}
+
+//-----  HELPER  -----------------------------------------------------------------------------------------------------//
+
+// resize returns buf with the length n. A new slice is allocated if the capacity is too small.
+func resize(buf []byte, n int) []byte {
+	if cap(buf) >= n {
+		return buf[:n]
+	}
+	return make([]byte, n)
+}
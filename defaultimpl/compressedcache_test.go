@@ -0,0 +1,121 @@
+package impl_test
+
+import (
+	"bytes"
+	impl "github.com/SchnorcherSepp/storage/defaultimpl"
+	interf "github.com/SchnorcherSepp/storage/interfaces"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+func TestNewCompressedCache(t *testing.T) {
+	inner := impl.NewLFUCache(0)
+	c := impl.NewCompressedCache(inner)
+	if c.Size() != inner.Size() || c.Pool() != inner.Pool() {
+		t.Fatal("wrong size or pool")
+	}
+
+	// not found
+	if _, err := c.Get("fileId", 13, nil); err == nil {
+		t.Fatal("no error with empty cache")
+	}
+
+	// compressible sector
+	comp := bytes.Repeat([]byte("special-file "), interf.SectorSize/13)
+	if err := c.Set("fileId", 1, comp); err != nil {
+		t.Fatal(err)
+	}
+	b, err := c.Get("fileId", 1, c.Pool().Get())
+	if err != nil || !bytes.Equal(b, comp) {
+		t.Fatalf("invalid data: %v", err)
+	}
+	raw, _ := inner.Get("fileId", 1, nil)
+	if len(raw) > len(comp)/10 {
+		t.Fatalf("not compressed: %d", len(raw))
+	}
+
+	// random sector (stored raw)
+	rnd := make([]byte, interf.SectorSize)
+	rand.New(rand.NewSource(1)).Read(rnd)
+	if err := c.Set("fileId", 2, rnd); err != nil {
+		t.Fatal(err)
+	}
+	b2, err := c.Get("fileId", 2, b)
+	if err != nil || !bytes.Equal(b2, rnd) || &b2[0] != &b[0] {
+		t.Fatalf("invalid data: %v", err)
+	}
+	if raw, _ := inner.Get("fileId", 2, nil); len(raw) != len(rnd)+1 {
+		t.Fatalf("compressed: %d", len(raw))
+	}
+
+	// short and empty sector
+	for i, data := range [][]byte{{1, 2, 3}, {}} {
+		_ = c.Set("fileId", uint64(10+i), data)
+		if b, err := c.Get("fileId", uint64(10+i), nil); err != nil || !bytes.Equal(b, data) {
+			t.Fatalf("invalid data: %v", err)
+		}
+	}
+
+	// too large
+	if err := c.Set("fileId", 15, make([]byte, interf.SectorSize+1)); err == nil {
+		t.Fatal("no error with too large data")
+	}
+
+	// corrupt entry
+	_ = inner.Set("fileId", 16, []byte{1, 0xff})
+	if _, err := c.Get("fileId", 16, nil); err == nil {
+		t.Fatal("no error with corrupt entry")
+	}
+
+	// invalidate and stats of the inner cache
+	if n := c.InvalidateFile("fileId"); n != 5 {
+		t.Fatalf("wrong count: %d", n)
+	}
+	if stats := c.Stats(); stats.Entries != 0 || stats.Hits != inner.Stats().Hits {
+		t.Fatalf("wrong stats: %+v", stats)
+	}
+}
+
+func TestCompressedCache_Capacity(t *testing.T) {
+	inner := impl.NewCache(0)
+	c := impl.NewCompressedCache(inner)
+	data := bytes.Repeat([]byte{'B'}, interf.SectorSize)
+
+	// the cache holds much more than 17 MB
+	for i := uint64(0); i < 5000; i++ {
+		if err := c.Set("fileId", i, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := uint64(0); i < 5000; i++ {
+		if b, err := c.Get("fileId", i, nil); err != nil || !bytes.Equal(b, data) {
+			t.Fatalf("sector %d: %v", i, err)
+		}
+	}
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+
+func TestRace_CompressedCache(t *testing.T) {
+	c := impl.NewCompressedCache(impl.NewCache(0))
+	data := bytes.Repeat([]byte{0xff}, interf.SectorSize)
+
+	var wg sync.WaitGroup
+	wg.Add(5)
+	for n := 0; n < 5; n++ {
+		go func() {
+			//------------------------------
+			for i := 0; i < 300; i++ {
+				errS := c.Set("fileId", uint64(i), data)
+				b, errG := c.Get("fileId", uint64(i), nil)
+				if errS != nil || errG != nil || !bytes.Equal(b, data) {
+					t.Fail()
+				}
+			}
+			//------------------------------
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+}
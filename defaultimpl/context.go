@@ -0,0 +1,303 @@
+package impl
+
+import (
+	"context"
+	interf "github.com/SchnorcherSepp/storage/interfaces"
+	"io"
+	"sync"
+)
+
+// ReaderContext calls ReaderContext() of the service (@see interf.ContextReaderService).
+// Other services get a wrapper: the cancellation of ctx closes the connection.
+func ReaderContext(ctx context.Context, s interf.ReaderService, file interf.File, off int64) (io.ReadCloser, error) {
+	if cs, ok := s.(interf.ContextReaderService); ok {
+		return cs.ReaderContext(ctx, file, off)
+	}
+	return openContext(ctx, func() (io.ReadCloser, error) {
+		return s.Reader(file, off)
+	})
+}
+
+// LimitedReaderContext calls LimitedReaderContext() of the service (@see interf.ContextReaderService).
+// Other services get a wrapper: the cancellation of ctx closes the connection.
+func LimitedReaderContext(ctx context.Context, s interf.ReaderService, file interf.File, off int64, n int64) (io.ReadCloser, error) {
+	if cs, ok := s.(interf.ContextReaderService); ok {
+		return cs.LimitedReaderContext(ctx, file, off, n)
+	}
+	return openContext(ctx, func() (io.ReadCloser, error) {
+		return s.LimitedReader(file, off, n)
+	})
+}
+
+// UpdateContext calls UpdateContext() of the service (@see interf.ContextService).
+// For other services, the cancellation of ctx returns ctx.Err(), but the update continues in the background.
+func UpdateContext(ctx context.Context, s interf.Service) error {
+	if cs, ok := s.(interf.ContextService); ok {
+		return cs.UpdateContext(ctx)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Update()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// SaveContext calls SaveContext() of the service (@see interf.ContextService).
+// For other services, the cancellation of ctx aborts the upload with the next Read() of r.
+func SaveContext(ctx context.Context, s interf.Service, name string, r io.Reader, max int64) (interf.File, error) {
+	if cs, ok := s.(interf.ContextService); ok {
+		return cs.SaveContext(ctx, name, r, max)
+	}
+	return s.Save(name, NewContextSource(ctx, r), max)
+}
+
+// ReadAtContext calls ReadAtContext() of the ReaderAt (@see interf.ContextReaderAt).
+// For other ReaderAt, the cancellation of ctx returns ctx.Err(), but the read continues in the background
+// with an own buffer (p is not retained).
+func ReadAtContext(ctx context.Context, rAt interf.ReaderAt, p []byte, off int64) (int, error) {
+	if cr, ok := rAt.(interf.ContextReaderAt); ok {
+		return cr.ReadAtContext(ctx, p, off)
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if ctx.Done() == nil {
+		return rAt.ReadAt(p, off) // never canceled
+	}
+
+	type result struct {
+		n   int
+		err error
+	}
+	buf := make([]byte, len(p))
+	done := make(chan result, 1)
+	go func() {
+		n, err := rAt.ReadAt(buf, off)
+		done <- result{n, err}
+	}()
+	select {
+	case res := <-done:
+		copy(p, buf[:res.n])
+		return res.n, res.err
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+//--------  READER  --------------------------------------------------------------------------------------------------//
+
+// NewContextReader returns a wrapper of the connection: the cancellation of ctx closes the connection.
+// After the cancellation, Read() returns ctx.Err(). Close() stops watching ctx.
+func NewContextReader(ctx context.Context, rc io.ReadCloser) io.ReadCloser {
+	if ctx.Done() == nil {
+		return rc // never canceled
+	}
+
+	r := &_ContextReader{
+		ctx:  ctx,
+		rc:   rc,
+		stop: make(chan struct{}),
+		once: new(sync.Once),
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = rc.Close() // unblock Read()
+		case <-r.stop:
+		}
+	}()
+	return r
+}
+
+// _ContextReader is a connection that is closed with the cancellation of ctx.
+type _ContextReader struct {
+	ctx  context.Context
+	rc   io.ReadCloser
+	stop chan struct{} // closed by Close()
+	once *sync.Once    // protect 'stop'
+}
+
+// Read returns ctx.Err() after the cancellation.
+func (r *_ContextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := r.rc.Read(p)
+	if err != nil && r.ctx.Err() != nil {
+		err = r.ctx.Err() // closed by ctx
+	}
+	return n, err
+}
+
+// Close closes the connection and stops watching ctx.
+func (r *_ContextReader) Close() error {
+	r.once.Do(func() {
+		close(r.stop)
+	})
+	return r.rc.Close()
+}
+
+// NewContextSource returns a wrapper of r for uploads: Read() returns ctx.Err() after the cancellation of ctx.
+func NewContextSource(ctx context.Context, r io.Reader) io.Reader {
+	if ctx.Done() == nil || r == nil {
+		return r // never canceled
+	}
+	return &_ContextSource{ctx: ctx, r: r}
+}
+
+// _ContextSource is a reader that stops with the cancellation of ctx.
+type _ContextSource struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+// Read returns ctx.Err() after the cancellation.
+func (r *_ContextSource) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+//--------  HELPER  --------------------------------------------------------------------------------------------------//
+
+// openContext calls open in the background. The cancellation of ctx returns ctx.Err() immediately,
+// a connection opened later is closed. The connection is wrapped with NewContextReader.
+func openContext(ctx context.Context, open func() (io.ReadCloser, error)) (io.ReadCloser, error) {
+	rc, err := openAsync(ctx, open)
+	if err != nil {
+		return nil, err
+	}
+	return NewContextReader(ctx, rc), nil
+}
+
+// openAsync calls open in the background. The cancellation of ctx returns ctx.Err() immediately,
+// a connection opened later is closed. The connection is NOT bound to ctx.
+func openAsync(ctx context.Context, open func() (io.ReadCloser, error)) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if ctx.Done() == nil {
+		return open() // never canceled
+	}
+
+	type result struct {
+		rc  io.ReadCloser
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		rc, err := open()
+		done <- result{rc, err}
+	}()
+	select {
+	case res := <-done:
+		return res.rc, res.err
+	case <-ctx.Done():
+		go func() {
+			if res := <-done; res.rc != nil {
+				_ = res.rc.Close() // too late
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+// _Watcher handles the cancellation of a context for all sectors of a ReadAtContext() call.
+// A single goroutine is started lazily, the first time the call blocks (wait or read).
+// A call without blocking (e.g. cache hits) or a context without cancellation never starts the goroutine.
+type _Watcher struct {
+	ctx  context.Context
+	wake func() // wakes up a waiting call (e.g. cond.Broadcast)
+
+	mux     *sync.Mutex // protect all below
+	stop    chan struct{}
+	conn    io.Closer // the connection in use, closed on cancellation
+	closed  bool      // conn was closed by the cancellation
+	started bool
+	fired   bool // ctx was canceled
+}
+
+// newWatcher returns a watcher for ctx. The caller must call stop() at the end.
+func newWatcher(ctx context.Context, wake func()) *_Watcher {
+	return &_Watcher{
+		ctx:  ctx,
+		wake: wake,
+		mux:  new(sync.Mutex),
+	}
+}
+
+// start starts the goroutine (only once). The caller must hold the lock.
+func (w *_Watcher) start() {
+	done := w.ctx.Done()
+	if w.started || done == nil {
+		return // running or never canceled
+	}
+	w.started = true
+	w.stop = make(chan struct{})
+
+	go func(stop chan struct{}) {
+		select {
+		case <-done:
+			w.mux.Lock() // LOCK
+			w.fired = true
+			if w.conn != nil {
+				_ = w.conn.Close() // unblock Read()
+				w.closed = true
+			}
+			w.mux.Unlock() // UNLOCK
+			w.wake()
+		case <-stop:
+		}
+	}(w.stop)
+}
+
+// waiting is called before the call blocks without a connection (e.g. cond.Wait).
+func (w *_Watcher) waiting() {
+	w.mux.Lock() // LOCK
+	defer w.mux.Unlock()
+	w.start()
+}
+
+// watch closes the connection with the cancellation of ctx (until unwatch).
+func (w *_Watcher) watch(conn io.Closer) {
+	w.mux.Lock() // LOCK
+	defer w.mux.Unlock()
+
+	w.start()
+	w.conn, w.closed = conn, false
+	if w.fired {
+		_ = conn.Close() // canceled before
+		w.closed = true
+	}
+}
+
+// unwatch stops watching the connection and returns true if the connection was closed.
+func (w *_Watcher) unwatch() bool {
+	w.mux.Lock() // LOCK
+	defer w.mux.Unlock()
+
+	closed := w.closed
+	w.conn, w.closed = nil, false
+	return closed
+}
+
+// stopWatch stops the goroutine.
+func (w *_Watcher) stopWatch() {
+	w.mux.Lock() // LOCK
+	defer w.mux.Unlock()
+
+	if w.started && w.stop != nil {
+		close(w.stop)
+		w.stop = nil
+	}
+}
@@ -0,0 +1,234 @@
+package impl_test
+
+import (
+	"bytes"
+	"context"
+	impl "github.com/SchnorcherSepp/storage/defaultimpl"
+	interf "github.com/SchnorcherSepp/storage/interfaces"
+	"io"
+	"io/ioutil"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReadAtContext(t *testing.T) {
+	f := impl.NewFile("hang", "hang", 0, 10*interf.SectorSize, "")
+	s := newHangService()
+	rAt, _ := impl.NewReaderAt(f, s, nil, impl.DebugOff)
+	defer rAt.Close()
+	cr := rAt.(interf.ContextReaderAt)
+
+	// deadline: the hanging connection is closed
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := cr.ReadAtContext(ctx, make([]byte, 10), 0); err != context.DeadlineExceeded {
+		t.Fatalf("wrong error: %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("read not aborted: %v", d)
+	}
+	if n := s.closed(); n != 1 {
+		t.Fatalf("connection not closed: %d", n)
+	}
+
+	// already canceled: no connection
+	if _, err := cr.ReadAtContext(ctx, make([]byte, 10), 0); err != context.DeadlineExceeded {
+		t.Fatalf("wrong error: %v", err)
+	}
+	if n := s.opened(); n != 1 {
+		t.Fatalf("wrong number of connections: %d", n)
+	}
+
+	// sub reader
+	sub, _ := impl.NewSubReaderAt(f, s, nil, impl.DebugOff, 100, 100)
+	defer sub.Close()
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel2)
+	if _, err := impl.ReadAtContext(ctx2, sub, make([]byte, 10), 0); err != context.Canceled {
+		t.Fatalf("wrong error: %v", err)
+	}
+}
+
+func TestReadAtContext_Reuse(t *testing.T) {
+	data, s := newFaultyTestData(t)
+	f := s.Files().All()[0]
+	rAt, _ := impl.NewReaderAt(f, s, nil, impl.DebugOff)
+	defer rAt.Close()
+
+	// the context doesn't end the connection
+	ctx, cancel := context.WithCancel(context.Background())
+	b := make([]byte, 10)
+	for i := 0; i < 3; i++ {
+		off := int64(i * interf.SectorSize)
+		if n, err := impl.ReadAtContext(ctx, rAt, b, off); n != len(b) || err != nil || !bytes.Equal(b, data[off:off+10]) {
+			t.Fatalf("read error: %v", err)
+		}
+	}
+	cancel()
+	if st := rAt.Stat(); st["RAtAdd"] != 1 {
+		t.Fatalf("wrong stat: %v", st)
+	}
+
+	// the connection is usable after the cancellation
+	if n, err := rAt.ReadAt(b, 3*interf.SectorSize); n != len(b) || err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	if st := rAt.Stat(); st["RAtAdd"] != 1 {
+		t.Fatalf("wrong stat: %v", st)
+	}
+}
+
+func TestReaderContext(t *testing.T) {
+	data, s := newFaultyTestData(t)
+	f := s.Files().All()[0]
+
+	// native
+	ctx, cancel := context.WithCancel(context.Background())
+	r, err := impl.ReaderContext(ctx, s, f, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 10)
+	if _, err := io.ReadFull(r, b); err != nil || !bytes.Equal(b, data[5:15]) {
+		t.Fatalf("read error: %v", err)
+	}
+	cancel()
+	if _, err := r.Read(b); err != context.Canceled {
+		t.Fatalf("wrong error: %v", err)
+	}
+	_ = r.Close()
+	if _, err := impl.LimitedReaderContext(ctx, s, f, 0, 10); err != context.Canceled {
+		t.Fatalf("wrong error: %v", err)
+	}
+
+	// fallback: the cancellation unblocks Read()
+	hs := newHangService()
+	ctx, cancel = context.WithCancel(context.Background())
+	r, err = impl.LimitedReaderContext(ctx, hs, f, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.AfterFunc(20*time.Millisecond, cancel)
+	if _, err := r.Read(b); err != context.Canceled {
+		t.Fatalf("wrong error: %v", err)
+	}
+	if n := hs.closed(); n != 1 {
+		t.Fatalf("connection not closed: %d", n)
+	}
+	_ = r.Close()
+
+	// without cancellation
+	r = impl.NewContextReader(context.Background(), ioutil.NopCloser(bytes.NewReader(data)))
+	if all, err := ioutil.ReadAll(r); err != nil || !bytes.Equal(all, data) {
+		t.Fatalf("read error: %v", err)
+	}
+}
+
+func TestUpdateSaveContext(t *testing.T) {
+	data, ram := newFaultyTestData(t)
+	slow := impl.NewSlowService(ram, impl.SlowConfig{}, impl.DebugOff) // no interf.ContextService
+
+	for _, s := range []interf.Service{ram, slow} {
+		ctx, cancel := context.WithCancel(context.Background())
+		if err := impl.UpdateContext(ctx, s); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := impl.SaveContext(ctx, s, "b.dat", bytes.NewReader(data), 0); err != nil {
+			t.Fatal(err)
+		}
+		cancel()
+
+		// canceled
+		if err := impl.UpdateContext(ctx, s); err != context.Canceled {
+			t.Fatalf("wrong error: %v", err)
+		}
+		if _, err := impl.SaveContext(ctx, s, "c.dat", bytes.NewReader(data), 0); err == nil {
+			t.Fatal("no error after the cancellation")
+		}
+	}
+
+	_ = ram.Update()
+	if n := len(ram.Files().All()); n != 3 {
+		t.Fatalf("wrong number of files: %d", n)
+	}
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+
+func TestRace_ReadAtContext(t *testing.T) {
+	_, s := newFaultyTestData(t)
+	f := s.Files().All()[0]
+	rAt, _ := impl.NewReaderAt(f, s, impl.NewCache(0), impl.DebugOff)
+	defer rAt.Close()
+
+	var wg sync.WaitGroup
+	wg.Add(5)
+	for n := 0; n < 5; n++ {
+		go func(n int) {
+			//------------------------------
+			b := make([]byte, 100)
+			for i := 0; i < 50; i++ {
+				ctx, cancel := context.WithCancel(context.Background())
+				if (i+n)%3 == 0 {
+					cancel()
+				}
+				_, _ = impl.ReadAtContext(ctx, rAt, b, int64(i*1000))
+				cancel()
+			}
+			//------------------------------
+			wg.Done()
+		}(n)
+	}
+	wg.Wait()
+}
+
+//--------  HELPER  --------------------------------------------------------------------------------------------------//
+
+// hangService is a interf.ReaderService with connections that block until Close().
+type hangService struct {
+	open  int32 // atomic
+	close int32 // atomic
+}
+
+func newHangService() *hangService {
+	return new(hangService)
+}
+
+func (s *hangService) Reader(file interf.File, off int64) (io.ReadCloser, error) {
+	return s.LimitedReader(file, off, file.Size()-off)
+}
+
+func (s *hangService) LimitedReader(file interf.File, off int64, n int64) (io.ReadCloser, error) {
+	atomic.AddInt32(&s.open, 1)
+	return &hangReader{s: s, done: make(chan struct{}), once: new(sync.Once)}, nil
+}
+
+func (s *hangService) opened() int32 {
+	return atomic.LoadInt32(&s.open)
+}
+
+func (s *hangService) closed() int32 {
+	return atomic.LoadInt32(&s.close)
+}
+
+type hangReader struct {
+	s    *hangService
+	done chan struct{}
+	once *sync.Once
+}
+
+func (r *hangReader) Read(p []byte) (int, error) {
+	<-r.done
+	return 0, io.ErrClosedPipe
+}
+
+func (r *hangReader) Close() error {
+	r.once.Do(func() {
+		atomic.AddInt32(&r.s.close, 1)
+		close(r.done)
+	})
+	return nil
+}
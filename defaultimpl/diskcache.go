@@ -0,0 +1,363 @@
+package impl
+
+import (
+	"container/list"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	interf "github.com/SchnorcherSepp/storage/interfaces"
+	"github.com/coocood/freecache"
+	"github.com/oxtoacart/bpool"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// interface check: interf.Cache, BatchCache
+var _ interf.Cache = (*_DiskCache)(nil)
+var _ BatchCache = (*_DiskCache)(nil)
+
+// @see interf.Cache
+//
+// DiskCache stores sectors as files in a local directory. The data survives a restart.
+// Every sector is a file named by the hex encoded cache key (@see calcCacheKey).
+// The files are distributed over 256 sub-folders.
+type _DiskCache struct {
+	dir       string
+	pool      *bpool.BytePool
+	cacheSize int64
+
+	mux     *sync.Mutex              // protect 'entries', 'lru', 'used', 'stats' and the rename/remove of sector files
+	entries map[string]*list.Element // file name -> element of lru
+	lru     *list.List               // *_DiskEntry, front = last used
+	used    int64                    // sum of all entry sizes
+	stats   interf.CacheStats        // counters only (@see Stats)
+}
+
+// _DiskEntry is a sector file of the disk cache.
+type _DiskEntry struct {
+	name   string // hex encoded cache key
+	size   int64
+	expire int64 // unix time
+}
+
+// NewDiskCache returns a interf.Cache that stores the sectors in the directory dir.
+// Existing sectors (e.g. of a previous run) are used. The directory is created if necessary.
+// The least recently used sectors are deleted if the cache is full.
+// cacheSizeMB can't be less than 17 (min. 1024 * SectorSize =~ 17 MB).
+func NewDiskCache(dir string, cacheSizeMB int) (interf.Cache, error) {
+	// cache min. size
+	min := ((1024 * interf.SectorSize) / (1024 * 1024)) + 1
+	if cacheSizeMB < min {
+		cacheSizeMB = min
+	}
+
+	c := &_DiskCache{
+		dir:       dir,
+		pool:      bpool.NewBytePool(300, interf.SectorSize), // ~ 5 MB
+		cacheSize: int64(cacheSizeMB) * 1024 * 1024,
+		mux:       new(sync.Mutex),
+		entries:   make(map[string]*list.Element),
+		lru:       list.New(),
+	}
+
+	// load existing sectors
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// @see interf.Cache
+//
+// Get returns the value or 'not found' error.
+// This method doesn't allocate memory for the value when the capacity of buf is greater or equal to value.
+func (c *_DiskCache) Get(fileId string, sector uint64, buf []byte) ([]byte, error) {
+	name := hex.EncodeToString(calcCacheKey(fileId, sector))
+
+	// index
+	c.mux.Lock() // LOCK
+	elem, ok := c.entries[name]
+	if !ok {
+		c.stats.Misses++
+		c.mux.Unlock() // UNLOCK
+		return nil, freecache.ErrNotFound
+	}
+	e := elem.Value.(*_DiskEntry)
+	if e.expire <= time.Now().Unix() {
+		c.remove(elem)
+		c.stats.Misses++
+		c.stats.Expirations++
+		_ = os.Remove(c.path(name))
+		c.mux.Unlock() // UNLOCK
+		return nil, freecache.ErrNotFound
+	}
+	c.lru.MoveToFront(elem)
+	c.stats.Hits++
+	c.mux.Unlock() // UNLOCK
+
+	// open file
+	fh, err := os.Open(c.path(name))
+	if err != nil {
+		c.drop(name, elem) // file was deleted
+		return nil, freecache.ErrNotFound
+	}
+	defer fh.Close()
+
+	// buffer (the file can be replaced by a concurrent Set: the size of the opened file counts, not the index)
+	fi, err := fh.Stat()
+	if err != nil {
+		c.drop(name, elem)
+		return nil, freecache.ErrNotFound
+	}
+	size := fi.Size()
+	if int64(cap(buf)) >= size {
+		buf = buf[:size]
+	} else {
+		buf = make([]byte, size)
+	}
+
+	// read file
+	if _, err := io.ReadFull(fh, buf); err != nil {
+		c.drop(name, elem) // file was changed
+		return nil, freecache.ErrNotFound
+	}
+	return buf, nil
+}
+
+// @see interf.Cache
+//
+// Set stores the value in the cache.
+// Old data can be deleted if the cache is full.
+// The value expires after interf.CacheExpireSeconds.
+func (c *_DiskCache) Set(fileId string, sector uint64, data []byte) error {
+	name := hex.EncodeToString(calcCacheKey(fileId, sector))
+	if int64(len(data)) > c.cacheSize || len(name) > 250 {
+		return errors.New("entry too large")
+	}
+
+	// write temp file and rename (no broken sectors after a crash)
+	shard := filepath.Dir(c.path(name))
+	fh, err := ioutil.TempFile(shard, ".tmp-")
+	if err != nil {
+		return err
+	}
+	_, err = fh.Write(data)
+	if errC := fh.Close(); err != nil || errC != nil {
+		_ = os.Remove(fh.Name())
+		if err == nil {
+			err = errC
+		}
+		return err
+	}
+
+	// rename and index under the lock: a concurrent Set, eviction or invalidation
+	// must never unlink a sector file that is referenced by the index
+	c.mux.Lock() // LOCK
+	defer c.mux.Unlock()
+
+	if err := os.Rename(fh.Name(), c.path(name)); err != nil {
+		_ = os.Remove(fh.Name())
+		return err
+	}
+	if elem, ok := c.entries[name]; ok {
+		c.remove(elem) // replaced
+	}
+	e := &_DiskEntry{name: name, size: int64(len(data)), expire: time.Now().Unix() + interf.CacheExpireSeconds}
+	c.entries[name] = c.lru.PushFront(e)
+	c.used += e.size
+	c.evict()
+	return nil
+}
+
+// @see interf.Cache
+//
+// Pool returns a byte pool. This means that the small byte buffers can be reused and the allocation is reduced.
+// The Pool contain 300 buffer with the size of interf.SectorSize.
+func (c *_DiskCache) Pool() *bpool.BytePool {
+	return c.pool
+}
+
+// @see interf.Cache
+//
+// Size returns the max. capacity of this cache in bytes.
+func (c *_DiskCache) Size() int64 {
+	return c.cacheSize
+}
+
+// @see interf.Cache
+//
+// InvalidateFile removes all sectors of the file from the cache (all scopes or the namespace, @see ScopedFileId).
+func (c *_DiskCache) InvalidateFile(fileId string) int {
+	return c.InvalidateFiles([]string{fileId})
+}
+
+// @see BatchCache
+//
+// InvalidateFiles removes all sectors of the files from the cache (all scopes or the namespace, @see ScopedFileId).
+func (c *_DiskCache) InvalidateFiles(fileIds []string) int {
+	if len(fileIds) == 0 {
+		return 0
+	}
+	ids := make(map[string]bool, len(fileIds)) // hex encoded file ids
+	for _, id := range fileIds {
+		ids[hex.EncodeToString([]byte(id))] = true
+	}
+
+	c.mux.Lock() // LOCK
+	defer c.mux.Unlock()
+
+	removed := 0
+	for name, elem := range c.entries {
+		if diskIdMatch(name, ids) {
+			c.remove(elem)
+			_ = os.Remove(c.path(name))
+			removed++
+		}
+	}
+	return removed
+}
+
+// @see interf.Cache
+//
+// Stats returns the current statistics of this cache.
+// A Get() of a deleted or changed sector file counts as hit and miss.
+func (c *_DiskCache) Stats() interf.CacheStats {
+	c.mux.Lock() // LOCK
+	defer c.mux.Unlock()
+
+	stats := c.stats
+	stats.Entries = int64(len(c.entries))
+	stats.Bytes = c.used
+	if lookups := stats.Hits + stats.Misses; lookups > 0 {
+		stats.HitRate = float64(stats.Hits) / float64(lookups)
+	}
+	stats.Files = make(map[string]int64)
+	for name := range c.entries {
+		key, _ := hex.DecodeString(name)
+		id, _ := parseCacheKey(key)
+		stats.Files[cacheFileId(id)]++
+	}
+	return stats
+}
+
+//-----  HELPER  -----------------------------------------------------------------------------------------------------//
+
+// path returns the file path of a sector file.
+// The first byte of the cache key is the (little endian) sector number and distributes the files evenly.
+func (c *_DiskCache) path(name string) string {
+	return filepath.Join(c.dir, name[:2], name)
+}
+
+// diskIdMatch returns true if the sector file name belongs to a hex encoded file id of the set.
+// Same as cacheIdMatch, but without decoding the name.
+func diskIdMatch(name string, hexIds map[string]bool) bool {
+	id := name[16:] // without sector number
+	parts := 0
+	for i := 0; i+1 < len(id) && parts < 2; i += 2 {
+		if id[i] == '0' && id[i+1] == '0' { // 0x00: end of the file id or the namespace
+			if hexIds[id[:i]] {
+				return true
+			}
+			parts++
+		}
+	}
+	return parts == 0 && hexIds[id] // unscoped
+}
+
+// load creates the sub-folders and reads the existing sector files.
+// Expired sectors and temp files are deleted.
+func (c *_DiskCache) load() error {
+	now := time.Now()
+	var found []*_DiskEntry
+	var modTimes []int64
+
+	for i := 0; i < 256; i++ {
+		shard := filepath.Join(c.dir, fmt.Sprintf("%02x", i))
+		if err := os.MkdirAll(shard, 0700); err != nil {
+			return err
+		}
+		infos, err := ioutil.ReadDir(shard)
+		if err != nil {
+			return err
+		}
+
+		for _, fi := range infos {
+			name := fi.Name()
+			p := filepath.Join(shard, name)
+
+			// temp files of a crash and expired sectors
+			expire := fi.ModTime().Unix() + interf.CacheExpireSeconds
+			if strings.HasPrefix(name, ".tmp-") || expire <= now.Unix() {
+				_ = os.Remove(p)
+				continue
+			}
+
+			// skip foreign files
+			if _, err := hex.DecodeString(name); err != nil || len(name) < 16 || !fi.Mode().IsRegular() {
+				continue
+			}
+
+			found = append(found, &_DiskEntry{name: name, size: fi.Size(), expire: expire})
+			modTimes = append(modTimes, fi.ModTime().UnixNano())
+		}
+	}
+
+	// the newest sector first
+	idx := make([]int, len(found))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.Slice(idx, func(p, q int) bool {
+		return modTimes[idx[p]] > modTimes[idx[q]]
+	})
+
+	c.mux.Lock() // LOCK
+	for _, i := range idx {
+		e := found[i]
+		c.entries[e.name] = c.lru.PushBack(e)
+		c.used += e.size
+	}
+	c.evict()      // the cache can be smaller than before
+	c.mux.Unlock() // UNLOCK
+	return nil
+}
+
+// evict removes the least recently used entries and their files until the cache size is reached.
+// The caller must hold the lock.
+func (c *_DiskCache) evict() {
+	for c.used > c.cacheSize {
+		elem := c.lru.Back()
+		if elem == nil {
+			break
+		}
+		name := elem.Value.(*_DiskEntry).name
+		c.remove(elem)
+		_ = os.Remove(c.path(name))
+		c.stats.Evictions++
+	}
+}
+
+// remove deletes the entry from the index. The caller must hold the lock.
+func (c *_DiskCache) remove(elem *list.Element) {
+	e := elem.Value.(*_DiskEntry)
+	c.lru.Remove(elem)
+	delete(c.entries, e.name)
+	c.used -= e.size
+}
+
+// drop removes the entry from the index if it is still the same element.
+func (c *_DiskCache) drop(name string, elem *list.Element) {
+	c.mux.Lock() // LOCK
+	defer c.mux.Unlock()
+
+	c.stats.Misses++
+	if c.entries[name] == elem {
+		c.remove(elem)
+	}
+}
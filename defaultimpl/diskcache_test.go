@@ -0,0 +1,234 @@
+package impl_test
+
+import (
+	"bytes"
+	impl "github.com/SchnorcherSepp/storage/defaultimpl"
+	interf "github.com/SchnorcherSepp/storage/interfaces"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestNewDiskCache(t *testing.T) {
+	dir := t.TempDir()
+	c, err := impl.NewDiskCache(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Size() != 17*1024*1024 || len(c.Pool().Get()) != interf.SectorSize {
+		t.Fatalf("wrong size: %d", c.Size())
+	}
+
+	// not found
+	if _, err := c.Get("fileId", 13, nil); err == nil {
+		t.Fatal("no error with empty cache")
+	}
+
+	// set and get
+	buf := bytes.Repeat([]byte{0xff}, interf.SectorSize)
+	if err := c.Set("fileId", 13, buf); err != nil {
+		t.Fatal(err)
+	}
+	buf[0] = 0x00 // data changes after Set()
+	b, err := c.Get("fileId", 13, c.Pool().Get())
+	if err != nil || len(b) != interf.SectorSize || b[0] != 0xff {
+		t.Fatalf("invalid data: %v", err)
+	}
+
+	// short sector, no allocation with buffer
+	if err := c.Set("fileId", 14, []byte{1, 2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	b2, err := c.Get("fileId", 14, b)
+	if err != nil || !bytes.Equal(b2, []byte{1, 2, 3}) || &b2[0] != &b[0] {
+		t.Fatalf("invalid data: %v", err)
+	}
+
+	// too large
+	if err := c.Set("fileId", 15, make([]byte, c.Size()+1)); err == nil {
+		t.Fatal("no error with too large data")
+	}
+
+	// invalidate (only the file, not files with the same prefix)
+	_ = c.Set("file", 13, []byte{1})
+	if n := c.InvalidateFile("file"); n != 1 {
+		t.Fatalf("wrong count: %d", n)
+	}
+	if _, err := c.Get("file", 13, nil); err == nil {
+		t.Fatal("sector not removed")
+	}
+
+	// restart: data survive, temp files are deleted
+	tmp := filepath.Join(dir, "00", ".tmp-crash")
+	_ = ioutil.WriteFile(tmp, []byte("x"), 0600)
+	c, err = impl.NewDiskCache(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err := c.Get("fileId", 13, nil); err != nil || len(b) != interf.SectorSize || b[0] != 0xff {
+		t.Fatalf("invalid data after restart: %v", err)
+	}
+	if _, err := os.Stat(tmp); !os.IsNotExist(err) {
+		t.Fatal("temp file not deleted")
+	}
+}
+
+func TestDiskCache_Eviction(t *testing.T) {
+	dir := t.TempDir()
+	c, _ := impl.NewDiskCache(dir, 0) // 17 MB = 1088 sectors
+	buf := make([]byte, interf.SectorSize)
+
+	// fill the cache, but keep sector 0 alive
+	for i := uint64(0); i < 1200; i++ {
+		if err := c.Set("fileId", i, buf); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.Get("fileId", 0, nil); err != nil {
+			t.Fatalf("sector 0 evicted: %v", err)
+		}
+	}
+
+	// the oldest sectors are gone
+	if _, err := c.Get("fileId", 1, nil); err == nil {
+		t.Fatal("sector 1 not evicted")
+	}
+	if _, err := c.Get("fileId", 1199, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// disk usage
+	var size int64
+	_ = filepath.Walk(dir, func(_ string, fi os.FileInfo, _ error) error {
+		if fi.Mode().IsRegular() {
+			size += fi.Size()
+		}
+		return nil
+	})
+	if size > c.Size() {
+		t.Fatalf("cache too big: %d > %d", size, c.Size())
+	}
+
+	// stats
+	stats := c.Stats()
+	if stats.Evictions != 1200-1088 || stats.Entries != 1088 || stats.Bytes != size || stats.Files["fileId"] != 1088 {
+		t.Fatalf("wrong stats: %+v", stats)
+	}
+	if stats.Hits != 1201 || stats.Misses != 1 || stats.HitRate != 1201.0/1202.0 {
+		t.Fatalf("wrong stats: %+v", stats)
+	}
+
+	// restart: the newest sectors survive
+	c, _ = impl.NewDiskCache(dir, 0)
+	if _, err := c.Get("fileId", 1199, nil); err != nil {
+		t.Fatal(err)
+	}
+	if stats := c.Stats(); stats.Entries != 1088 || stats.Hits != 1 || stats.Evictions != 0 {
+		t.Fatalf("wrong stats: %+v", stats)
+	}
+}
+
+func TestLayeredCache(t *testing.T) {
+	l1 := impl.NewCache(0)
+	l2, _ := impl.NewDiskCache(t.TempDir(), 0)
+	c := impl.NewLayeredCache(l1, l2)
+
+	if c.Size() != l1.Size()+l2.Size() || c.Pool() != l1.Pool() {
+		t.Fatal("wrong size or pool")
+	}
+
+	// set writes both levels
+	if err := c.Set("fileId", 1, []byte{1}); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := l2.Get("fileId", 1, nil); err != nil || b[0] != 1 {
+		t.Fatalf("not in L2: %v", err)
+	}
+
+	// L2 hit is promoted
+	_ = l2.Set("fileId", 2, []byte{2})
+	if b, err := c.Get("fileId", 2, nil); err != nil || b[0] != 2 {
+		t.Fatalf("invalid data: %v", err)
+	}
+	if b, err := l1.Get("fileId", 2, nil); err != nil || b[0] != 2 {
+		t.Fatalf("not promoted: %v", err)
+	}
+
+	// miss
+	if _, err := c.Get("fileId", 3, nil); err == nil {
+		t.Fatal("no error")
+	}
+
+	// invalidate both levels
+	_ = c.Set("other", 1, []byte{1})
+	if n := c.InvalidateFile("other"); n != 2 {
+		t.Fatalf("wrong count: %d", n)
+	}
+
+	// stats: sector 1 and 2 in both levels (the RAM level counts Bytes and Files only on request)
+	stats := c.Stats()
+	if stats.Entries != 4 || stats.Bytes != 2 || stats.Hits != 1 || stats.Misses != 1 || stats.Files["fileId"] != 2 {
+		t.Fatalf("wrong stats: %+v", stats)
+	}
+	stats = impl.FullStats(c)
+	if stats.Entries != 4 || stats.Bytes != 4 || stats.Hits != 1 || stats.Misses != 1 || stats.Files["fileId"] != 4 {
+		t.Fatalf("wrong full stats: %+v", stats)
+	}
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+
+func TestRace_DiskCache(t *testing.T) {
+	c, _ := impl.NewDiskCache(t.TempDir(), 0)
+
+	var wg sync.WaitGroup
+	wg.Add(5)
+	for n := 0; n < 5; n++ {
+		go func() {
+			//------------------------------
+			for i := 0; i < 300; i++ {
+				errS := c.Set("fileId", uint64(i), []byte{0xff})
+				b, errG := c.Get("fileId", uint64(i), nil)
+				if errS != nil || errG != nil || len(b) != 1 || b[0] != 0xff {
+					t.Fail()
+				}
+			}
+			//------------------------------
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+}
+
+func TestRace_DiskCache_Replace(t *testing.T) {
+	c, _ := impl.NewDiskCache(t.TempDir(), 0)
+
+	var wg sync.WaitGroup
+	wg.Add(5)
+	for n := 0; n < 5; n++ {
+		go func(n int) {
+			//------------------------------
+			for i := 0; i < 300; i++ {
+				// same keys, different sizes: a value is always n+1 times the byte n
+				if err := c.Set("fileId", uint64(i%10), bytes.Repeat([]byte{byte(n)}, n+1)); err != nil {
+					t.Error(err)
+				}
+				b, err := c.Get("fileId", uint64((i+n)%10), nil)
+				if err == nil && (len(b) == 0 || len(b) != int(b[0])+1 || !bytes.Equal(b, bytes.Repeat(b[:1], len(b)))) {
+					t.Errorf("mixed value: %v", b)
+				}
+			}
+			//------------------------------
+			wg.Done()
+		}(n)
+	}
+	wg.Wait()
+
+	// every indexed sector has its file
+	for i := 0; i < 10; i++ {
+		if _, err := c.Get("fileId", uint64(i), nil); err != nil {
+			t.Errorf("sector %d: %v", i, err)
+		}
+	}
+}
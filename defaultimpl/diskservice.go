@@ -0,0 +1,364 @@
+package impl
+
+import (
+	"context"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	interf "github.com/SchnorcherSepp/storage/interfaces"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// TrashFolder is the sub folder of the root directory in which _DiskService.Trash() moves the files.
+const TrashFolder = ".trash"
+
+// interface check: interf.Service, interf.ContextService
+var _ interf.Service = (*_DiskService)(nil)
+var _ interf.ContextService = (*_DiskService)(nil)
+
+// @see interf.Service
+//
+// Service is the central interface to access the storage.
+// DiskService uses a plain local directory as storage.
+type _DiskService struct {
+	rootDir  string
+	cache    interf.Cache
+	debugLvl uint8
+	files    interf.Files
+	mux      *sync.RWMutex    // protect 'files'
+	saveMux  *sync.Mutex      // serialize the selection of new file names in Save()
+	opts     []ReaderAtOption // for ReaderAt() and MultiReaderAt()
+}
+
+// NewDiskService return the local filesystem implementation of interf.Service.
+// All files in rootDir are the storage files (the file id is the file name).
+// Folders, sub-folders and hidden files (prefix '.') are ignored.
+// cache=nil disable the cache for ReaderAt() and MultiReaderAt()
+// debugLvl (@see impl.DebugHigh and impl.DebugOff)
+// The options are used for ReaderAt() and MultiReaderAt() (@see ReaderAtOption).
+func NewDiskService(rootDir string, cache interf.Cache, debugLvl uint8, opts ...ReaderAtOption) interf.Service {
+	return &_DiskService{
+		rootDir:  rootDir,
+		cache:    cache,
+		debugLvl: debugLvl,
+		files:    NewFiles(nil), // empty list, set by Update()
+		mux:      new(sync.RWMutex),
+		saveMux:  new(sync.Mutex),
+		opts:     opts,
+	}
+}
+
+//-----------  IMPLEMENTATION:  @see interf.Service  -----------------------------------------------------------------//
+
+// Update scans the root directory. The md5 hash is only calculated for new or changed files
+// (size and modTime are compared with the last index).
+func (s *_DiskService) Update() error {
+	return s.UpdateContext(context.Background())
+}
+
+// UpdateContext behaves like Update, but the cancellation of ctx aborts the scan (between two files).
+func (s *_DiskService) UpdateContext(ctx context.Context) error {
+	// read dir
+	infos, err := ioutil.ReadDir(s.rootDir)
+	if err != nil {
+		return err
+	}
+
+	// the old index is used to avoid the md5 calculation of unchanged files
+	old := s.Files()
+
+	// build new index
+	byId := make(map[string]interf.File)
+	for _, fi := range infos {
+		// canceled?
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		// skip folders and hidden files (like the trash and temp files)
+		if !fi.Mode().IsRegular() || strings.HasPrefix(fi.Name(), ".") {
+			continue
+		}
+
+		id := fi.Name()
+		modTime := fi.ModTime().Unix()
+
+		// reuse hash of unchanged files
+		if of, err := old.ById(id); err == nil && of.Size() == fi.Size() && of.ModTime() == modTime {
+			byId[id] = of
+			continue
+		}
+
+		// calc md5
+		h, err := fileMd5(filepath.Join(s.rootDir, id))
+		if err != nil {
+			return err
+		}
+		byId[id] = NewFile(id, id, modTime, fi.Size(), h)
+	}
+
+	// set new index
+	s.mux.Lock() // WRITE Lock
+	old = s.files
+	s.files = NewFiles(byId)
+	s.mux.Unlock()
+
+	InvalidateChanged(s.cache, old, s.Files(), s.opts...) // remove stale sectors
+	return nil
+}
+
+func (s *_DiskService) Files() interf.Files {
+	s.mux.RLock() // READ Lock
+	defer s.mux.RUnlock()
+
+	return s.files
+}
+
+// Save writes the data to a hidden temp file and renames it atomically.
+// A directory can't contain the same name twice, so an existing name is
+// extended with a counter (e.g. 'test (2).dat'). The name of the returned file is the final name.
+func (s *_DiskService) Save(name string, r io.Reader, max int64) (file interf.File, err error) {
+	// check input
+	name = strings.TrimSpace(name)
+	if len(name) == 0 {
+		return nil, errors.New("empty name")
+	}
+	if r == nil {
+		return nil, errors.New("nil reader")
+	}
+	if name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return nil, fmt.Errorf("invalid name '%s'", name)
+	}
+
+	// limit reader
+	if max > 0 {
+		r = io.LimitReader(r, max)
+	}
+
+	// write temp file (hidden, ignored by Update)
+	tmp, err := ioutil.TempFile(s.rootDir, ".tmp-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name()) // has no effect after a successful rename
+
+	hash := md5.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), r)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if errC := tmp.Close(); err == nil {
+		err = errC
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// find a free name and rename
+	s.saveMux.Lock() // LOCK
+	defer s.saveMux.Unlock()
+
+	id := freeName(s.rootDir, name)
+	path := filepath.Join(s.rootDir, id)
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return nil, err
+	}
+
+	// same modTime as Update() (the file system can round the time)
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewFile(id, id, fi.ModTime().Unix(), size, fmt.Sprintf("%x", hash.Sum(nil))), nil
+}
+
+// Trash moves the file into the TrashFolder of the root directory.
+func (s *_DiskService) Trash(file interf.File) error {
+	path, err := s.path(file)
+	if err != nil {
+		return err
+	}
+
+	// create trash
+	trash := filepath.Join(s.rootDir, TrashFolder)
+	if err := os.MkdirAll(trash, 0700); err != nil {
+		return err
+	}
+
+	// move
+	s.saveMux.Lock() // LOCK
+	defer s.saveMux.Unlock()
+
+	if err := os.Rename(path, filepath.Join(trash, freeName(trash, file.Id()))); err != nil {
+		return err
+	}
+
+	// remove stale sectors
+	if s.cache != nil {
+		s.cache.InvalidateFile(ScopedFileId(file.Id(), s.opts...))
+	}
+	return nil
+}
+
+func (s *_DiskService) Reader(file interf.File, off int64) (io.ReadCloser, error) {
+	path, err := s.path(file)
+	if err != nil {
+		return nil, err
+	}
+
+	// open file
+	fh, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// check offset
+	fi, err := fh.Stat()
+	if err != nil {
+		_ = fh.Close()
+		return nil, err
+	}
+	if off >= fi.Size() {
+		_ = fh.Close()
+		return nil, io.EOF
+	}
+
+	// seek
+	if _, err := fh.Seek(off, io.SeekStart); err != nil {
+		_ = fh.Close()
+		return nil, err
+	}
+
+	// return
+	return fh, nil
+}
+
+func (s *_DiskService) LimitedReader(file interf.File, off int64, n int64) (io.ReadCloser, error) {
+	if n < 1 {
+		// n = 0 -> no data requested -> return nothing
+		return ioutil.NopCloser(strings.NewReader("")), nil
+	}
+
+	r, err := s.Reader(file, off)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewLimitedReadCloser(r, n), nil
+}
+
+func (s *_DiskService) ReaderAt(file interf.File) (interf.ReaderAt, error) {
+	return NewReaderAt(file, s, s.cache, s.debugLvl, s.opts...)
+}
+
+func (s *_DiskService) MultiReaderAt(list []interf.File) (interf.ReaderAt, error) {
+	if len(list) == 1 {
+		// use the normal ReaderAt for single files
+		return s.ReaderAt(list[0])
+	} else {
+		// MultiReaderAt
+		return NewMultiReaderAt(list, s, s.cache, s.debugLvl, s.opts...)
+	}
+}
+
+func (s *_DiskService) Cache() interf.Cache {
+	return s.cache
+}
+
+//-----------  IMPLEMENTATION:  @see interf.ContextService  ----------------------------------------------------------//
+
+// SaveContext behaves like Save, but the cancellation of ctx aborts the copy of r (the temp file is removed).
+func (s *_DiskService) SaveContext(ctx context.Context, name string, r io.Reader, max int64) (interf.File, error) {
+	return s.Save(name, NewContextSource(ctx, r), max)
+}
+
+// ReaderContext behaves like Reader, but the cancellation of ctx closes the file.
+func (s *_DiskService) ReaderContext(ctx context.Context, file interf.File, off int64) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r, err := s.Reader(file, off)
+	if err != nil {
+		return nil, err
+	}
+	return NewContextReader(ctx, r), nil
+}
+
+// LimitedReaderContext behaves like LimitedReader, but the cancellation of ctx closes the file.
+func (s *_DiskService) LimitedReaderContext(ctx context.Context, file interf.File, off int64, n int64) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r, err := s.LimitedReader(file, off, n)
+	if err != nil {
+		return nil, err
+	}
+	return NewContextReader(ctx, r), nil
+}
+
+//--------  Helper  --------------------------------------------------------------------------------------------------//
+
+// path returns the full path of the file.
+// The file id must be a plain file name (no path elements, no hidden file).
+func (s *_DiskService) path(file interf.File) (string, error) {
+	if file == nil {
+		return "", errors.New("nil file")
+	}
+	id := file.Id()
+	if id == "" || id != filepath.Base(id) || strings.HasPrefix(id, ".") {
+		return "", fmt.Errorf("invalid file id '%s'", id)
+	}
+	return filepath.Join(s.rootDir, id), nil
+}
+
+// freeName returns the name or (if the name already exists in dir) the name with a counter.
+// Example: 'test.dat' -> 'test (2).dat'
+func freeName(dir, name string) string {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+
+	newName := name
+	for i := 2; ; i++ {
+		if _, err := os.Lstat(filepath.Join(dir, newName)); os.IsNotExist(err) {
+			return newName
+		}
+		newName = fmt.Sprintf("%s (%d)%s", base, i, ext)
+	}
+}
+
+// fileMd5 calculates the md5 hash of a local file (hex string).
+func fileMd5(path string) (string, error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer fh.Close()
+
+	hash := md5.New()
+	if _, err := io.Copy(hash, fh); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+// ------------------------------------------------------------------------------------------------------------------ //
+
+// NewLimitedReadCloser returns a connection that stops with EOF after n bytes (@see io.LimitReader).
+// Close() closes the underlying connection rc. Used by all services for LimitedReader().
+func NewLimitedReadCloser(rc io.ReadCloser, n int64) io.ReadCloser {
+	return &_LimitedReadCloser{
+		Reader: io.LimitReader(rc, n),
+		Closer: rc,
+	}
+}
+
+// _LimitedReadCloser combines a limited reader with the Closer of the underlying connection.
+type _LimitedReadCloser struct {
+	io.Reader
+	io.Closer
+}
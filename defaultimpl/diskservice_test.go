@@ -0,0 +1,246 @@
+package impl_test
+
+import (
+	"bytes"
+	impl "github.com/SchnorcherSepp/storage/defaultimpl"
+	interf "github.com/SchnorcherSepp/storage/interfaces"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestDiskService_Save_Read_Trash(t *testing.T) {
+	dir := t.TempDir()
+	s := impl.NewDiskService(dir, impl.NewCache(1), impl.DebugOff)
+
+	// empty dir
+	if err := s.Update(); err != nil || len(s.Files().All()) != 0 {
+		t.Fatalf("update fail: %v", err)
+	}
+
+	// invalid input
+	if _, err := s.Save("", bytes.NewReader(nil), 0); err == nil {
+		t.Fatal("no error with empty name")
+	}
+	if _, err := s.Save("test.dat", nil, 0); err == nil {
+		t.Fatal("no error with nil reader")
+	}
+	if _, err := s.Save("../test.dat", bytes.NewReader(nil), 0); err == nil {
+		t.Fatal("no error with path in name")
+	}
+
+	// save
+	f1, err := s.Save("test.dat", bytes.NewReader([]byte("Test Bytes Foo Bar")), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f1.Id() != "test.dat" || f1.Size() != 18 || f1.Md5() != "bda184187bab92431f5f86e489b659f8" {
+		t.Fatalf("wrong file: %s, %d, %s", f1.Id(), f1.Size(), f1.Md5())
+	}
+
+	// save with same name and limit
+	f2, err := s.Save("test.dat", bytes.NewReader([]byte("Test Bytes Foo Bar")), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f2.Id() != "test (2).dat" || f2.Size() != 4 {
+		t.Fatalf("wrong file: %s, %d", f2.Id(), f2.Size())
+	}
+
+	// no temp files left
+	infos, _ := ioutil.ReadDir(dir)
+	if len(infos) != 2 {
+		t.Fatalf("wrong dir content: %d", len(infos))
+	}
+
+	// update
+	if err := s.Update(); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Files().All()) != 2 {
+		t.Fatalf("wrong file count: %d", len(s.Files().All()))
+	}
+	f, err := s.Files().ById(f1.Id())
+	if err != nil || f.Md5() != f1.Md5() || f.Size() != f1.Size() || f.ModTime() != f1.ModTime() {
+		t.Fatalf("wrong index: %v", err)
+	}
+
+	// LimitedReader with offset 1 and n=16
+	r, err := s.LimitedReader(f1, 1, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(r)
+	_ = r.Close()
+	if err != nil || string(b) != "est Bytes Foo Ba" {
+		t.Fatalf("read error: %s, %v", b, err)
+	}
+
+	// LimitedReader with n=0
+	r, err = s.LimitedReader(f1, 11, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ = ioutil.ReadAll(r)
+	_ = r.Close()
+	if len(b) != 0 {
+		t.Fatalf("read error: %s", b)
+	}
+
+	// Reader
+	r, err = s.Reader(f2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ = ioutil.ReadAll(r)
+	_ = r.Close()
+	if string(b) != "Test" {
+		t.Fatalf("read error: %s", b)
+	}
+
+	// Reader over EOF
+	if _, err := s.Reader(f2, 4); err != io.EOF {
+		t.Fatalf("wrong error: %v", err)
+	}
+
+	// ReaderAt
+	rAt, err := s.ReaderAt(f1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 3)
+	if n, err := rAt.ReadAt(buf, 11); n != 3 || err != nil || string(buf) != "Foo" {
+		t.Fatalf("ReadAt error: n=%d, err=%v, b=%s", n, err, buf)
+	}
+	_ = rAt.Close()
+
+	// Trash
+	if err := s.Trash(f1); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Update(); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Files().All()) != 1 {
+		t.Fatalf("wrong file count: %d", len(s.Files().All()))
+	}
+	if _, err := os.Stat(filepath.Join(dir, impl.TrashFolder, f1.Id())); err != nil {
+		t.Fatalf("file not in trash: %v", err)
+	}
+
+	// Trash invalid id
+	if err := s.Trash(impl.NewFile("../x", "x", 0, 0, "")); err == nil {
+		t.Fatal("no error with invalid id")
+	}
+	if _, err := s.Reader(impl.NewFile(impl.TrashFolder, "x", 0, 0, ""), 0); err == nil {
+		t.Fatal("no error with hidden id")
+	}
+}
+
+func TestDiskService_MultiReaderAt(t *testing.T) {
+	dir := t.TempDir()
+	s := impl.NewDiskService(dir, nil, impl.DebugOff)
+
+	f1, _ := s.Save("a.dat", bytes.NewReader(bytes.Repeat([]byte{'a'}, 20000)), 0)
+	f2, _ := s.Save("b.dat", bytes.NewReader(bytes.Repeat([]byte{'b'}, 5)), 0)
+
+	r, err := s.MultiReaderAt(s.Files().All()) // empty index -> no files
+	if err == nil {
+		t.Fatal("no error with empty list")
+	}
+
+	r, err = s.MultiReaderAt([]interf.File{f1, f2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	buf := make([]byte, 4)
+	if n, err := r.ReadAt(buf, 19998); n != 4 || err != nil || string(buf) != "aabb" {
+		t.Fatalf("ReadAt error: n=%d, err=%v, b=%s", n, err, buf)
+	}
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+
+func TestDiskService_InvalidateCache(t *testing.T) {
+	dir := t.TempDir()
+	cache := impl.NewCache(1)
+	s := impl.NewDiskService(dir, cache, impl.DebugOff)
+
+	f1, _ := s.Save("a.dat", bytes.NewReader([]byte("aaaa")), 0)
+	f2, _ := s.Save("b.dat", bytes.NewReader([]byte("bbbb")), 0)
+	if err := s.Update(); err != nil {
+		t.Fatal(err)
+	}
+
+	// fill the cache
+	for _, f := range []interf.File{f1, f2} {
+		rAt, _ := s.ReaderAt(f)
+		_, _ = rAt.ReadAt(make([]byte, 4), 0)
+		_ = rAt.Close()
+	}
+	if cache.Stats().Entries != 2 {
+		t.Fatalf("wrong cache entries: %d", cache.Stats().Entries)
+	}
+
+	// change a.dat -> Update() removes the sectors
+	if err := ioutil.WriteFile(filepath.Join(dir, "a.dat"), []byte("changed"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Update(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cache.Get(f1.Id(), 0, nil); err == nil {
+		t.Fatal("stale sector after update")
+	}
+	if _, err := cache.Get(f2.Id(), 0, nil); err != nil {
+		t.Fatal("valid sector removed")
+	}
+
+	// trash removes the sectors
+	if err := s.Trash(f2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cache.Get(f2.Id(), 0, nil); err == nil {
+		t.Fatal("stale sector after trash")
+	}
+}
+
+func TestRace_DiskService(t *testing.T) {
+	dir := t.TempDir()
+	s := impl.NewDiskService(dir, nil, impl.DebugOff)
+
+	var wg sync.WaitGroup
+	wg.Add(5)
+	for n := 0; n < 5; n++ {
+		go func() {
+			//------------------------------
+			for i := 0; i < 20; i++ {
+				f, errS := s.Save("race.dat", bytes.NewReader([]byte("race")), 0)
+				errU := s.Update()
+				if errS != nil || errU != nil {
+					t.Fail()
+					continue
+				}
+				r, errR := s.Reader(f, 0)
+				if errR != nil {
+					t.Fail()
+					continue
+				}
+				_ = r.Close()
+			}
+			//------------------------------
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+
+	// all files must exist
+	if err := s.Update(); err != nil || len(s.Files().All()) != 100 {
+		t.Fatalf("wrong file count: %d, %v", len(s.Files().All()), err)
+	}
+}
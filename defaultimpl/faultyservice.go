@@ -0,0 +1,265 @@
+package impl
+
+import (
+	"errors"
+	interf "github.com/SchnorcherSepp/storage/interfaces"
+	"io"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+)
+
+// interface check: interf.Service
+var _ interf.Service = (*_FaultyService)(nil)
+
+// ErrInjected is the default error of all injected faults (@see Fault.Err).
+var ErrInjected = errors.New("injected fault")
+
+// Fault decides which calls of a method fail.
+// A call fails if its number is in Schedule OR with the chance of Probability.
+// The zero value never fails.
+type Fault struct {
+	Probability float64  // chance [0.0, 1.0] for every call
+	Schedule    []uint64 // deterministic: the numbers (first call is 1) of the failing calls
+	Err         error    // returned error; nil = ErrInjected
+}
+
+// FaultPlan configures all faults of NewFaultyService().
+//
+// The stream faults (ShortRead, Cut and Corrupt) are decided once per opened stream,
+// the call number is the number of the Reader() or LimitedReader() call.
+//
+// Example: the first connection dies after 20000 bytes, 10% of all Save() calls fail
+//   plan := FaultPlan{
+//       Cut:      Fault{Schedule: []uint64{1}},
+//       CutAfter: 20000,
+//       Save:     Fault{Probability: 0.1},
+//   }
+type FaultPlan struct {
+	Seed int64 // seed for all probabilities (reproducible tests)
+
+	Update Fault // Update() returns an error, the file index is not updated
+	Save   Fault // Save() returns an error, nothing is saved
+	Trash  Fault // Trash() returns an error, nothing is moved
+	Open   Fault // Reader() and LimitedReader() return an error
+
+	ShortRead    Fault // every Read() of the stream returns at most ShortReadMax bytes
+	ShortReadMax int   // default: 1 byte
+
+	Cut      Fault // the stream returns an error after CutAfter bytes
+	CutAfter int64 // default: 0 (the first Read() fails)
+
+	Corrupt Fault // the first byte of every Read() of the stream is inverted
+}
+
+// _FaultyService is a interf.Service decorator that injects faults.
+// Must be created with NewFaultyService().
+type _FaultyService struct {
+	inner interf.Service
+	plan  FaultPlan
+
+	mux *sync.Mutex // protect 'rnd'
+	rnd *rand.Rand
+
+	calls [7]uint64 // call counter for every fault (atomic)
+
+	debugLvl uint8            // for ReaderAt() and MultiReaderAt()
+	opts     []ReaderAtOption // for ReaderAt() and MultiReaderAt()
+}
+
+// indexes of _FaultyService.calls
+const (
+	faultUpdate = iota
+	faultSave
+	faultTrash
+	faultOpen
+	faultShortRead
+	faultCut
+	faultCorrupt
+)
+
+// NewFaultyService wraps a service and injects the faults of the plan.
+// This implementation is for resilience tests of ReaderAt, MultiReaderAt and all other service users.
+// ReaderAt() and MultiReaderAt() use the faulty Reader() of this wrapper and the cache of the inner service.
+// The debug level and the options are used for ReaderAt() and MultiReaderAt() (@see ReaderAtOption).
+func NewFaultyService(inner interf.Service, plan FaultPlan, debugLvl uint8, opts ...ReaderAtOption) interf.Service {
+	return &_FaultyService{
+		inner:    inner,
+		plan:     plan,
+		mux:      new(sync.Mutex),
+		rnd:      rand.New(rand.NewSource(plan.Seed)),
+		debugLvl: debugLvl,
+		opts:     opts,
+	}
+}
+
+//-----------  IMPLEMENTATION:  @see interf.Service  -----------------------------------------------------------------//
+
+func (s *_FaultyService) Update() error {
+	if err := s.fail(faultUpdate, s.plan.Update); err != nil {
+		return err
+	}
+	return updateScoped(s.inner, s.opts)
+}
+
+func (s *_FaultyService) Files() interf.Files {
+	return s.inner.Files()
+}
+
+func (s *_FaultyService) Save(name string, r io.Reader, max int64) (interf.File, error) {
+	if err := s.fail(faultSave, s.plan.Save); err != nil {
+		return nil, err
+	}
+	return s.inner.Save(name, r, max)
+}
+
+func (s *_FaultyService) Trash(file interf.File) error {
+	if err := s.fail(faultTrash, s.plan.Trash); err != nil {
+		return err
+	}
+	return trashScoped(s.inner, file, s.opts)
+}
+
+func (s *_FaultyService) Reader(file interf.File, off int64) (io.ReadCloser, error) {
+	if err := s.fail(faultOpen, s.plan.Open); err != nil {
+		return nil, err
+	}
+	r, err := s.inner.Reader(file, off)
+	if err != nil {
+		return r, err
+	}
+	return s.wrap(r), nil
+}
+
+func (s *_FaultyService) LimitedReader(file interf.File, off int64, n int64) (io.ReadCloser, error) {
+	if err := s.fail(faultOpen, s.plan.Open); err != nil {
+		return nil, err
+	}
+	r, err := s.inner.LimitedReader(file, off, n)
+	if err != nil {
+		return r, err
+	}
+	return s.wrap(r), nil
+}
+
+func (s *_FaultyService) ReaderAt(file interf.File) (interf.ReaderAt, error) {
+	return NewReaderAt(file, s, s.inner.Cache(), s.debugLvl, s.opts...)
+}
+
+func (s *_FaultyService) MultiReaderAt(list []interf.File) (interf.ReaderAt, error) {
+	if len(list) == 1 {
+		// use the normal ReaderAt for single files
+		return s.ReaderAt(list[0])
+	} else {
+		// MultiReaderAt
+		return NewMultiReaderAt(list, s, s.inner.Cache(), s.debugLvl, s.opts...)
+	}
+}
+
+func (s *_FaultyService) Cache() interf.Cache {
+	return s.inner.Cache()
+}
+
+//--------  HELPER  --------------------------------------------------------------------------------------------------//
+
+// fail counts the call and returns the fault error if this call should fail, otherwise nil.
+func (s *_FaultyService) fail(index int, f Fault) error {
+	call := atomic.AddUint64(&s.calls[index], 1)
+
+	// deterministic schedule
+	hit := false
+	for _, v := range f.Schedule {
+		if v == call {
+			hit = true
+			break
+		}
+	}
+
+	// probability
+	if !hit && f.Probability > 0 {
+		s.mux.Lock() // LOCK
+		hit = s.rnd.Float64() < f.Probability
+		s.mux.Unlock() // UNLOCK
+	}
+
+	if !hit {
+		return nil
+	}
+	if f.Err != nil {
+		return f.Err
+	}
+	return ErrInjected
+}
+
+// wrap decides the stream faults for a new connection.
+func (s *_FaultyService) wrap(r io.ReadCloser) io.ReadCloser {
+	fr := &_FaultyReader{c: r, max: -1, cut: -1}
+
+	if err := s.fail(faultShortRead, s.plan.ShortRead); err != nil {
+		fr.max = s.plan.ShortReadMax
+		if fr.max < 1 {
+			fr.max = 1
+		}
+	}
+	if err := s.fail(faultCut, s.plan.Cut); err != nil {
+		fr.cut = s.plan.CutAfter
+		fr.cutErr = err
+		if fr.cut < 0 {
+			fr.cut = 0
+		}
+	}
+	if err := s.fail(faultCorrupt, s.plan.Corrupt); err != nil {
+		fr.corrupt = true
+	}
+
+	return fr
+}
+
+// ------------------------------------------------------------------------------------------------------------------ //
+
+// interface check: io.ReadCloser
+var _ io.ReadCloser = (*_FaultyReader)(nil)
+
+// _FaultyReader is a connection with injected stream faults.
+type _FaultyReader struct {
+	c       io.ReadCloser
+	max     int   // max bytes per Read() (-1 = no short reads)
+	cut     int64 // remaining bytes until the connection dies (-1 = never)
+	cutErr  error
+	corrupt bool
+}
+
+func (r *_FaultyReader) Read(p []byte) (int, error) {
+	// dead connection
+	if r.cut == 0 {
+		return 0, r.cutErr
+	}
+
+	// limit the request
+	if r.max > 0 && len(p) > r.max {
+		p = p[:r.max]
+	}
+	if r.cut > 0 && int64(len(p)) > r.cut {
+		p = p[:r.cut]
+	}
+
+	n, err := r.c.Read(p)
+
+	// corrupt
+	if r.corrupt && n > 0 {
+		p[0] = ^p[0]
+	}
+
+	// cut
+	if r.cut > 0 {
+		r.cut -= int64(n)
+		if r.cut == 0 && err == nil {
+			err = r.cutErr
+		}
+	}
+	return n, err
+}
+
+func (r *_FaultyReader) Close() error {
+	return r.c.Close()
+}
@@ -0,0 +1,298 @@
+package impl_test
+
+import (
+	"bytes"
+	"errors"
+	impl "github.com/SchnorcherSepp/storage/defaultimpl"
+	interf "github.com/SchnorcherSepp/storage/interfaces"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestFaultyService_Schedule(t *testing.T) {
+	myErr := errors.New("my error")
+	inner := impl.NewRamService(nil, impl.DebugOff)
+	s := impl.NewFaultyService(inner, impl.FaultPlan{
+		Update: impl.Fault{Schedule: []uint64{2}},
+		Save:   impl.Fault{Schedule: []uint64{1, 3}, Err: myErr},
+		Trash:  impl.Fault{Schedule: []uint64{1}},
+		Open:   impl.Fault{Schedule: []uint64{2}},
+	}, impl.DebugOff)
+
+	// Save: 1 and 3 fail
+	for i, want := range []error{myErr, nil, myErr, nil} {
+		if _, err := s.Save("test.dat", bytes.NewReader([]byte("Test Bytes Foo Bar")), 0); err != want {
+			t.Fatalf("save %d: wrong error: %v", i+1, err)
+		}
+	}
+
+	// Update: 2 fails
+	if err := s.Update(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Update(); err != impl.ErrInjected {
+		t.Fatalf("wrong error: %v", err)
+	}
+	if len(s.Files().All()) != 2 {
+		t.Fatalf("wrong file count: %d", len(s.Files().All()))
+	}
+	f := s.Files().All()[0]
+
+	// Open: 2 fails
+	for i, want := range []error{nil, impl.ErrInjected, nil} {
+		r, err := s.LimitedReader(f, 0, 4)
+		if err != want {
+			t.Fatalf("open %d: wrong error: %v", i+1, err)
+		}
+		if err == nil {
+			b, _ := ioutil.ReadAll(r)
+			_ = r.Close()
+			if string(b) != "Test" {
+				t.Fatalf("wrong data: %s", b)
+			}
+		}
+	}
+
+	// Trash: 1 fails
+	if err := s.Trash(f); err != impl.ErrInjected {
+		t.Fatalf("wrong error: %v", err)
+	}
+	if err := s.Trash(f); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFaultyService_Probability(t *testing.T) {
+	plan := impl.FaultPlan{Seed: 1337, Save: impl.Fault{Probability: 0.5}}
+	s := impl.NewFaultyService(impl.NewRamService(nil, impl.DebugOff), plan, impl.DebugOff)
+
+	fails := 0
+	for i := 0; i < 1000; i++ {
+		if _, err := s.Save("test.dat", bytes.NewReader([]byte("x")), 0); err != nil {
+			fails++
+		}
+	}
+	if fails < 400 || fails > 600 {
+		t.Fatalf("wrong fail count: %d", fails)
+	}
+
+	// always and never
+	s = impl.NewFaultyService(impl.NewRamService(nil, impl.DebugOff), impl.FaultPlan{Update: impl.Fault{Probability: 1}}, impl.DebugOff)
+	for i := 0; i < 100; i++ {
+		if err := s.Update(); err == nil {
+			t.Fatal("no error with probability 1")
+		}
+		if _, err := s.Save("test.dat", bytes.NewReader([]byte("x")), 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFaultyService_Stream(t *testing.T) {
+	data, inner := newFaultyTestData(t)
+	f := inner.Files().All()[0]
+
+	s := impl.NewFaultyService(inner, impl.FaultPlan{
+		ShortRead:    impl.Fault{Schedule: []uint64{1}},
+		ShortReadMax: 7,
+		Cut:          impl.Fault{Schedule: []uint64{2}},
+		CutAfter:     1000,
+		Corrupt:      impl.Fault{Schedule: []uint64{3}},
+	}, impl.DebugOff)
+
+	// 1: short reads, but all data
+	r, _ := s.Reader(f, 0)
+	buf := make([]byte, 100)
+	if n, err := r.Read(buf); n != 7 || err != nil {
+		t.Fatalf("wrong short read: n=%d, err=%v", n, err)
+	}
+	b, err := ioutil.ReadAll(r)
+	_ = r.Close()
+	if err != nil || !bytes.Equal(append(buf[:7], b...), data) {
+		t.Fatalf("wrong data: %v", err)
+	}
+
+	// 2: cut after 1000 bytes
+	r, _ = s.Reader(f, 0)
+	b, err = ioutil.ReadAll(r)
+	_ = r.Close()
+	if err != impl.ErrInjected || !bytes.Equal(b, data[:1000]) {
+		t.Fatalf("wrong cut: len=%d, err=%v", len(b), err)
+	}
+
+	// 3: corrupt
+	r, _ = s.Reader(f, 0)
+	b, err = ioutil.ReadAll(r)
+	_ = r.Close()
+	if err != nil || len(b) != len(data) || bytes.Equal(b, data) || b[0] != ^data[0] {
+		t.Fatalf("wrong corrupt data: %v", err)
+	}
+}
+
+func TestFaultyService_ReaderAt(t *testing.T) {
+	data, inner := newFaultyTestData(t)
+	f := inner.Files().All()[0]
+
+	// the first connection dies in the middle of the second sector
+	cutAfter := int64(interf.SectorSize + interf.SectorSize/2)
+	s := impl.NewFaultyService(inner, impl.FaultPlan{
+		Cut:       impl.Fault{Schedule: []uint64{1}},
+		CutAfter:  cutAfter,
+		ShortRead: impl.Fault{Probability: 1},
+	}, impl.DebugOff)
+
+	rAt, err := s.ReaderAt(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rAt.Close()
+
+	// read over the cut: partial data and the error
+	buf := make([]byte, 3*interf.SectorSize)
+	n, err := rAt.ReadAt(buf, 0)
+	if err != impl.ErrInjected || int64(n) != cutAfter || !bytes.Equal(buf[:n], data[:n]) {
+		t.Fatalf("wrong ReadAt: n=%d, err=%v", n, err)
+	}
+
+	// the next call opens a new connection
+	n, err = rAt.ReadAt(buf, 0)
+	if err != nil || n != len(buf) || !bytes.Equal(buf, data[:len(buf)]) {
+		t.Fatalf("wrong ReadAt: n=%d, err=%v", n, err)
+	}
+
+	// open fails
+	s = impl.NewFaultyService(inner, impl.FaultPlan{Open: impl.Fault{Probability: 1}}, impl.DebugOff)
+	rAt2, _ := s.ReaderAt(f)
+	defer rAt2.Close()
+	if n, err := rAt2.ReadAt(buf, 0); n != 0 || err != impl.ErrInjected {
+		t.Fatalf("wrong ReadAt: n=%d, err=%v", n, err)
+	}
+}
+
+func TestFaultyService_MultiReaderAt(t *testing.T) {
+	data, inner := newFaultyTestData(t)
+	f1 := inner.Files().All()[0]
+	f2, err := inner.Save("b.dat", bytes.NewReader(data), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the connection to the second file dies in the middle of the first sector
+	s := impl.NewFaultyService(inner, impl.FaultPlan{
+		Cut:      impl.Fault{Schedule: []uint64{2}},
+		CutAfter: 100,
+	}, impl.DebugOff)
+	mAt, err := s.MultiReaderAt([]interf.File{f1, f2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mAt.Close()
+
+	// read over the file border
+	buf := make([]byte, 200)
+	off := int64(len(data)) - 50
+	n, err := mAt.ReadAt(buf, off)
+	if err != impl.ErrInjected || n != 150 || !bytes.Equal(buf[:50], data[len(data)-50:]) || !bytes.Equal(buf[50:n], data[:100]) {
+		t.Fatalf("wrong ReadAt: n=%d, err=%v", n, err)
+	}
+
+	// retry
+	n, err = mAt.ReadAt(buf, off)
+	if err != nil || n != 200 || !bytes.Equal(buf[50:], data[:150]) {
+		t.Fatalf("wrong ReadAt: n=%d, err=%v", n, err)
+	}
+}
+
+func TestFaultyService_DebugLvl(t *testing.T) {
+	_, inner := newFaultyTestData(t)
+
+	if logs := readerAtLogs(t, impl.NewFaultyService(inner, impl.FaultPlan{}, impl.DebugOff)); logs != "" {
+		t.Fatalf("logs with DebugOff: %s", logs)
+	}
+	if logs := readerAtLogs(t, impl.NewFaultyService(inner, impl.FaultPlan{}, impl.DebugLow)); !strings.Contains(logs, "PrintStatAfterClose") {
+		t.Fatalf("no logs with DebugLow: %s", logs)
+	}
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+
+func TestRace_FaultyService(t *testing.T) {
+	data, inner := newFaultyTestData(t)
+	f := inner.Files().All()[0]
+	s := impl.NewFaultyService(inner, impl.FaultPlan{
+		Open:      impl.Fault{Probability: 0.2},
+		Cut:       impl.Fault{Probability: 0.2},
+		CutAfter:  5000,
+		ShortRead: impl.Fault{Probability: 0.5},
+		Save:      impl.Fault{Probability: 0.5},
+	}, impl.DebugOff)
+
+	rAt, _ := s.ReaderAt(f)
+	defer rAt.Close()
+
+	var wg sync.WaitGroup
+	wg.Add(5)
+	for n := 0; n < 5; n++ {
+		go func() {
+			//------------------------------
+			buf := make([]byte, 1000)
+			for i := 0; i < 50; i++ {
+				_, _ = s.Save("race.dat", bytes.NewReader([]byte("race")), 0)
+				off := rand.Int63n(int64(len(data) - len(buf)))
+				n, err := rAt.ReadAt(buf, off)
+				if !bytes.Equal(buf[:n], data[off:off+int64(n)]) || err != nil && err != impl.ErrInjected {
+					t.Fail()
+				}
+			}
+			//------------------------------
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+}
+
+//--------  HELPER  --------------------------------------------------------------------------------------------------//
+
+// newFaultyTestData returns a RAM service with one random file (10 sectors + 3 bytes).
+func newFaultyTestData(t *testing.T) ([]byte, interf.Service) {
+	data := make([]byte, 10*interf.SectorSize+3)
+	rand.New(rand.NewSource(1337)).Read(data)
+
+	s := impl.NewRamService(nil, impl.DebugOff)
+	if _, err := s.Save("a.dat", bytes.NewReader(data), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Update(); err != nil {
+		t.Fatal(err)
+	}
+	return data, s
+}
+
+// readerAtLogs reads the first file of the service with ReaderAt() and MultiReaderAt() and returns the debug logs.
+func readerAtLogs(t *testing.T, s interf.Service) string {
+	buf := new(bytes.Buffer)
+	log.SetOutput(buf) // write logs to buffer
+	defer log.SetOutput(os.Stderr)
+
+	f := s.Files().All()[0]
+	rAt, err := s.ReaderAt(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = rAt.ReadAt(make([]byte, 10), 0)
+	_ = rAt.Close()
+
+	mAt, err := s.MultiReaderAt([]interf.File{f, f})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = mAt.ReadAt(make([]byte, 10), 0)
+	_ = mAt.Close()
+
+	return buf.String()
+}
@@ -50,6 +50,85 @@ func FileByName(files []interf.File, name string) (interf.File, error) {
 	return ret, err
 }
 
+// BatchCache is an optional interface of interf.Cache to remove the sectors of many files at once.
+// Implemented by NewCache, NewLFUCache, NewDiskCache and the wrappers NewCompressedCache and NewLayeredCache.
+type BatchCache interface {
+
+	// InvalidateFiles behaves like InvalidateFile for all files, but iterates only once over all entries.
+	// Returns the number of removed sectors.
+	InvalidateFiles(fileIds []string) int
+}
+
+// InvalidateChanged removes all sectors of removed or modified files from the cache.
+// A file is modified if the size, modTime or md5 of the file id has changed.
+// Services call this function after an index update with the old and the new index.
+// With WithCacheNamespace, only the sectors of the namespace are removed (@see ScopedFileId).
+// The cache can be nil. Returns the number of invalidated files.
+func InvalidateChanged(cache interf.Cache, old, new interf.Files, opts ...ReaderAtOption) int {
+	if cache == nil || old == nil {
+		return 0
+	}
+	if new == nil {
+		new = NewFiles(nil) // all files are removed
+	}
+
+	var changed []string
+	for _, o := range old.All() {
+		f, err := new.ById(o.Id())
+		if err != nil || f.Size() != o.Size() || f.ModTime() != o.ModTime() || f.Md5() != o.Md5() {
+			changed = append(changed, ScopedFileId(o.Id(), opts...))
+		}
+	}
+	invalidateFiles(cache, changed) // all at once
+	return len(changed)
+}
+
+// updateScoped updates the inner service of a wrapper. The inner service removes the stale sectors of its
+// own namespace, so a wrapper with another namespace must remove its stale sectors itself (@see ScopedFileId).
+func updateScoped(inner interf.Service, opts []ReaderAtOption) error {
+	old := inner.Files()
+	err := inner.Update()
+	if err == nil && hasNamespace(opts) {
+		InvalidateChanged(inner.Cache(), old, inner.Files(), opts...)
+	}
+	return err
+}
+
+// trashScoped trashes the file with the inner service of a wrapper and removes the sectors of the
+// namespace of the wrapper (@see updateScoped).
+func trashScoped(inner interf.Service, file interf.File, opts []ReaderAtOption) error {
+	err := inner.Trash(file)
+	if c := inner.Cache(); err == nil && c != nil && file != nil && hasNamespace(opts) {
+		c.InvalidateFile(ScopedFileId(file.Id(), opts...))
+	}
+	return err
+}
+
+// invalidateFiles removes all sectors of the files with a single call of BatchCache.InvalidateFiles
+// or with InvalidateFile per file (other caches). Returns the number of removed sectors.
+func invalidateFiles(cache interf.Cache, fileIds []string) int {
+	if len(fileIds) == 0 {
+		return 0
+	}
+	if bc, ok := cache.(BatchCache); ok {
+		return bc.InvalidateFiles(fileIds)
+	}
+	n := 0
+	for _, id := range fileIds {
+		n += cache.InvalidateFile(id)
+	}
+	return n
+}
+
+// fileIdSet converts the list of file ids to a set.
+func fileIdSet(fileIds []string) map[string]bool {
+	set := make(map[string]bool, len(fileIds))
+	for _, id := range fileIds {
+		set[id] = true
+	}
+	return set
+}
+
 // FileByAttr returns the first file found with the requested attributes.
 // If the parameter md5 is empty, this attribute is not considered in the search.
 // If no file is found, the os.ErrNotExist error is returned.
@@ -56,3 +56,70 @@ func TestFileByAttr(t *testing.T) {
 		t.Fatalf("no error: f=%v, e=%v", f, err)
 	}
 }
+
+func TestInvalidateChanged(t *testing.T) {
+	old := impl.NewFiles(map[string]interf.File{
+		"same":    impl.NewFile("same", "a", 1, 10, "h1"),
+		"removed": impl.NewFile("removed", "b", 1, 10, "h2"),
+		"size":    impl.NewFile("size", "c", 1, 10, "h3"),
+		"modTime": impl.NewFile("modTime", "d", 1, 10, "h4"),
+		"md5":     impl.NewFile("md5", "e", 1, 10, "h5"),
+	})
+	new := impl.NewFiles(map[string]interf.File{
+		"same":    impl.NewFile("same", "a", 1, 10, "h1"),
+		"size":    impl.NewFile("size", "c", 1, 11, "h3"),
+		"modTime": impl.NewFile("modTime", "d", 2, 10, "h4"),
+		"md5":     impl.NewFile("md5", "e", 1, 10, "xx"),
+		"added":   impl.NewFile("added", "f", 1, 10, "h6"),
+	})
+
+	// fill cache
+	c := impl.NewCache(0)
+	for _, id := range []string{"same", "removed", "size", "modTime", "md5", "added"} {
+		_ = c.Set(id, 0, []byte{1})
+		_ = c.Set(id, 1, []byte{1})
+	}
+
+	// TEST: input (cache:nil, old:nil, new:nil)
+	if n := impl.InvalidateChanged(nil, old, new); n != 0 {
+		t.Fatalf("wrong count: %d", n)
+	}
+	if n := impl.InvalidateChanged(c, nil, new); n != 0 {
+		t.Fatalf("wrong count: %d", n)
+	}
+
+	// TEST: changes
+	if n := impl.InvalidateChanged(c, old, new); n != 4 {
+		t.Fatalf("wrong count: %d", n)
+	}
+	for _, id := range []string{"same", "added"} {
+		if _, err := c.Get(id, 1, nil); err != nil {
+			t.Fatalf("valid sector removed: %s", id)
+		}
+	}
+	for _, id := range []string{"removed", "size", "modTime", "md5"} {
+		if _, err := c.Get(id, 1, nil); err == nil {
+			t.Fatalf("stale sector: %s", id)
+		}
+	}
+
+	// TEST: all removed
+	if n := impl.InvalidateChanged(c, new, nil); n != 5 || c.Stats().Entries != 0 {
+		t.Fatalf("wrong count: %d", n)
+	}
+}
+
+func TestInvalidateChanged_noBatch(t *testing.T) {
+	old := impl.NewFiles(map[string]interf.File{
+		"a": impl.NewFile("a", "a", 1, 10, "h1"),
+		"b": impl.NewFile("b", "b", 1, 10, "h2"),
+	})
+
+	// a cache without BatchCache: InvalidateFile per file
+	c := impl.NewCache(0)
+	_ = c.Set("a", 0, []byte{1})
+	_ = c.Set("b", 0, []byte{1})
+	if n := impl.InvalidateChanged(struct{ interf.Cache }{c}, old, nil); n != 2 || c.Stats().Entries != 0 {
+		t.Fatalf("wrong count: %d", n)
+	}
+}
@@ -0,0 +1,158 @@
+package impl
+
+import (
+	"errors"
+	interf "github.com/SchnorcherSepp/storage/interfaces"
+	"github.com/oxtoacart/bpool"
+	"sync/atomic"
+)
+
+// interface check: interf.Cache, ExpireCache, BatchCache, FileStatsCache
+var _ interf.Cache = (*_LayeredCache)(nil)
+var _ ExpireCache = (*_LayeredCache)(nil)
+var _ BatchCache = (*_LayeredCache)(nil)
+var _ FileStatsCache = (*_LayeredCache)(nil)
+
+// @see interf.Cache
+//
+// LayeredCache combines a fast first-level cache (L1, e.g. RAM) with a large second-level cache (L2, e.g. disk).
+type _LayeredCache struct {
+	l1     interf.Cache
+	l2     interf.Cache
+	hits   int64 // atomic
+	misses int64 // atomic
+}
+
+// NewLayeredCache returns a interf.Cache with two levels.
+// Get() asks L1 first and copies L2 hits into L1. Set() writes to both levels.
+//
+// Example of use:
+//   l2, err := impl.NewDiskCache("/var/cache/storage", 10*1024)
+//   cache := impl.NewLayeredCache(impl.NewCache(500), l2)
+func NewLayeredCache(l1, l2 interf.Cache) interf.Cache {
+	return &_LayeredCache{
+		l1: l1,
+		l2: l2,
+	}
+}
+
+// @see interf.Cache
+//
+// Get returns the value or 'not found' error.
+// This method doesn't allocate memory when the capacity of buf is greater or equal to value.
+func (c *_LayeredCache) Get(fileId string, sector uint64, buf []byte) ([]byte, error) {
+	// L1
+	b, err := c.l1.Get(fileId, sector, buf)
+	if err == nil {
+		atomic.AddInt64(&c.hits, 1)
+		return b, nil
+	}
+
+	// L2
+	b, err = c.l2.Get(fileId, sector, buf)
+	if err != nil {
+		atomic.AddInt64(&c.misses, 1)
+		return b, err
+	}
+	atomic.AddInt64(&c.hits, 1)
+	_ = c.l1.Set(fileId, sector, b) // promote
+	return b, nil
+}
+
+// @see interf.Cache
+//
+// Set stores the value in both levels.
+// Old data can be deleted if the cache is full.
+// The value expires after interf.CacheExpireSeconds.
+func (c *_LayeredCache) Set(fileId string, sector uint64, data []byte) error {
+	err1 := c.l1.Set(fileId, sector, data)
+	err2 := c.l2.Set(fileId, sector, data)
+	if err1 != nil {
+		return err1
+	}
+	return err2
+}
+
+// @see ExpireCache
+//
+// SetExpire stores the value in both levels. The value expires after expireSeconds.
+// Both levels must implement ExpireCache.
+func (c *_LayeredCache) SetExpire(fileId string, sector uint64, data []byte, expireSeconds int) error {
+	if expireSeconds <= 0 {
+		return errors.New("invalid expire")
+	}
+	err1 := cacheSet(c.l1, fileId, sector, data, expireSeconds)
+	err2 := cacheSet(c.l2, fileId, sector, data, expireSeconds)
+	if err1 != nil {
+		return err1
+	}
+	return err2
+}
+
+// @see interf.Cache
+//
+// Pool returns the byte pool of L1.
+func (c *_LayeredCache) Pool() *bpool.BytePool {
+	return c.l1.Pool()
+}
+
+// @see interf.Cache
+//
+// Size returns the max. capacity of both levels in bytes.
+func (c *_LayeredCache) Size() int64 {
+	return c.l1.Size() + c.l2.Size()
+}
+
+// @see interf.Cache
+//
+// InvalidateFile removes all sectors of the file from both levels.
+// Returns the number of removed sectors of both levels.
+func (c *_LayeredCache) InvalidateFile(fileId string) int {
+	return c.l1.InvalidateFile(fileId) + c.l2.InvalidateFile(fileId)
+}
+
+// @see BatchCache
+//
+// InvalidateFiles removes all sectors of the files from both levels.
+func (c *_LayeredCache) InvalidateFiles(fileIds []string) int {
+	return invalidateFiles(c.l1, fileIds) + invalidateFiles(c.l2, fileIds)
+}
+
+// @see interf.Cache
+//
+// Stats returns the sum of both levels. A sector in both levels is counted twice.
+// Hits and Misses are the Get() calls of this cache (a L1 miss with a L2 hit is a hit).
+func (c *_LayeredCache) Stats() interf.CacheStats {
+	return c.merge(c.l1.Stats(), c.l2.Stats())
+}
+
+// @see FileStatsCache
+//
+// FileStats returns Stats() with Bytes and Files of both levels (@see FullStats).
+func (c *_LayeredCache) FileStats() interf.CacheStats {
+	return c.merge(FullStats(c.l1), FullStats(c.l2))
+}
+
+// merge returns the sum of the statistics of both levels with the Hits and Misses of this cache.
+func (c *_LayeredCache) merge(s1, s2 interf.CacheStats) interf.CacheStats {
+
+	stats := interf.CacheStats{
+		Entries:     s1.Entries + s2.Entries,
+		Bytes:       s1.Bytes + s2.Bytes,
+		Hits:        atomic.LoadInt64(&c.hits),
+		Misses:      atomic.LoadInt64(&c.misses),
+		Evictions:   s1.Evictions + s2.Evictions,
+		Expirations: s1.Expirations + s2.Expirations,
+		Files:       s1.Files,
+	}
+	if lookups := stats.Hits + stats.Misses; lookups > 0 {
+		stats.HitRate = float64(stats.Hits) / float64(lookups)
+	}
+	if stats.Files == nil {
+		stats.Files = make(map[string]int64)
+	}
+	for k, v := range s2.Files {
+		stats.Files[k] += v
+	}
+	return stats
+}
@@ -0,0 +1,486 @@
+package impl
+
+import (
+	"errors"
+	interf "github.com/SchnorcherSepp/storage/interfaces"
+	"github.com/coocood/freecache"
+	"github.com/oxtoacart/bpool"
+	"sync"
+	"time"
+)
+
+// interface check: interf.Cache, ExpireCache, BatchCache
+var _ interf.Cache = (*_LFUCache)(nil)
+var _ ExpireCache = (*_LFUCache)(nil)
+var _ BatchCache = (*_LFUCache)(nil)
+
+// lfuShards is the number of independent parts of the LFU cache (power of 2).
+const lfuShards = 16
+
+// lfuSlotSize is the max. value size: a sector and a small header of a wrapper (@see NewCompressedCache).
+const lfuSlotSize = interf.SectorSize + 64
+
+// @see interf.Cache
+//
+// LFUCache stores sectors with a W-TinyLFU admission policy:
+// New sectors enter a small LRU window (1%). A sector that leaves the window only enters the
+// main LRU (99%) if it was requested more often than the main LRU victim (count-min sketch).
+// A single sequential read of a huge file can't flush the hot sectors.
+//
+// The memory is allocated once (no GC pressure) and split into slots of SectorSize (plus a small header).
+// The cache is divided into shards for concurrency.
+type _LFUCache struct {
+	shards    [lfuShards]*_LFUShard
+	pool      *bpool.BytePool
+	cacheSize int64
+}
+
+// NewLFUCache returns a interf.Cache with a scan-resistant admission policy (@see NewCache).
+// Values can't be larger than SectorSize + 64 bytes.
+// cacheSizeMB can't be less than 17 (min. 1024 * SectorSize =~ 17 MB).
+func NewLFUCache(cacheSizeMB int) interf.Cache {
+	// cache min. size
+	min := ((1024 * interf.SectorSize) / (1024 * 1024)) + 1
+	if cacheSizeMB < min {
+		cacheSizeMB = min
+	}
+
+	// slots per shard
+	slots := (cacheSizeMB * 1024 * 1024) / interf.SectorSize / lfuShards
+
+	c := &_LFUCache{
+		pool:      bpool.NewBytePool(300, interf.SectorSize), // ~ 5 MB
+		cacheSize: int64(slots) * lfuShards * interf.SectorSize,
+	}
+	for i := range c.shards {
+		c.shards[i] = newLFUShard(slots)
+	}
+	return c
+}
+
+// @see interf.Cache
+//
+// Get returns the value or 'not found' error.
+// This method doesn't allocate memory when the capacity of buf is greater or equal to value.
+func (c *_LFUCache) Get(fileId string, sector uint64, buf []byte) ([]byte, error) {
+	h := lfuHash(fileId, sector)
+	return c.shards[h&(lfuShards-1)].get(_LFUKey{fileId: fileId, sector: sector}, h, buf)
+}
+
+// @see interf.Cache
+//
+// Set stores the value in the cache.
+// Old data can be deleted if the cache is full, or the new value is rejected by the admission policy.
+// The value expires after interf.CacheExpireSeconds.
+func (c *_LFUCache) Set(fileId string, sector uint64, data []byte) error {
+	if len(data) > lfuSlotSize {
+		return errors.New("entry too large")
+	}
+	h := lfuHash(fileId, sector)
+	c.shards[h&(lfuShards-1)].set(_LFUKey{fileId: fileId, sector: sector}, h, data, time.Now().Unix()+interf.CacheExpireSeconds)
+	return nil
+}
+
+// @see ExpireCache
+//
+// SetExpire stores the value in the cache (@see Set). The value expires after expireSeconds.
+func (c *_LFUCache) SetExpire(fileId string, sector uint64, data []byte, expireSeconds int) error {
+	if len(data) > lfuSlotSize {
+		return errors.New("entry too large")
+	}
+	if expireSeconds <= 0 {
+		return errors.New("invalid expire")
+	}
+	h := lfuHash(fileId, sector)
+	c.shards[h&(lfuShards-1)].set(_LFUKey{fileId: fileId, sector: sector}, h, data, time.Now().Unix()+int64(expireSeconds))
+	return nil
+}
+
+// @see interf.Cache
+//
+// Pool returns a byte pool. This means that the small byte buffers can be reused and the allocation is reduced.
+// The Pool contain 300 buffer with the size of interf.SectorSize.
+func (c *_LFUCache) Pool() *bpool.BytePool {
+	return c.pool
+}
+
+// @see interf.Cache
+//
+// Size returns the max. capacity of this cache in bytes.
+func (c *_LFUCache) Size() int64 {
+	return c.cacheSize
+}
+
+// @see interf.Cache
+//
+// InvalidateFile removes all sectors of the file from the cache (all scopes or the namespace, @see ScopedFileId).
+func (c *_LFUCache) InvalidateFile(fileId string) int {
+	return c.InvalidateFiles([]string{fileId})
+}
+
+// @see BatchCache
+//
+// InvalidateFiles removes all sectors of the files from the cache (all scopes or the namespace, @see ScopedFileId).
+func (c *_LFUCache) InvalidateFiles(fileIds []string) int {
+	if len(fileIds) == 0 {
+		return 0
+	}
+	ids := fileIdSet(fileIds)
+
+	n := 0
+	for _, s := range c.shards {
+		n += s.invalidate(ids)
+	}
+	return n
+}
+
+// @see interf.Cache
+//
+// Stats returns the current statistics of this cache.
+// Evictions include the sectors rejected by the admission policy.
+func (c *_LFUCache) Stats() interf.CacheStats {
+	stats := interf.CacheStats{Files: make(map[string]int64)}
+	for _, s := range c.shards {
+		s.addStats(&stats)
+	}
+	if lookups := stats.Hits + stats.Misses; lookups > 0 {
+		stats.HitRate = float64(stats.Hits) / float64(lookups)
+	}
+	return stats
+}
+
+//-----  HELPER  -----------------------------------------------------------------------------------------------------//
+
+// _LFUKey is the map key of a sector (no allocation for lookups).
+type _LFUKey struct {
+	fileId string
+	sector uint64
+}
+
+// lfuHash is a FNV-1a hash of the sector key.
+func lfuHash(fileId string, sector uint64) uint64 {
+	const prime = 1099511628211
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(fileId); i++ {
+		h ^= uint64(fileId[i])
+		h *= prime
+	}
+	for i := 0; i < 8; i++ {
+		h ^= (sector >> (8 * i)) & 0xff
+		h *= prime
+	}
+	return h
+}
+
+// ------------------------------------------------------------------------------------------------------------------ //
+
+// _LFUNode is a slot of a shard. The nodes are linked by index (-1 = nil).
+type _LFUNode struct {
+	key      _LFUKey
+	hash     uint64
+	size     int
+	expire   int64 // unix time
+	prev     int32
+	next     int32
+	inWindow bool
+}
+
+// _LFUList is a LRU list of nodes (head = last used).
+type _LFUList struct {
+	head int32
+	tail int32
+	len  int
+}
+
+// _LFUShard is an independent part of the cache.
+type _LFUShard struct {
+	mux   *sync.Mutex // protect everything
+	index map[_LFUKey]int32
+	nodes []_LFUNode
+	data  []byte  // slot i: data[i*lfuSlotSize:]
+	free  []int32 // unused slots
+
+	window    _LFUList
+	main      _LFUList
+	windowCap int
+	mainCap   int
+	sketch    *_Sketch
+
+	hits, misses, evictions, expirations int64
+}
+
+func newLFUShard(slots int) *_LFUShard {
+	windowCap := slots / 100
+	if windowCap < 1 {
+		windowCap = 1
+	}
+
+	s := &_LFUShard{
+		mux:       new(sync.Mutex),
+		index:     make(map[_LFUKey]int32, slots),
+		nodes:     make([]_LFUNode, slots),
+		data:      make([]byte, slots*lfuSlotSize),
+		free:      make([]int32, slots),
+		window:    _LFUList{head: -1, tail: -1},
+		main:      _LFUList{head: -1, tail: -1},
+		windowCap: windowCap,
+		mainCap:   slots - windowCap,
+		sketch:    newSketch(slots),
+	}
+	for i := range s.free {
+		s.free[i] = int32(slots - 1 - i)
+	}
+	return s
+}
+
+// get copies the value into buf.
+func (s *_LFUShard) get(key _LFUKey, h uint64, buf []byte) ([]byte, error) {
+	s.mux.Lock() // LOCK
+	defer s.mux.Unlock()
+
+	s.sketch.add(h) // count every request (frequency)
+
+	i, ok := s.index[key]
+	if !ok {
+		s.misses++
+		return nil, freecache.ErrNotFound
+	}
+	n := &s.nodes[i]
+	if n.expire <= time.Now().Unix() {
+		s.remove(i)
+		s.expirations++
+		s.misses++
+		return nil, freecache.ErrNotFound
+	}
+
+	// LRU update
+	l := s.list(i)
+	s.unlink(l, i)
+	s.pushFront(l, i)
+
+	// copy
+	if cap(buf) >= n.size {
+		buf = buf[:n.size]
+	} else {
+		buf = make([]byte, n.size)
+	}
+	off := int(i) * lfuSlotSize
+	copy(buf, s.data[off:off+n.size])
+
+	s.hits++
+	return buf, nil
+}
+
+// set stores the value until expire (unix time). New values enter the window.
+func (s *_LFUShard) set(key _LFUKey, h uint64, data []byte, expire int64) {
+	s.mux.Lock() // LOCK
+	defer s.mux.Unlock()
+
+	// update
+	if i, ok := s.index[key]; ok {
+		s.write(i, data, expire)
+		l := s.list(i)
+		s.unlink(l, i)
+		s.pushFront(l, i)
+		return
+	}
+
+	// free a slot
+	if len(s.free) == 0 {
+		s.overflow()
+	}
+
+	// insert into window
+	i := s.free[len(s.free)-1]
+	s.free = s.free[:len(s.free)-1]
+	s.nodes[i] = _LFUNode{key: key, hash: h, inWindow: true}
+	s.write(i, data, expire)
+	s.index[key] = i
+	s.pushFront(&s.window, i)
+
+	if s.window.len > s.windowCap {
+		s.overflow()
+	}
+}
+
+// overflow moves the window victim to the main LRU or drops it (admission policy).
+func (s *_LFUShard) overflow() {
+	candidate := s.window.tail
+	if candidate < 0 {
+		return
+	}
+	s.unlink(&s.window, candidate)
+	s.nodes[candidate].inWindow = false
+
+	// main has space
+	if s.main.len < s.mainCap {
+		s.pushFront(&s.main, candidate)
+		return
+	}
+
+	// duel: the more frequent sector wins
+	victim := s.main.tail
+	if victim >= 0 && s.sketch.estimate(s.nodes[candidate].hash) > s.sketch.estimate(s.nodes[victim].hash) {
+		s.remove(victim)
+		s.pushFront(&s.main, candidate)
+	} else {
+		s.release(candidate) // rejected
+	}
+	s.evictions++
+}
+
+// write copies the data into the slot.
+func (s *_LFUShard) write(i int32, data []byte, expire int64) {
+	off := int(i) * lfuSlotSize
+	copy(s.data[off:off+len(data)], data)
+	s.nodes[i].size = len(data)
+	s.nodes[i].expire = expire
+}
+
+// remove unlinks the node and frees the slot.
+func (s *_LFUShard) remove(i int32) {
+	s.unlink(s.list(i), i)
+	s.release(i)
+}
+
+// release frees the slot of an unlinked node.
+func (s *_LFUShard) release(i int32) {
+	delete(s.index, s.nodes[i].key)
+	s.nodes[i] = _LFUNode{}
+	s.free = append(s.free, i)
+}
+
+// list returns the list of the node.
+func (s *_LFUShard) list(i int32) *_LFUList {
+	if s.nodes[i].inWindow {
+		return &s.window
+	}
+	return &s.main
+}
+
+func (s *_LFUShard) unlink(l *_LFUList, i int32) {
+	n := &s.nodes[i]
+	if n.prev >= 0 {
+		s.nodes[n.prev].next = n.next
+	} else {
+		l.head = n.next
+	}
+	if n.next >= 0 {
+		s.nodes[n.next].prev = n.prev
+	} else {
+		l.tail = n.prev
+	}
+	n.prev, n.next = -1, -1
+	l.len--
+}
+
+func (s *_LFUShard) pushFront(l *_LFUList, i int32) {
+	n := &s.nodes[i]
+	n.prev = -1
+	n.next = l.head
+	if l.head >= 0 {
+		s.nodes[l.head].prev = i
+	}
+	l.head = i
+	if l.tail < 0 {
+		l.tail = i
+	}
+	l.len++
+}
+
+// invalidate removes all sectors of the files (set of file ids, @see cacheIdMatch).
+func (s *_LFUShard) invalidate(fileIds map[string]bool) int {
+	s.mux.Lock() // LOCK
+	defer s.mux.Unlock()
+
+	n := 0
+	for key, i := range s.index {
+		if cacheIdMatch(key.fileId, fileIds) {
+			s.remove(i)
+			n++
+		}
+	}
+	return n
+}
+
+// addStats adds the values of this shard.
+func (s *_LFUShard) addStats(stats *interf.CacheStats) {
+	s.mux.Lock() // LOCK
+	defer s.mux.Unlock()
+
+	stats.Entries += int64(len(s.index))
+	stats.Hits += s.hits
+	stats.Misses += s.misses
+	stats.Evictions += s.evictions
+	stats.Expirations += s.expirations
+	for key, i := range s.index {
+		stats.Bytes += int64(s.nodes[i].size)
+		stats.Files[cacheFileId(key.fileId)]++
+	}
+}
+
+// ------------------------------------------------------------------------------------------------------------------ //
+
+// _Sketch is a count-min sketch with 4 rows of 8-bit counters.
+// All counters are halved periodically, so old frequencies fade (aging).
+type _Sketch struct {
+	rows    [4][]uint8
+	mask    uint64
+	samples int
+	limit   int // halve all counters after limit samples
+}
+
+func newSketch(slots int) *_Sketch {
+	width := 16
+	for width < slots*4 {
+		width *= 2
+	}
+	s := &_Sketch{
+		mask:  uint64(width - 1),
+		limit: slots * 10,
+	}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+	return s
+}
+
+// index returns the counter index of row i (double hashing).
+// The hash is mixed first, because the low bits select the shard.
+func (s *_Sketch) index(h uint64, i int) uint64 {
+	h = (h ^ (h >> 33)) * 0xff51afd7ed558ccd
+	h ^= h >> 33
+	return (h + uint64(i)*((h>>32)|1)) & s.mask
+}
+
+// add increments the counters of the hash.
+func (s *_Sketch) add(h uint64) {
+	for i := range s.rows {
+		idx := s.index(h, i)
+		if s.rows[i][idx] < 255 {
+			s.rows[i][idx]++
+		}
+	}
+
+	// aging
+	s.samples++
+	if s.samples >= s.limit {
+		for i := range s.rows {
+			for j := range s.rows[i] {
+				s.rows[i][j] /= 2
+			}
+		}
+		s.samples /= 2
+	}
+}
+
+// estimate returns the frequency of the hash (min of all rows).
+func (s *_Sketch) estimate(h uint64) uint8 {
+	min := uint8(255)
+	for i := range s.rows {
+		if v := s.rows[i][s.index(h, i)]; v < min {
+			min = v
+		}
+	}
+	return min
+}
@@ -0,0 +1,151 @@
+package impl_test
+
+import (
+	"bytes"
+	impl "github.com/SchnorcherSepp/storage/defaultimpl"
+	interf "github.com/SchnorcherSepp/storage/interfaces"
+	"sync"
+	"testing"
+)
+
+func TestNewLFUCache(t *testing.T) {
+	c := impl.NewLFUCache(0)
+	if c.Size() != 1088*interf.SectorSize || len(c.Pool().Get()) != interf.SectorSize {
+		t.Fatalf("wrong size: %d", c.Size())
+	}
+
+	// not found
+	if _, err := c.Get("fileId", 13, nil); err == nil {
+		t.Fatal("no error with empty cache")
+	}
+
+	// set and get
+	buf := bytes.Repeat([]byte{0xff}, interf.SectorSize)
+	if err := c.Set("fileId", 13, buf); err != nil {
+		t.Fatal(err)
+	}
+	buf[0] = 0x00 // data changes after Set()
+	b, err := c.Get("fileId", 13, c.Pool().Get())
+	if err != nil || len(b) != interf.SectorSize || b[0] != 0xff {
+		t.Fatalf("invalid data: %v", err)
+	}
+
+	// short sector, no allocation with buffer
+	if err := c.Set("fileId", 14, []byte{1, 2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	b2, err := c.Get("fileId", 14, b)
+	if err != nil || !bytes.Equal(b2, []byte{1, 2, 3}) || &b2[0] != &b[0] {
+		t.Fatalf("invalid data: %v", err)
+	}
+
+	// overwrite
+	_ = c.Set("fileId", 14, []byte{4})
+	if b, err := c.Get("fileId", 14, nil); err != nil || !bytes.Equal(b, []byte{4}) {
+		t.Fatalf("invalid data: %v", err)
+	}
+
+	// too large
+	if err := c.Set("fileId", 15, make([]byte, 2*interf.SectorSize)); err == nil {
+		t.Fatal("no error with too large data")
+	}
+
+	// invalidate (only the file, not files with the same prefix)
+	_ = c.Set("file", 13, []byte{1})
+	_ = c.Set("file\x00ns\x00", 13, []byte{1}) // scoped id
+	if n := c.InvalidateFile("file"); n != 2 {
+		t.Fatalf("wrong count: %d", n)
+	}
+	if _, err := c.Get("file", 13, nil); err == nil {
+		t.Fatal("sector not removed")
+	}
+
+	// stats
+	stats := c.Stats()
+	if stats.Entries != 2 || stats.Bytes != interf.SectorSize+1 || stats.Files["fileId"] != 2 {
+		t.Fatalf("wrong stats: %+v", stats)
+	}
+	if stats.Hits != 3 || stats.Misses != 2 || stats.HitRate != 3.0/5.0 {
+		t.Fatalf("wrong stats: %+v", stats)
+	}
+}
+
+func TestLFUCache_ScanResistance(t *testing.T) {
+	c := impl.NewLFUCache(0) // 17 MB = 1088 sectors
+	buf := make([]byte, interf.SectorSize)
+
+	// hot set: read several times
+	for i := uint64(0); i < 200; i++ {
+		_ = c.Set("hot", i, buf)
+	}
+	for n := 0; n < 4; n++ {
+		for i := uint64(0); i < 200; i++ {
+			if _, err := c.Get("hot", i, buf); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// one sequential read of a large file (miss and set, like ReaderAt)
+	for i := uint64(0); i < 5000; i++ {
+		if _, err := c.Get("big", i, buf); err == nil {
+			t.Fatalf("sector %d is cached", i)
+		}
+		if err := c.Set("big", i, buf); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the hot set survives
+	for i := uint64(0); i < 200; i++ {
+		if _, err := c.Get("hot", i, buf); err != nil {
+			t.Fatalf("hot sector %d evicted", i)
+		}
+	}
+
+	// the cache is full
+	stats := c.Stats()
+	if stats.Entries != 1088 || stats.Files["hot"] != 200 || stats.Evictions != 200+5000-1088 {
+		t.Fatalf("wrong stats: %+v", stats)
+	}
+
+	// frequently read sectors of the scan are admitted
+	for n := 0; n < 8; n++ {
+		if _, err := c.Get("big", 4000, buf); err == nil {
+			t.Fatal("sector 4000 is cached")
+		}
+	}
+	_ = c.Set("big", 4000, buf)
+	for i := uint64(0); i < 100; i++ {
+		_ = c.Set("other", i, buf) // push sector 4000 out of the window
+	}
+	if _, err := c.Get("big", 4000, buf); err != nil {
+		t.Fatal("frequent sector not admitted")
+	}
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+
+func TestRace_LFUCache(t *testing.T) {
+	c := impl.NewLFUCache(0)
+
+	var wg sync.WaitGroup
+	wg.Add(5)
+	for n := 0; n < 5; n++ {
+		go func() {
+			//------------------------------
+			for i := 0; i < 300; i++ {
+				errS := c.Set("fileId", uint64(i), []byte{0xff})
+				b, errG := c.Get("fileId", uint64(i), nil)
+				if errS != nil || errG != nil || len(b) != 1 || b[0] != 0xff {
+					t.Fail()
+				}
+				c.Stats()
+			}
+			//------------------------------
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+	c.InvalidateFile("fileId")
+}
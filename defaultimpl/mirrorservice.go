@@ -0,0 +1,555 @@
+package impl
+
+import (
+	"errors"
+	"fmt"
+	interf "github.com/SchnorcherSepp/storage/interfaces"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// interface check: interf.Service
+var _ interf.Service = (*_MirrorService)(nil)
+
+// MirrorFailTimeout is the time a backend is considered unhealthy after a read error.
+// Unhealthy backends are only used if no healthy backend has a copy of the file.
+const MirrorFailTimeout = 60 * time.Second
+
+// MirrorError reports the failed backends of a mirror operation.
+// A partial failure (at least one backend was successful) returns the result AND this error.
+type MirrorError struct {
+	Op   string  // the method, e.g. 'Save'
+	Errs []error // an entry for every backend (0 = primary), nil = success
+}
+
+func (e *MirrorError) Error() string {
+	var sb strings.Builder
+	failed := 0
+	for i, err := range e.Errs {
+		if err != nil {
+			failed++
+			sb.WriteString(fmt.Sprintf(", backend %d: %v", i, err))
+		}
+	}
+	return fmt.Sprintf("impl/%s: %d of %d backends failed%s", e.Op, failed, len(e.Errs), sb.String())
+}
+
+// Partial returns true if at least one backend was successful.
+func (e *MirrorError) Partial() bool {
+	for _, err := range e.Errs {
+		if err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// _MirrorService replicates all files to several backends.
+// Must be created with NewMirrorService().
+type _MirrorService struct {
+	backends []interf.Service // 0 = primary
+	failed   []int64          // time of the last read error per backend (unix nano, atomic)
+
+	mux    *sync.RWMutex            // protect 'files', 'copies' and 'links'
+	files  interf.Files             // merged index, set by Update()
+	copies map[string][]interf.File // mirror file id -> file of every backend (nil = no copy)
+	links  map[string][]interf.File // copies saved with this service (the names can differ, e.g. 'test (2).dat')
+
+	debugLvl uint8            // for ReaderAt() and MultiReaderAt()
+	opts     []ReaderAtOption // for ReaderAt() and MultiReaderAt()
+}
+
+// NewMirrorService combines a primary service and replicas.
+//
+// Save() and Trash() write to all backends. Partial failures return the result and a *MirrorError.
+// Update() merges the files of all backends: copies have the same name and size
+// and the same md5 (an empty md5 matches every md5, e.g. SFTP can't calculate hashes).
+// Copies saved with this service are always merged (some backends rename duplicates, e.g. 'test (2).dat').
+// The mirror file id is the id of the primary copy or '<backend index>/<id>' if the primary has no copy.
+//
+// Reader(), LimitedReader() and ReaderAt() use the first healthy backend with a copy
+// and fail over to the next backend if a read fails.
+// ReaderAt() and MultiReaderAt() use the cache of the primary.
+func NewMirrorService(primary interf.Service, replicas ...interf.Service) interf.Service {
+	return NewMirrorServiceWithOptions(DebugOff, nil, primary, replicas...)
+}
+
+// NewMirrorServiceWithOptions behaves like NewMirrorService.
+// The debug level and the options are used for ReaderAt() and MultiReaderAt() (@see ReaderAtOption).
+func NewMirrorServiceWithOptions(debugLvl uint8, opts []ReaderAtOption, primary interf.Service, replicas ...interf.Service) interf.Service {
+	backends := append([]interf.Service{primary}, replicas...)
+	return &_MirrorService{
+		backends: backends,
+		failed:   make([]int64, len(backends)),
+		mux:      new(sync.RWMutex),
+		files:    NewFiles(nil), // empty list, set by Update()
+		copies:   make(map[string][]interf.File),
+		links:    make(map[string][]interf.File),
+		debugLvl: debugLvl,
+		opts:     opts,
+	}
+}
+
+//-----------  IMPLEMENTATION:  @see interf.Service  -----------------------------------------------------------------//
+
+// Update updates all backends and merges the file indexes.
+// If a backend fails, the last index of this backend is used and a *MirrorError is returned.
+func (s *_MirrorService) Update() error {
+	// links before the update (newer links are not in the backend indexes)
+	s.mux.RLock() // READ Lock
+	links := make([]string, 0, len(s.links))
+	for id := range s.links {
+		links = append(links, id)
+	}
+	s.mux.RUnlock() // READ Unlock
+
+	// update all backends
+	errs := make([]error, len(s.backends))
+	var wg sync.WaitGroup
+	wg.Add(len(s.backends))
+	for i, b := range s.backends {
+		go func(i int, b interf.Service) {
+			errs[i] = b.Update()
+			wg.Done()
+		}(i, b)
+	}
+	wg.Wait()
+
+	// merge
+	s.mux.Lock() // LOCK
+	old := s.files
+	s.files, s.copies = s.merge(links)
+	s.mux.Unlock() // UNLOCK
+
+	InvalidateChanged(s.Cache(), old, s.Files(), s.opts...) // remove stale sectors (mirror ids)
+
+	return mirrorError("Update", errs)
+}
+
+func (s *_MirrorService) Files() interf.Files {
+	s.mux.RLock() // READ Lock
+	defer s.mux.RUnlock()
+
+	return s.files
+}
+
+// Save reads r once and saves the data in all backends in parallel.
+// The returned file is the primary copy (or the first successful copy).
+func (s *_MirrorService) Save(name string, r io.Reader, max int64) (interf.File, error) {
+	if r == nil {
+		return nil, errors.New("nil reader")
+	}
+
+	// limit reader
+	if max > 0 {
+		r = io.LimitReader(r, max)
+	}
+
+	// one pipe per backend
+	files := make([]interf.File, len(s.backends))
+	errs := make([]error, len(s.backends))
+	writers := make([]*io.PipeWriter, len(s.backends))
+
+	var wg sync.WaitGroup
+	wg.Add(len(s.backends))
+	for i, b := range s.backends {
+		pr, pw := io.Pipe()
+		writers[i] = pw
+		go func(i int, b interf.Service) {
+			files[i], errs[i] = b.Save(name, pr, 0)
+			if errs[i] != nil {
+				_ = pr.CloseWithError(errs[i]) // stop the writer
+			} else {
+				_ = pr.Close()
+			}
+			wg.Done()
+		}(i, b)
+	}
+
+	// copy
+	mw := &_MirrorWriter{writers: append([]*io.PipeWriter(nil), writers...)} // own list, drops failed pipes
+	_, err := io.Copy(mw, r)
+	for _, pw := range writers {
+		_ = pw.CloseWithError(err) // err=nil -> EOF
+	}
+	wg.Wait()
+
+	// result
+	copies := make([]interf.File, len(s.backends))
+	var file interf.File
+	for i, f := range files {
+		if errs[i] != nil {
+			continue
+		}
+		copies[i] = f
+		if file == nil {
+			file = s.mirrorFile(i, f, f.Md5())
+		}
+	}
+	if file == nil {
+		return nil, mirrorError("Save", errs)
+	}
+
+	s.mux.Lock() // LOCK
+	s.links[file.Id()] = copies
+	s.mux.Unlock() // UNLOCK
+
+	return file, mirrorError("Save", errs)
+}
+
+// Trash moves all copies of the file to the trash of their backend.
+func (s *_MirrorService) Trash(file interf.File) error {
+	copies, err := s.lookup(file)
+	if err != nil {
+		return err
+	}
+
+	errs := make([]error, len(s.backends))
+	for i, f := range copies {
+		if f != nil {
+			errs[i] = s.backends[i].Trash(f)
+		}
+	}
+
+	// remove stale sectors (mirror id)
+	if c := s.Cache(); c != nil {
+		c.InvalidateFile(ScopedFileId(file.Id(), s.opts...))
+	}
+	return mirrorError("Trash", errs)
+}
+
+func (s *_MirrorService) Reader(file interf.File, off int64) (io.ReadCloser, error) {
+	return s.open(file, off, -1)
+}
+
+func (s *_MirrorService) LimitedReader(file interf.File, off int64, n int64) (io.ReadCloser, error) {
+	if n < 1 {
+		// n = 0 -> no data requested -> return nothing
+		return ioutil.NopCloser(strings.NewReader("")), nil
+	}
+	return s.open(file, off, n)
+}
+
+func (s *_MirrorService) ReaderAt(file interf.File) (interf.ReaderAt, error) {
+	return NewReaderAt(file, s, s.Cache(), s.debugLvl, s.opts...)
+}
+
+func (s *_MirrorService) MultiReaderAt(list []interf.File) (interf.ReaderAt, error) {
+	if len(list) == 1 {
+		// use the normal ReaderAt for single files
+		return s.ReaderAt(list[0])
+	} else {
+		// MultiReaderAt
+		return NewMultiReaderAt(list, s, s.Cache(), s.debugLvl, s.opts...)
+	}
+}
+
+func (s *_MirrorService) Cache() interf.Cache {
+	return s.backends[0].Cache()
+}
+
+//--------  HELPER  --------------------------------------------------------------------------------------------------//
+
+// merge combines the file indexes of all backends.
+// Copies saved with this service are linked, all other files are merged by name, size and md5.
+// Links of the list prune are deleted if no copy exists anymore.
+// The caller must hold the write lock.
+func (s *_MirrorService) merge(prune []string) (interf.Files, map[string][]interf.File) {
+	type entry struct {
+		copies []interf.File
+	}
+	var entries []*entry
+	byKey := make(map[string][]*entry) // name + size -> entries
+
+	indexes := make([]interf.Files, len(s.backends))
+	linked := make([]map[string]bool, len(s.backends))
+	for i, b := range s.backends {
+		indexes[i] = b.Files()
+		linked[i] = make(map[string]bool)
+	}
+
+	// links
+	for _, id := range prune {
+		found := false
+		for i, f := range s.links[id] {
+			if f != nil {
+				if _, err := indexes[i].ById(f.Id()); err == nil {
+					found = true
+				}
+			}
+		}
+		if !found {
+			delete(s.links, id) // all copies are gone
+		}
+	}
+	for _, link := range s.links {
+		e := &entry{copies: make([]interf.File, len(s.backends))}
+		for i, f := range link {
+			if f == nil || linked[i][f.Id()] {
+				continue
+			}
+			if cur, err := indexes[i].ById(f.Id()); err == nil {
+				e.copies[i] = cur
+				linked[i][f.Id()] = true
+			}
+		}
+		for _, f := range e.copies {
+			if f != nil {
+				key := fmt.Sprintf("%d:%s", f.Size(), f.Name())
+				entries = append(entries, e)
+				byKey[key] = append(byKey[key], e)
+				break
+			}
+		}
+	}
+
+	// all other files
+	for i := range s.backends {
+		for _, f := range indexes[i].All() {
+			if linked[i][f.Id()] {
+				continue
+			}
+			key := fmt.Sprintf("%d:%s", f.Size(), f.Name())
+
+			// find an entry without a copy of this backend
+			var e *entry
+			for _, v := range byKey[key] {
+				if v.copies[i] == nil && md5Match(v.copies, f.Md5()) {
+					e = v
+					break
+				}
+			}
+
+			// new entry
+			if e == nil {
+				e = &entry{copies: make([]interf.File, len(s.backends))}
+				entries = append(entries, e)
+				byKey[key] = append(byKey[key], e)
+			}
+			e.copies[i] = f
+		}
+	}
+
+	// build index
+	byId := make(map[string]interf.File, len(entries))
+	copies := make(map[string][]interf.File, len(entries))
+	for _, e := range entries {
+		var file interf.File
+		h := ""
+		for i, f := range e.copies {
+			if f == nil {
+				continue
+			}
+			if h == "" {
+				h = f.Md5()
+			}
+			if file == nil {
+				file = s.mirrorFile(i, f, "")
+			}
+		}
+		file = NewFile(file.Id(), file.Name(), file.ModTime(), file.Size(), h)
+		byId[file.Id()] = file
+		copies[file.Id()] = e.copies
+	}
+	return NewFiles(byId), copies
+}
+
+// mirrorFile returns the mirror file of the copy f from the backend i.
+func (s *_MirrorService) mirrorFile(i int, f interf.File, md5 string) interf.File {
+	id := f.Id()
+	if i > 0 {
+		id = fmt.Sprintf("%d/%s", i, id)
+	}
+	return NewFile(id, f.Name(), f.ModTime(), f.Size(), md5)
+}
+
+// lookup returns the copies of the mirror file (index or links of new saves).
+func (s *_MirrorService) lookup(file interf.File) ([]interf.File, error) {
+	if file == nil {
+		return nil, errors.New("nil file")
+	}
+
+	s.mux.RLock() // READ Lock
+	defer s.mux.RUnlock()
+
+	if c, ok := s.copies[file.Id()]; ok {
+		return c, nil
+	}
+	if c, ok := s.links[file.Id()]; ok {
+		return c, nil
+	}
+	return nil, os.ErrNotExist
+}
+
+// order returns the backend indexes with a copy: healthy backends first.
+func (s *_MirrorService) order(copies []interf.File) []int {
+	healthy := make([]int, 0, len(copies))
+	var unhealthy []int
+	limit := time.Now().Add(-MirrorFailTimeout).UnixNano()
+
+	for i, f := range copies {
+		if f == nil {
+			continue
+		}
+		if atomic.LoadInt64(&s.failed[i]) > limit {
+			unhealthy = append(unhealthy, i)
+		} else {
+			healthy = append(healthy, i)
+		}
+	}
+	return append(healthy, unhealthy...)
+}
+
+// fail marks the backend as unhealthy.
+func (s *_MirrorService) fail(i int, err error) {
+	atomic.StoreInt64(&s.failed[i], time.Now().UnixNano())
+	log.Printf("WARNING: impl/MirrorService: backend %d failed: %v", i, err)
+}
+
+// open returns a reader with failover (n=-1: until the end of the file).
+func (s *_MirrorService) open(file interf.File, off, n int64) (io.ReadCloser, error) {
+	copies, err := s.lookup(file)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &_MirrorReader{
+		service: s,
+		copies:  copies,
+		order:   s.order(copies),
+		off:     off,
+		n:       n,
+	}
+	if err := r.next(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// mirrorError returns a *MirrorError if at least one error is not nil.
+func mirrorError(op string, errs []error) error {
+	for _, err := range errs {
+		if err != nil {
+			return &MirrorError{Op: op, Errs: errs}
+		}
+	}
+	return nil
+}
+
+// md5Match returns true if md5 matches all known hashes of the copies (empty hashes match everything).
+func md5Match(copies []interf.File, md5 string) bool {
+	if md5 == "" {
+		return true
+	}
+	for _, f := range copies {
+		if f != nil && f.Md5() != "" && !strings.EqualFold(f.Md5(), md5) {
+			return false
+		}
+	}
+	return true
+}
+
+// ------------------------------------------------------------------------------------------------------------------ //
+
+// interface check: io.ReadCloser
+var _ io.ReadCloser = (*_MirrorReader)(nil)
+
+// _MirrorReader reads a copy and switches to the next backend if a read fails.
+type _MirrorReader struct {
+	service *_MirrorService
+	copies  []interf.File
+	order   []int // backend indexes to try
+	c       io.ReadCloser
+	off     int64 // current offset
+	n       int64 // remaining bytes (-1 = until the end of the file)
+}
+
+// next opens the next backend at the current offset.
+func (r *_MirrorReader) next() error {
+	var lastErr error = os.ErrNotExist
+	for len(r.order) > 0 {
+		i := r.order[0]
+		r.order = r.order[1:]
+
+		var c io.ReadCloser
+		var err error
+		if r.n < 0 {
+			c, err = r.service.backends[i].Reader(r.copies[i], r.off)
+		} else {
+			c, err = r.service.backends[i].LimitedReader(r.copies[i], r.off, r.n)
+		}
+		if err == nil {
+			r.c = c
+			return nil
+		}
+		if err == io.EOF {
+			return err // offset behind the end of the file
+		}
+		r.service.fail(i, err)
+		lastErr = err
+	}
+	return lastErr
+}
+
+func (r *_MirrorReader) Read(p []byte) (int, error) {
+	if r.c == nil {
+		return 0, io.ErrClosedPipe
+	}
+
+	n, err := r.c.Read(p)
+	r.off += int64(n)
+	if r.n > 0 {
+		r.n -= int64(n)
+	}
+	if err == nil || err == io.EOF {
+		return n, err
+	}
+
+	// failover
+	_ = r.c.Close()
+	r.c = nil
+	if errN := r.next(); errN != nil {
+		return n, err // no other backend: return the original error
+	}
+	return n, nil
+}
+
+func (r *_MirrorReader) Close() error {
+	if r.c != nil {
+		err := r.c.Close()
+		r.c = nil
+		return err
+	}
+	return nil
+}
+
+// ------------------------------------------------------------------------------------------------------------------ //
+
+// _MirrorWriter writes to all pipes and drops pipes with errors (failed backends).
+// Only if all pipes have failed, an error is returned.
+type _MirrorWriter struct {
+	writers []*io.PipeWriter
+	failed  int
+}
+
+func (w *_MirrorWriter) Write(p []byte) (int, error) {
+	for i, pw := range w.writers {
+		if pw == nil {
+			continue
+		}
+		if _, err := pw.Write(p); err != nil {
+			w.writers[i] = nil
+			w.failed++
+		}
+	}
+	if w.failed == len(w.writers) {
+		return 0, errors.New("all backends failed")
+	}
+	return len(p), nil
+}
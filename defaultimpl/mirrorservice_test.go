@@ -0,0 +1,221 @@
+package impl_test
+
+import (
+	"bytes"
+	"errors"
+	impl "github.com/SchnorcherSepp/storage/defaultimpl"
+	interf "github.com/SchnorcherSepp/storage/interfaces"
+	"io/ioutil"
+	"math/rand"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestMirrorService_Save_Update(t *testing.T) {
+	primary := impl.NewRamService(nil, impl.DebugOff)
+	replica := impl.NewDiskService(t.TempDir(), nil, impl.DebugOff)
+	s := impl.NewMirrorService(primary, replica)
+
+	// save
+	f, err := s.Save("test.dat", strings.NewReader("Test Bytes Foo Bar"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Size() != 18 || f.Md5() != "bda184187bab92431f5f86e489b659f8" {
+		t.Fatalf("wrong file: %d, %s", f.Size(), f.Md5())
+	}
+
+	// readable before Update()
+	r, err := s.LimitedReader(f, 5, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(r)
+	_ = r.Close()
+	if string(b) != "Bytes" {
+		t.Fatalf("wrong data: %s", b)
+	}
+
+	// foreign files: same name with other data, replica only
+	_, _ = replica.Save("test.dat", strings.NewReader("Test Bytes Foo Baz"), 0)
+	_, _ = replica.Save("replica.dat", strings.NewReader("replica"), 0)
+
+	// update: merged index
+	if err := s.Update(); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Files().All()) != 3 {
+		t.Fatalf("wrong file count: %d", len(s.Files().All()))
+	}
+	if mf, err := s.Files().ById(f.Id()); err != nil || mf.Md5() != f.Md5() {
+		t.Fatalf("merged file not found: %v", err)
+	}
+	if _, err := s.Files().ById("1/test (2).dat"); err != nil {
+		t.Fatalf("replica file not found: %v", err)
+	}
+	rf, err := s.Files().ByName("replica.dat")
+	if err != nil || rf.Id() != "1/replica.dat" {
+		t.Fatalf("replica file not found: %v", err)
+	}
+
+	// read replica only file
+	r, err = s.Reader(rf, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ = ioutil.ReadAll(r)
+	_ = r.Close()
+	if string(b) != "replica" {
+		t.Fatalf("wrong data: %s", b)
+	}
+
+	// trash all copies
+	if err := s.Trash(f); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Update(); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Files().All()) != 2 || len(primary.Files().All()) != 0 || len(replica.Files().All()) != 2 {
+		t.Fatalf("wrong file count: %d", len(s.Files().All()))
+	}
+}
+
+func TestMirrorService_PartialFailure(t *testing.T) {
+	primary := impl.NewRamService(nil, impl.DebugOff)
+	replica := impl.NewFaultyService(impl.NewRamService(nil, impl.DebugOff), impl.FaultPlan{
+		Save:   impl.Fault{Schedule: []uint64{1, 2}},
+		Update: impl.Fault{Schedule: []uint64{1}},
+	}, impl.DebugOff)
+	s := impl.NewMirrorService(primary, replica)
+
+	// replica fails
+	f, err := s.Save("test.dat", strings.NewReader("Test Bytes Foo Bar"), 0)
+	var mErr *impl.MirrorError
+	if f == nil || !errors.As(err, &mErr) || !mErr.Partial() || mErr.Op != "Save" || mErr.Errs[0] != nil || mErr.Errs[1] != impl.ErrInjected {
+		t.Fatalf("wrong result: %v, %v", f, err)
+	}
+
+	// all fail
+	failing := impl.NewFaultyService(impl.NewRamService(nil, impl.DebugOff), impl.FaultPlan{Save: impl.Fault{Probability: 1}}, impl.DebugOff)
+	s2 := impl.NewMirrorService(failing, replica)
+	f, err = s2.Save("test.dat", strings.NewReader("Test Bytes Foo Bar"), 0)
+	if f != nil || !errors.As(err, &mErr) || mErr.Partial() {
+		t.Fatalf("wrong result: %v, %v", f, err)
+	}
+
+	// update fails on the replica: the primary index is used
+	if err := s.Update(); !errors.As(err, &mErr) || mErr.Op != "Update" {
+		t.Fatalf("wrong error: %v", err)
+	}
+	if len(s.Files().All()) != 1 {
+		t.Fatalf("wrong file count: %d", len(s.Files().All()))
+	}
+}
+
+func TestMirrorService_Failover(t *testing.T) {
+	data := make([]byte, 10*interf.SectorSize+3)
+	rand.New(rand.NewSource(1337)).Read(data)
+
+	// the primary connections die after 1000 bytes
+	primary := impl.NewFaultyService(impl.NewRamService(impl.NewCache(1), impl.DebugOff), impl.FaultPlan{
+		Cut:      impl.Fault{Probability: 1},
+		CutAfter: 1000,
+	}, impl.DebugOff)
+	replica := impl.NewRamService(nil, impl.DebugOff)
+	s := impl.NewMirrorService(primary, replica)
+
+	f, err := s.Save("test.dat", bytes.NewReader(data), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Update(); err != nil {
+		t.Fatal(err)
+	}
+
+	// reader
+	r, err := s.Reader(f, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(r)
+	_ = r.Close()
+	if err != nil || !bytes.Equal(b, data[10:]) {
+		t.Fatalf("read error: %v", err)
+	}
+
+	// ReaderAt
+	rAt, err := s.ReaderAt(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rAt.Close()
+	buf := make([]byte, 3*interf.SectorSize)
+	if n, err := rAt.ReadAt(buf, 5000); err != nil || !bytes.Equal(buf[:n], data[5000:5000+n]) {
+		t.Fatalf("ReadAt error: %v", err)
+	}
+
+	// no healthy copy: the original error
+	s = impl.NewMirrorService(primary)
+	f, _ = s.Save("test.dat", bytes.NewReader(data), 0)
+	r, err = s.Reader(f, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err = ioutil.ReadAll(r)
+	_ = r.Close()
+	if err != impl.ErrInjected || len(b) != 1000 {
+		t.Fatalf("wrong error: %v", err)
+	}
+}
+
+func TestMirrorService_DebugLvl(t *testing.T) {
+	_, inner := newFaultyTestData(t)
+
+	for _, lvl := range []uint8{impl.DebugOff, impl.DebugLow} {
+		s := impl.NewMirrorServiceWithOptions(lvl, nil, inner)
+		if err := s.Update(); err != nil {
+			t.Fatal(err)
+		}
+		if logs := readerAtLogs(t, s); strings.Contains(logs, "PrintStatAfterClose") != (lvl == impl.DebugLow) {
+			t.Fatalf("wrong logs with debug level %d: %s", lvl, logs)
+		}
+	}
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+
+func TestRace_MirrorService(t *testing.T) {
+	s := impl.NewMirrorService(impl.NewRamService(nil, impl.DebugOff), impl.NewDiskService(t.TempDir(), nil, impl.DebugOff))
+
+	var wg sync.WaitGroup
+	wg.Add(5)
+	for n := 0; n < 5; n++ {
+		go func() {
+			//------------------------------
+			for i := 0; i < 10; i++ {
+				f, errS := s.Save("race.dat", strings.NewReader("race"), 0)
+				errU := s.Update()
+				if errS != nil || errU != nil {
+					t.Fail()
+					break
+				}
+				r, err := s.Reader(f, 0)
+				if err != nil {
+					t.Fail()
+					break
+				}
+				_ = r.Close()
+			}
+			//------------------------------
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+
+	// all files must exist (and are merged)
+	if err := s.Update(); err != nil || len(s.Files().All()) != 50 {
+		t.Fatalf("wrong file count: %d, %v", len(s.Files().All()), err)
+	}
+}
@@ -1,6 +1,7 @@
 package impl
 
 import (
+	"context"
 	"crypto/md5"
 	"errors"
 	"fmt"
@@ -9,8 +10,9 @@ import (
 	"sync"
 )
 
-// interface check: interf.ReaderAt
+// interface check: interf.ReaderAt, interf.ContextReaderAt
 var _ interf.ReaderAt = (*_MReaderAt)(nil)
+var _ interf.ContextReaderAt = (*_MReaderAt)(nil)
 
 // @see interf.ReaderService
 // @see interf.ReaderAt
@@ -30,7 +32,8 @@ type _MReaderAt struct {
 // NewMultiReader combine two or more ReaderAt and behave like a normal ReaderAT for a single file.
 // All files except the last file must be the same size.
 // There must be at least two or more files!
-func NewMultiReaderAt(files []interf.File, service interf.ReaderService, cache interf.Cache, debugLvl uint8) (interf.ReaderAt, error) {
+// The options are optional (@see ReaderAtOption).
+func NewMultiReaderAt(files []interf.File, service interf.ReaderService, cache interf.Cache, debugLvl uint8, opts ...ReaderAtOption) (interf.ReaderAt, error) {
 	// ReaderAt statistic
 	stat := &_ReaderStat{
 		debugLvl:    debugLvl,       // enable debug logging [0, 1, 2] (level: high=2)
@@ -54,7 +57,7 @@ func NewMultiReaderAt(files []interf.File, service interf.ReaderService, cache i
 	h := md5.New()
 	readers := make([]interf.ReaderAt, len(files))
 	for i, f := range files {
-		r, err := NewReaderAt(f, service, cache, debugLvl)
+		r, err := NewReaderAt(f, service, cache, debugLvl, opts...)
 		if err != nil {
 			// error from NewReaderAt()
 			return nil, err
@@ -97,6 +100,11 @@ func (r *_MReaderAt) Close() error {
 
 // @see interf.ReaderAt
 func (r *_MReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	return r.ReadAtContext(context.Background(), p, off)
+}
+
+// @see interf.ContextReaderAt
+func (r *_MReaderAt) ReadAtContext(ctx context.Context, p []byte, off int64) (int, error) {
 	r.mux.RLock() // READ LOCK
 	defer r.mux.RUnlock()
 
@@ -120,7 +128,7 @@ func (r *_MReaderAt) ReadAt(p []byte, off int64) (int, error) {
 		// file No must exist
 		if fileNo < len(r.readers) {
 			// delegate to inner ReaderAt
-			n, err = r.readers[fileNo].ReadAt(p[read:], fileOff)
+			n, err = ReadAtContext(ctx, r.readers[fileNo], p[read:], fileOff)
 		} else {
 			// no file found
 			n, err = 0, io.EOF
@@ -0,0 +1,312 @@
+package impl
+
+import (
+	"errors"
+	"fmt"
+	interf "github.com/SchnorcherSepp/storage/interfaces"
+	"strings"
+	"time"
+)
+
+// MinSectorSize and MaxSectorSize are the limits of WithSectorSize.
+const (
+	MinSectorSize = 512             // 512 B
+	MaxSectorSize = 4 * 1024 * 1024 // 4 MiB
+)
+
+// ReaderAtOption configures NewReaderAt(), NewMultiReaderAt() and NewSubReaderAt()
+// (and the services NewRamService() and gdrive.NewGService() for their readers).
+// Without options, the behavior is unchanged (e.g. the cache key is the sector and the file id).
+// The defaults of the tuning options are the constants of the interf package (e.g. interf.SectorSize).
+// Invalid values and combinations are reported by the constructors.
+//
+// Example of use:
+//   rAt, err := impl.NewReaderAt(file, service, cache, impl.DebugOff,
+//       impl.WithCacheNamespace("s3-backup"), impl.WithContentVersion())
+type ReaderAtOption func(*_ReaderAtConfig)
+
+// _ReaderAtConfig holds the values of all ReaderAtOption.
+type _ReaderAtConfig struct {
+	namespace string       // cache key scope (@see WithCacheNamespace)
+	versioned bool         // cache key scope (@see WithContentVersion)
+	readAhead uint64       // read-ahead window in sectors (@see WithReadAhead)
+	retry     *RetryPolicy // nil = no retry (@see WithRetry)
+	verify    bool         // md5 verification (@see WithVerify)
+
+	sectorSize int64 // 0 = interf.SectorSize (@see WithSectorSize)
+	maxJump    int64 // -1 = interf.MaxSectorJump in bytes (@see WithMaxSectorJump)
+	maxReaders int   // 0 = interf.MaxReadersPerFile (@see WithMaxReaders)
+	expire     int   // seconds, 0 = default of the cache (@see WithCacheExpire)
+	err        error // first invalid value
+
+	idleTimeout time.Duration // 0 = disabled (@see WithIdleTimeout)
+}
+
+// WithCacheNamespace scopes all cache keys by the namespace (e.g. a name of the service).
+// Several services with overlapping file ids can share one cache. All service constructors accept
+// the options; the services invalidate only the sectors of their namespace (@see ScopedFileId).
+func WithCacheNamespace(namespace string) ReaderAtOption {
+	return func(c *_ReaderAtConfig) {
+		c.namespace = namespace
+	}
+}
+
+// WithContentVersion scopes all cache keys by the content version of the file (md5 or, if unknown, modTime and size).
+// A file whose content changes under the same id never serves old sectors.
+func WithContentVersion() ReaderAtOption {
+	return func(c *_ReaderAtConfig) {
+		c.versioned = true
+	}
+}
+
+// WithReadAhead enables the read-ahead: After sequential ReadAt() calls, the next 'sectors' sectors
+// are read into the cache in the background. Streaming consumers don't wait at every sector boundary.
+// The read-ahead needs a cache and stops with a random access, an error or Close().
+func WithReadAhead(sectors int) ReaderAtOption {
+	return func(c *_ReaderAtConfig) {
+		if sectors > 0 {
+			c.readAhead = uint64(sectors)
+		}
+	}
+}
+
+// WithVerify enables the md5 verification: the ReaderAt hashes the contiguous data read from offset 0.
+// Data read in any order are buffered until the gap before them is filled (max. 4 MB per ReaderAt).
+// The ReadAt() call that completes the whole file compares the hash with File.Md5() and returns a *ChecksumError
+// if they don't match (only once, the data are returned anyway). Files with an unknown md5 aren't verified.
+func WithVerify() ReaderAtOption {
+	return func(c *_ReaderAtConfig) {
+		c.verify = true
+	}
+}
+
+// WithSectorSize sets the size of a sector in bytes [MinSectorSize, MaxSectorSize].
+// A sector is the unit of the downloads and the cache entries: small sectors suit random access to
+// fast storage (e.g. a local disk), big sectors suit storage with a high latency.
+// A cache stores max. interf.SectorSize per entry, bigger sectors need cache=nil.
+// A sector size other than interf.SectorSize scopes the cache keys (like WithCacheNamespace).
+func WithSectorSize(bytes int) ReaderAtOption {
+	return func(c *_ReaderAtConfig) {
+		if bytes < MinSectorSize || bytes > MaxSectorSize {
+			c.setErr(fmt.Errorf("invalid sector size %d: must be in [%d, %d]", bytes, MinSectorSize, MaxSectorSize))
+			return
+		}
+		c.sectorSize = int64(bytes)
+	}
+}
+
+// WithMaxSectorJump sets how many sectors an open connection may skip (read and discard) to reach the
+// requested sector, instead of opening a new connection (@see interf.MaxSectorJump). 0 = never skip.
+// The default is interf.MaxSectorJump, converted to the sector size of WithSectorSize (50 MiB).
+func WithMaxSectorJump(sectors int) ReaderAtOption {
+	return func(c *_ReaderAtConfig) {
+		if sectors < 0 {
+			c.setErr(fmt.Errorf("invalid max. sector jump %d: must not be negative", sectors))
+			return
+		}
+		c.maxJump = int64(sectors)
+	}
+}
+
+// WithMaxReaders sets the max. number of connections per file (@see interf.MaxReadersPerFile).
+// This is also the max. number of parallel downloads of a ReaderAt.
+func WithMaxReaders(n int) ReaderAtOption {
+	return func(c *_ReaderAtConfig) {
+		if n < 1 {
+			c.setErr(fmt.Errorf("invalid max. readers %d: must be at least 1", n))
+			return
+		}
+		c.maxReaders = n
+	}
+}
+
+// WithCacheExpire sets the expiry of the cached sectors (@see interf.CacheExpireSeconds, min. 1 second).
+// The cache must support an individual expiry (@see ExpireCache).
+func WithCacheExpire(d time.Duration) ReaderAtOption {
+	return func(c *_ReaderAtConfig) {
+		if d < time.Second {
+			c.setErr(fmt.Errorf("invalid cache expire %v: must be at least 1s", d))
+			return
+		}
+		c.expire = int(d / time.Second)
+	}
+}
+
+// WithIdleTimeout closes connections that are unused for the duration d (based on the time of the last read).
+// A global background reaper checks all ReaderAt with an idle timeout (@see ReapIdleConns).
+// Without this option, idle connections stay open until Close() or until replaced by a new connection.
+// A ReaderAt is registered at the reaper only while it has idle connections: a ReaderAt without Close()
+// can be garbage collected after the reaper has closed its connections.
+func WithIdleTimeout(d time.Duration) ReaderAtOption {
+	return func(c *_ReaderAtConfig) {
+		if d <= 0 {
+			c.setErr(fmt.Errorf("invalid idle timeout %v: must be positive", d))
+			return
+		}
+		c.idleTimeout = d
+	}
+}
+
+// ExpireCache is an optional interface of interf.Cache for an individual expiry (@see WithCacheExpire).
+// Implemented by NewCache, NewLFUCache and the wrappers NewCompressedCache and NewLayeredCache
+// (if the inner caches implement it).
+type ExpireCache interface {
+
+	// SetExpire behaves like Set, but the value expires after expireSeconds (> 0).
+	SetExpire(fileId string, sector uint64, data []byte, expireSeconds int) error
+}
+
+// newReaderAtConfig applies all options.
+func newReaderAtConfig(opts []ReaderAtOption) *_ReaderAtConfig {
+	c := &_ReaderAtConfig{maxJump: -1}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(c)
+		}
+	}
+	return c
+}
+
+// setErr keeps the first invalid value.
+func (c *_ReaderAtConfig) setErr(err error) {
+	if c.err == nil {
+		c.err = err
+	}
+}
+
+// validate returns the first invalid value or an invalid combination of the options and the cache.
+func (c *_ReaderAtConfig) validate(cache interf.Cache) error {
+	if c.err != nil {
+		return c.err
+	}
+	if cache != nil && c.sector() > interf.SectorSize {
+		return fmt.Errorf("sector size %d: a cache stores max. %d bytes per sector, use cache=nil", c.sector(), interf.SectorSize)
+	}
+	if c.jump() > uint64(interf.MaxFileSize/c.sector()) {
+		return fmt.Errorf("max. sector jump %d: more than the max. file size", c.jump())
+	}
+	if c.expire > 0 && cache == nil {
+		return errors.New("cache expire without cache")
+	}
+	if c.expire > 0 && !canExpire(cache) {
+		return errors.New("cache expire: the cache doesn't support an individual expiry (@see ExpireCache)")
+	}
+	if c.readAhead > 0 && cache != nil && c.readAhead*uint64(c.sector()) > uint64(cache.Size()/2) {
+		return fmt.Errorf("read-ahead of %d sectors: more than half of the cache", c.readAhead)
+	}
+	return nil
+}
+
+// sector returns the sector size in bytes.
+func (c *_ReaderAtConfig) sector() int64 {
+	if c.sectorSize > 0 {
+		return c.sectorSize
+	}
+	return interf.SectorSize
+}
+
+// jump returns the max. sector jump in sectors.
+func (c *_ReaderAtConfig) jump() uint64 {
+	if c.maxJump >= 0 {
+		return uint64(c.maxJump)
+	}
+	return uint64(interf.MaxSectorJump * interf.SectorSize / c.sector())
+}
+
+// readers returns the max. number of connections per file.
+func (c *_ReaderAtConfig) readers() int {
+	if c.maxReaders > 0 {
+		return c.maxReaders
+	}
+	return interf.MaxReadersPerFile
+}
+
+// cacheId returns the file id for the cache (the scoped id).
+//
+// Format: <file id> [ 0x00 <namespace> 0x00 <version> [ 0x00 <sector size> ] ]
+// The file id is always the first part, so Cache.InvalidateFile(fileId) removes all scopes (@see cacheFileId)
+// and Cache.InvalidateFile(ScopedFileId(fileId, opts...)) all scopes of the namespace (@see cacheIdMatch).
+func (c *_ReaderAtConfig) cacheId(file interf.File) string {
+	sized := c.sector() != interf.SectorSize
+	if c.namespace == "" && !c.versioned && !sized {
+		return file.Id() // default: unscoped
+	}
+
+	version := ""
+	if c.versioned {
+		version = file.Md5()
+		if version == "" {
+			version = fmt.Sprintf("%d-%d", file.ModTime(), file.Size())
+		}
+	}
+	id := file.Id() + "\x00" + c.namespace + "\x00" + version
+	if sized {
+		id += fmt.Sprintf("\x00%d", c.sector()) // other sector numbers
+	}
+	return id
+}
+
+// ScopedFileId returns the file id for Cache.InvalidateFile (@see InvalidateChanged).
+// With WithCacheNamespace, only the sectors of the namespace are removed, so services that share a cache
+// don't remove the sectors of each other. Without a namespace, the file id is returned (all scopes).
+func ScopedFileId(fileId string, opts ...ReaderAtOption) string {
+	c := newReaderAtConfig(opts)
+	if c.namespace == "" {
+		return fileId
+	}
+	return fileId + "\x00" + c.namespace
+}
+
+// hasNamespace returns true if the options scope the cache keys by a namespace (@see WithCacheNamespace).
+func hasNamespace(opts []ReaderAtOption) bool {
+	return len(opts) > 0 && newReaderAtConfig(opts).namespace != ""
+}
+
+// cacheFileId returns the file id of a (scoped) cache id.
+func cacheFileId(cacheId string) string {
+	if i := strings.IndexByte(cacheId, 0); i >= 0 {
+		return cacheId[:i]
+	}
+	return cacheId
+}
+
+// cacheIdMatch returns true if the (scoped) cache id belongs to a file id of the set.
+// The set contains plain file ids (all scopes) and file ids with a namespace (@see ScopedFileId).
+func cacheIdMatch(cacheId string, fileIds map[string]bool) bool {
+	i := strings.IndexByte(cacheId, 0)
+	if i < 0 {
+		return fileIds[cacheId] // unscoped
+	}
+	if fileIds[cacheId[:i]] {
+		return true // file id
+	}
+	if j := strings.IndexByte(cacheId[i+1:], 0); j >= 0 {
+		return fileIds[cacheId[:i+1+j]] // file id and namespace
+	}
+	return false
+}
+
+// canExpire returns true if the cache supports an individual expiry (@see ExpireCache).
+// The wrappers support it if their inner caches do.
+func canExpire(cache interf.Cache) bool {
+	switch c := cache.(type) {
+	case *_CompressedCache:
+		return canExpire(c.inner)
+	case *_LayeredCache:
+		return canExpire(c.l1) && canExpire(c.l2)
+	default:
+		_, ok := cache.(ExpireCache)
+		return ok
+	}
+}
+
+// cacheSet stores the value with an individual expiry (expire > 0) or the default expiry of the cache (expire = 0).
+func cacheSet(cache interf.Cache, fileId string, sector uint64, data []byte, expire int) error {
+	if expire <= 0 {
+		return cache.Set(fileId, sector, data)
+	}
+	if ec, ok := cache.(ExpireCache); ok {
+		return ec.SetExpire(fileId, sector, data, expire)
+	}
+	return errors.New("the cache doesn't support an individual expiry (@see ExpireCache)")
+}
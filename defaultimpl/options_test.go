@@ -0,0 +1,421 @@
+package impl_test
+
+import (
+	"bytes"
+	impl "github.com/SchnorcherSepp/storage/defaultimpl"
+	interf "github.com/SchnorcherSepp/storage/interfaces"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWithCacheNamespace(t *testing.T) {
+	cache := impl.NewCache(0)
+
+	// two services with the same file id
+	dir1, dir2 := t.TempDir(), t.TempDir()
+	_ = ioutil.WriteFile(filepath.Join(dir1, "a.dat"), []byte("first"), 0600)
+	_ = ioutil.WriteFile(filepath.Join(dir2, "a.dat"), []byte("other"), 0600)
+	s1 := impl.NewDiskService(dir1, cache, impl.DebugOff)
+	s2 := impl.NewDiskService(dir2, cache, impl.DebugOff)
+	_, _ = s1.Update(), s2.Update()
+	f1, _ := s1.Files().ById("a.dat")
+	f2, _ := s2.Files().ById("a.dat")
+
+	// without namespace: collision
+	buf := make([]byte, 5)
+	rAt1, _ := impl.NewReaderAt(f1, s1, cache, impl.DebugOff)
+	_, _ = rAt1.ReadAt(buf, 0)
+	_ = rAt1.Close()
+	rAt2, _ := impl.NewReaderAt(f2, s2, cache, impl.DebugOff)
+	_, _ = rAt2.ReadAt(buf, 0)
+	_ = rAt2.Close()
+	if string(buf) != "first" {
+		t.Fatalf("no collision: %s", buf)
+	}
+
+	// with namespace
+	rAt2, _ = impl.NewReaderAt(f2, s2, cache, impl.DebugOff, impl.WithCacheNamespace("s2"))
+	_, _ = rAt2.ReadAt(buf, 0)
+	_ = rAt2.Close()
+	if string(buf) != "other" {
+		t.Fatalf("wrong data: %s", buf)
+	}
+
+	// InvalidateFile removes all scopes
+	if n := cache.InvalidateFile("a.dat"); n != 2 {
+		t.Fatalf("wrong count: %d", n)
+	}
+}
+
+func TestWithCacheNamespace_Services(t *testing.T) {
+	cache := impl.NewCache(0)
+
+	// two services with the same file id and their own namespace
+	dir1, dir2 := t.TempDir(), t.TempDir()
+	_ = ioutil.WriteFile(filepath.Join(dir1, "a.dat"), []byte("first"), 0600)
+	_ = ioutil.WriteFile(filepath.Join(dir2, "a.dat"), []byte("other"), 0600)
+	s1 := impl.NewDiskService(dir1, cache, impl.DebugOff, impl.WithCacheNamespace("s1"))
+	s2 := impl.NewSlowService(impl.NewDiskService(dir2, cache, impl.DebugOff), impl.SlowConfig{}, impl.DebugOff, impl.WithCacheNamespace("s2"))
+	_, _ = s1.Update(), s2.Update()
+
+	// read: no collision
+	for _, v := range []struct {
+		s    interf.Service
+		want string
+	}{{s1, "first"}, {s2, "other"}, {s1, "first"}} {
+		f, _ := v.s.Files().ById("a.dat")
+		rAt, _ := v.s.ReaderAt(f)
+		buf := make([]byte, 5)
+		_, _ = rAt.ReadAt(buf, 0)
+		_ = rAt.Close()
+		if string(buf) != v.want {
+			t.Fatalf("wrong data: %s", buf)
+		}
+	}
+	if st := cache.Stats(); st.Entries != 2 {
+		t.Fatalf("wrong stats: %+v", st)
+	}
+
+	// trash: only the sectors of the namespace
+	f1, _ := s1.Files().ById("a.dat")
+	if err := s1.Trash(f1); err != nil {
+		t.Fatal(err)
+	}
+	if st := cache.Stats(); st.Entries != 1 {
+		t.Fatalf("wrong stats: %+v", st)
+	}
+
+	// scoped file id
+	if id := impl.ScopedFileId("a.dat"); id != "a.dat" {
+		t.Fatalf("wrong id: %q", id)
+	}
+	if n := cache.InvalidateFile(impl.ScopedFileId("a.dat", impl.WithCacheNamespace("s2"))); n != 1 {
+		t.Fatalf("wrong count: %d", n)
+	}
+}
+
+func TestWithContentVersion(t *testing.T) {
+	cache := impl.NewCache(0)
+	s := impl.NewRamService(cache, impl.DebugOff)
+	f, _ := s.Save("a.dat", bytes.NewReader([]byte("first")), 0)
+
+	// fill the cache
+	buf := make([]byte, 5)
+	rAt, _ := impl.NewReaderAt(f, s, cache, impl.DebugOff, impl.WithContentVersion())
+	_, _ = rAt.ReadAt(buf, 0)
+	_ = rAt.Close()
+
+	// same version: cache hit
+	rAt, _ = impl.NewReaderAt(f, s, cache, impl.DebugOff, impl.WithContentVersion())
+	_, _ = rAt.ReadAt(buf, 0)
+	if rAt.Stat()["CacheHit"] != 1 {
+		t.Fatalf("no cache hit: %v", rAt.Stat())
+	}
+	_ = rAt.Close()
+
+	// new version (md5 and modTime/size): cache miss
+	for _, v := range []struct {
+		md5     string
+		modTime int64
+	}{{"other", f.ModTime()}, {"", f.ModTime()}, {"", f.ModTime() + 1}} {
+		nf := impl.NewFile(f.Id(), f.Name(), v.modTime, f.Size(), v.md5)
+		rAt, _ = impl.NewReaderAt(nf, s, cache, impl.DebugOff, impl.WithContentVersion(), nil)
+		_, _ = rAt.ReadAt(buf, 0)
+		if rAt.Stat()["CacheHit"] != 0 || string(buf) != "first" {
+			t.Fatalf("cache hit: %v", rAt.Stat())
+		}
+		_ = rAt.Close()
+	}
+
+	// stats: grouped by file id
+	if stats := impl.FullStats(cache); stats.Entries != 4 || stats.Files[f.Id()] != 4 {
+		t.Fatalf("wrong stats: %+v", stats)
+	}
+}
+
+func TestWithReadAhead(t *testing.T) {
+	data := make([]byte, 64*interf.SectorSize)
+	rand.New(rand.NewSource(1)).Read(data)
+	s := impl.NewRamService(nil, impl.DebugOff)
+	f, _ := s.Save("a.dat", bytes.NewReader(data), 0)
+	cache := impl.NewCache(0)
+
+	// sequential stream: 3 sectors in 4 kiB steps
+	rAt, _ := impl.NewReaderAt(f, s, cache, impl.DebugOff, impl.WithReadAhead(8))
+	buf := make([]byte, 4096)
+	for off := 0; off < 3*interf.SectorSize; off += len(buf) {
+		if n, err := rAt.ReadAt(buf, int64(off)); n != len(buf) || !bytes.Equal(buf, data[off:off+n]) {
+			t.Fatalf("read error: %v", err)
+		}
+	}
+
+	// the next 8 sectors are in the cache
+	waitFor(t, func() bool { return cache.Stats().Entries == 3+8 })
+	if _, err := cache.Get(f.Id(), 10, nil); err != nil {
+		t.Fatal("sector 10 not cached")
+	}
+	if rAt.Stat()["RAtAhead"] != 8 || rAt.Stat()["RAtAdd"] != 1 {
+		t.Fatalf("wrong stat: %v", rAt.Stat())
+	}
+
+	// the stream reads from the cache, the window moves
+	b := make([]byte, interf.SectorSize)
+	_, _ = rAt.ReadAt(b, 3*interf.SectorSize)
+	if !bytes.Equal(b, data[3*interf.SectorSize:4*interf.SectorSize]) || rAt.Stat()["CacheHit"] == 0 {
+		t.Fatalf("no cache hit: %v", rAt.Stat())
+	}
+	waitFor(t, func() bool { return cache.Stats().Entries == 4+8 })
+
+	// not behind the end of the file
+	ahead := rAt.Stat()["RAtAhead"]
+	for i := int64(61); i < 64; i++ {
+		_, _ = rAt.ReadAt(b, i*interf.SectorSize)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if rAt.Stat()["RAtAhead"] != ahead {
+		t.Fatalf("read-ahead behind the end: %v", rAt.Stat())
+	}
+	_ = rAt.Close()
+
+	// random access: no read-ahead
+	rAt, _ = impl.NewReaderAt(f, s, impl.NewCache(0), impl.DebugOff, impl.WithReadAhead(8))
+	for _, sector := range []int64{20, 5, 40, 30, 2} {
+		_, _ = rAt.ReadAt(b, sector*interf.SectorSize)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if rAt.Stat()["RAtAhead"] != 0 {
+		t.Fatalf("read-ahead with random access: %v", rAt.Stat())
+	}
+	_ = rAt.Close()
+
+	// without cache: disabled
+	rAt, _ = impl.NewReaderAt(f, s, nil, impl.DebugOff, impl.WithReadAhead(8))
+	for i := int64(0); i < 5; i++ {
+		_, _ = rAt.ReadAt(b, i*interf.SectorSize)
+	}
+	if rAt.Stat()["RAtAhead"] != 0 {
+		t.Fatalf("read-ahead without cache: %v", rAt.Stat())
+	}
+	_ = rAt.Close()
+}
+
+func TestWithSectorSize(t *testing.T) {
+	data, s := newFaultyTestData(t) // 10 sectors + 3 bytes
+	f := s.Files().All()[0]
+	cache := impl.NewCache(0)
+
+	// small sectors
+	rAt, err := impl.NewReaderAt(f, s, cache, impl.DebugOff, impl.WithSectorSize(4096))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, len(data))
+	if n, err := rAt.ReadAt(buf, 0); n != len(data) || err != nil || !bytes.Equal(buf, data) {
+		t.Fatalf("read error: %v", err)
+	}
+	b := make([]byte, 5000)
+	if n, err := rAt.ReadAt(b, 4000); n != len(b) || err != nil || !bytes.Equal(b, data[4000:9000]) {
+		t.Fatalf("read error: %v", err)
+	}
+	if st := rAt.Stat(); st["RAtAdd"] != 1 || cache.Stats().Entries != 41 {
+		t.Fatalf("wrong stat: %v, %+v", st, cache.Stats())
+	}
+	_ = rAt.Close()
+
+	// the default sector size doesn't use the small sectors
+	rAt, _ = impl.NewReaderAt(f, s, cache, impl.DebugOff)
+	if n, err := rAt.ReadAt(buf, 0); n != len(data) || err != nil || !bytes.Equal(buf, data) {
+		t.Fatalf("read error: %v", err)
+	}
+	if st := rAt.Stat(); st["RAtAdd"] != 1 || cache.Stats().Entries != 52 {
+		t.Fatalf("wrong stat: %v, %+v", st, cache.Stats())
+	}
+	_ = rAt.Close()
+
+	// big sectors without cache
+	rAt, err = impl.NewReaderAt(f, s, nil, impl.DebugOff, impl.WithSectorSize(impl.MaxSectorSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := rAt.ReadAt(b, 20000); n != len(b) || err != nil || !bytes.Equal(b, data[20000:25000]) {
+		t.Fatalf("read error: %v", err)
+	}
+	_ = rAt.Close()
+}
+
+func TestWithMaxSectorJump(t *testing.T) {
+	data, s := newFaultyTestData(t)
+	f := s.Files().All()[0]
+	b := make([]byte, 10)
+
+	for _, jump := range []int{0, 1} {
+		rAt, _ := impl.NewReaderAt(f, s, nil, impl.DebugOff, impl.WithMaxSectorJump(jump))
+		_, _ = rAt.ReadAt(b, 0)
+		if n, err := rAt.ReadAt(b, 2*interf.SectorSize); n != len(b) || err != nil || !bytes.Equal(b, data[2*interf.SectorSize:][:10]) {
+			t.Fatalf("read error: %v", err)
+		}
+		// jump 0: new connection, jump 1: skip sector 1
+		if st := rAt.Stat(); st["RAtAdd"] != uint64(2-jump) || st["RAtSectorSkip"] != uint64(jump) {
+			t.Fatalf("jump %d: wrong stat: %v", jump, st)
+		}
+		_ = rAt.Close()
+	}
+}
+
+func TestWithMaxReaders(t *testing.T) {
+	f := impl.NewFile("p", "p", 0, 2*interf.MaxSectorJump*interf.SectorSize, "")
+	s := new(patternService)
+	b := make([]byte, 10)
+
+	for _, max := range []int{1, interf.MaxReadersPerFile} {
+		rAt, _ := impl.NewReaderAt(f, s, nil, impl.DebugOff, impl.WithMaxReaders(max))
+		far := int64(interf.MaxSectorJump+100) * interf.SectorSize
+		_, _ = rAt.ReadAt(b, far)                   // connection 1
+		_, _ = rAt.ReadAt(b, 0)                     // connection 2 (can't read back)
+		_, _ = rAt.ReadAt(b, far+interf.SectorSize) // connection 1 (if still open)
+
+		want := uint64(2)
+		if max == 1 {
+			want = 3 // connection 1 was closed
+		}
+		if st := rAt.Stat(); st["RAtAdd"] != want {
+			t.Fatalf("max %d: wrong stat: %v", max, st)
+		}
+		_ = rAt.Close()
+	}
+}
+
+func TestWithCacheExpire(t *testing.T) {
+	data, s := newFaultyTestData(t)
+	f := s.Files().All()[0]
+	cache := impl.NewCompressedCache(impl.NewLFUCache(0))
+
+	rAt, err := impl.NewReaderAt(f, s, cache, impl.DebugOff, impl.WithCacheExpire(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rAt.Close()
+	if n, err := rAt.ReadAt(make([]byte, len(data)), 0); n != len(data) || err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	if _, err := cache.Get(f.Id(), 0, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// expired after 1 second
+	waitFor(t, func() bool {
+		_, err := cache.Get(f.Id(), 0, nil)
+		return err != nil
+	})
+}
+
+func TestReaderAtOption_Validate(t *testing.T) {
+	_, s := newFaultyTestData(t)
+	f := s.Files().All()[0]
+	ram := impl.NewCache(0)
+	disk, err := impl.NewDiskCache(t.TempDir(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	invalid := []struct {
+		cache interf.Cache
+		opt   impl.ReaderAtOption
+	}{
+		{nil, impl.WithSectorSize(impl.MinSectorSize - 1)},
+		{nil, impl.WithSectorSize(impl.MaxSectorSize + 1)},
+		{nil, impl.WithMaxSectorJump(-1)},
+		{nil, impl.WithMaxSectorJump(interf.MaxFileSize)},
+		{nil, impl.WithMaxReaders(0)},
+		{ram, impl.WithCacheExpire(time.Millisecond)},
+		{ram, impl.WithSectorSize(2 * interf.SectorSize)}, // too big for the cache
+		{nil, impl.WithCacheExpire(time.Hour)},            // no cache
+		{disk, impl.WithCacheExpire(time.Hour)},           // no ExpireCache
+		{impl.NewCompressedCache(disk), impl.WithCacheExpire(time.Hour)},
+		{impl.NewLayeredCache(ram, disk), impl.WithCacheExpire(time.Hour)},
+		{ram, impl.WithReadAhead(1000)}, // more than half of the cache
+	}
+	for i, v := range invalid {
+		if _, err := impl.NewReaderAt(f, s, v.cache, impl.DebugOff, v.opt); err == nil {
+			t.Fatalf("%d: no error", i)
+		}
+		if _, err := impl.NewSubReaderAt(f, s, v.cache, impl.DebugOff, 0, 10, v.opt); err == nil {
+			t.Fatalf("%d: no error", i)
+		}
+		if _, err := impl.NewMultiReaderAt([]interf.File{f, f}, s, v.cache, impl.DebugOff, v.opt); err == nil {
+			t.Fatalf("%d: no error", i)
+		}
+		if _, err := impl.NewRamService(v.cache, impl.DebugOff, v.opt).ReaderAt(f); err == nil {
+			t.Fatalf("%d: no error", i)
+		}
+		if v.cache != nil {
+			if _, err := impl.Prefetch(f, s, v.cache, 0, -1, 1, v.opt); err == nil {
+				t.Fatalf("%d: no error", i)
+			}
+		}
+	}
+
+	valid := []struct {
+		cache interf.Cache
+		opt   impl.ReaderAtOption
+	}{
+		{ram, impl.WithSectorSize(interf.SectorSize)},
+		{ram, impl.WithMaxSectorJump(0)},
+		{ram, impl.WithCacheExpire(time.Hour)},
+		{impl.NewLayeredCache(ram, impl.NewLFUCache(0)), impl.WithCacheExpire(time.Hour)},
+		{impl.NewCompressedCache(ram), impl.WithCacheExpire(time.Hour)},
+	}
+	for i, v := range valid {
+		rAt, err := impl.NewReaderAt(f, s, v.cache, impl.DebugOff, v.opt)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if _, err := rAt.ReadAt(make([]byte, 10), 0); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		_ = rAt.Close()
+	}
+}
+
+// waitFor polls the condition for max. 2 seconds.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	for i := 0; i < 200; i++ {
+		if cond() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("timeout")
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+
+func TestRace_ReadAhead(t *testing.T) {
+	data := make([]byte, 64*interf.SectorSize)
+	s := impl.NewRamService(nil, impl.DebugOff)
+	f, _ := s.Save("a.dat", bytes.NewReader(data), 0)
+	rAt, _ := impl.NewReaderAt(f, s, impl.NewCache(0), impl.DebugOff, impl.WithReadAhead(4))
+
+	var wg sync.WaitGroup
+	wg.Add(5)
+	for n := 0; n < 5; n++ {
+		go func(n int) {
+			//------------------------------
+			buf := make([]byte, 5000)
+			for off := n * 1000; off < len(data); off += len(buf) {
+				if _, err := rAt.ReadAt(buf, int64(off)); err != nil && off+len(buf) < len(data) {
+					t.Fail()
+				}
+			}
+			//------------------------------
+			wg.Done()
+		}(n)
+	}
+	wg.Wait()
+	_ = rAt.Close()
+}
@@ -0,0 +1,193 @@
+package impl
+
+import (
+	"errors"
+	interf "github.com/SchnorcherSepp/storage/interfaces"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrPrefetchCanceled is returned by PrefetchHandle.Wait() after PrefetchHandle.Cancel().
+var ErrPrefetchCanceled = errors.New("prefetch canceled")
+
+// PrefetchHandle controls a running prefetch (@see Prefetch).
+type PrefetchHandle interface {
+
+	// Wait blocks until the prefetch is finished or canceled.
+	// Returns the first error, ErrPrefetchCanceled or nil.
+	Wait() error
+
+	// Cancel stops the prefetch. The running sector downloads are completed.
+	// Has no effect after the first call or if the prefetch is already finished.
+	Cancel()
+
+	// Done is closed when the prefetch is finished or canceled.
+	Done() <-chan struct{}
+
+	// Bytes returns the number of bytes in the cache so far.
+	Bytes() int64
+}
+
+// interface check: PrefetchHandle
+var _ PrefetchHandle = (*_Prefetch)(nil)
+
+// _Prefetch is the handle of a running prefetch.
+type _Prefetch struct {
+	wg     *sync.WaitGroup // running workers
+	done   chan struct{}   // closed after wg
+	cancel chan struct{}   // closed by Cancel()
+	once   *sync.Once      // protect 'cancel'
+	bytes  int64           // atomic
+	early  int32           // atomic, 1 = a worker was stopped by Cancel()
+
+	mux *sync.Mutex // protect 'err'
+	err error       // first error
+}
+
+// Prefetch downloads the range [off, off+n) of the file in the background into the cache.
+// A later ReadAt() of this range needs no connection. If n < 0, the range ends at the end of the file.
+// The range is divided into 'workers' contiguous parts with their own connection (min. 1).
+// Sectors already in the cache aren't downloaded again.
+// Use the same ReaderAtOption as the ReaderAt that will read the data (the cache keys must match).
+//
+// Example of use:
+//   h, err := impl.Prefetch(file, service, cache, 0, -1, 4)
+//   ...
+//   err = h.Wait()
+func Prefetch(file interf.File, service interf.ReaderService, cache interf.Cache, off, n int64, workers int, opts ...ReaderAtOption) (PrefetchHandle, error) {
+	// check input
+	if file == nil || service == nil || cache == nil {
+		return nil, errors.New("can't prefetch with file=nil, service=nil or cache=nil")
+	}
+	if off < 0 {
+		return nil, errors.New("negative offset")
+	}
+	conf := newReaderAtConfig(opts)
+	if err := conf.validate(cache); err != nil {
+		return nil, err
+	}
+	if workers < 1 {
+		workers = 1
+	}
+
+	// range in sectors
+	size := conf.sector()
+	end := file.Size()
+	if n >= 0 && off+n < end {
+		end = off + n
+	}
+	first := off / size
+	last := (end + size - 1) / size // exclusive
+	sectors := last - first
+	if end <= off {
+		sectors = 0 // nothing to do
+	}
+	if int64(workers) > sectors {
+		workers = int(sectors)
+	}
+
+	p := &_Prefetch{
+		wg:     new(sync.WaitGroup),
+		done:   make(chan struct{}),
+		cancel: make(chan struct{}),
+		once:   new(sync.Once),
+		mux:    new(sync.Mutex),
+	}
+
+	// start workers
+	for i := 0; i < workers; i++ {
+		from := first + sectors*int64(i)/int64(workers)
+		to := first + sectors*int64(i+1)/int64(workers)
+		p.wg.Add(1)
+		go p.worker(file, service, cache, from, to, size, opts)
+	}
+	go func() {
+		p.wg.Wait()
+		close(p.done)
+	}()
+	return p, nil
+}
+
+// @see PrefetchHandle
+func (p *_Prefetch) Wait() error {
+	<-p.done
+
+	p.mux.Lock() // LOCK
+	defer p.mux.Unlock()
+
+	if p.err != nil {
+		return p.err
+	}
+	if atomic.LoadInt32(&p.early) == 1 {
+		return ErrPrefetchCanceled
+	}
+	return nil
+}
+
+// @see PrefetchHandle
+func (p *_Prefetch) Cancel() {
+	p.once.Do(func() {
+		close(p.cancel)
+	})
+}
+
+// @see PrefetchHandle
+func (p *_Prefetch) Done() <-chan struct{} {
+	return p.done
+}
+
+// @see PrefetchHandle
+func (p *_Prefetch) Bytes() int64 {
+	return atomic.LoadInt64(&p.bytes)
+}
+
+//--------  HELPER  --------------------------------------------------------------------------------------------------//
+
+// worker reads the sectors [from, to) with its own ReaderAt (the ReaderAt fills the cache).
+func (p *_Prefetch) worker(file interf.File, service interf.ReaderService, cache interf.Cache, from, to, size int64, opts []ReaderAtOption) {
+	defer p.wg.Done()
+
+	rAt, err := NewReaderAt(file, service, cache, DebugOff, opts...)
+	if err != nil {
+		p.setErr(err)
+		return
+	}
+	defer rAt.Close()
+
+	buf := cache.Pool().Get()
+	defer cache.Pool().Put(buf)
+
+	for sector := from; sector < to; sector++ {
+		if p.canceled() {
+			atomic.StoreInt32(&p.early, 1)
+			return
+		}
+		n, err := rAt.ReadAt(buf[:size], sector*size)
+		atomic.AddInt64(&p.bytes, int64(n))
+		if err != nil && err != io.EOF {
+			p.setErr(err)
+			return
+		}
+	}
+}
+
+// canceled returns true after Cancel().
+func (p *_Prefetch) canceled() bool {
+	select {
+	case <-p.cancel:
+		return true
+	default:
+		return false
+	}
+}
+
+// setErr stores the first error and stops all workers.
+func (p *_Prefetch) setErr(err error) {
+	p.mux.Lock() // LOCK
+	if p.err == nil {
+		p.err = err
+	}
+	p.mux.Unlock() // UNLOCK
+	p.Cancel()
+}
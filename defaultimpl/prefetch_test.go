@@ -0,0 +1,133 @@
+package impl_test
+
+import (
+	"bytes"
+	impl "github.com/SchnorcherSepp/storage/defaultimpl"
+	interf "github.com/SchnorcherSepp/storage/interfaces"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPrefetch(t *testing.T) {
+	data, s := newFaultyTestData(t) // 11 sectors
+	f := s.Files().All()[0]
+	cache := impl.NewCache(0)
+
+	// whole file
+	h, err := impl.Prefetch(f, s, cache, 0, -1, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if h.Bytes() != int64(len(data)) || impl.FullStats(cache).Files[f.Id()] != 11 {
+		t.Fatalf("wrong prefetch: %d bytes, %+v", h.Bytes(), impl.FullStats(cache))
+	}
+	select {
+	case <-h.Done():
+	default:
+		t.Fatal("not done")
+	}
+	h.Cancel() // no effect
+	if err := h.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	// read without connection
+	rAt, _ := impl.NewReaderAt(f, s, cache, impl.DebugOff)
+	b := make([]byte, len(data))
+	if n, err := rAt.ReadAt(b, 0); n != len(data) || !bytes.Equal(b, data) {
+		t.Fatalf("read error: %v", err)
+	}
+	if rAt.Stat()["RAtAdd"] != 0 {
+		t.Fatalf("wrong stat: %v", rAt.Stat())
+	}
+	_ = rAt.Close()
+
+	// range with namespace
+	h, _ = impl.Prefetch(f, s, cache, interf.SectorSize+1, interf.SectorSize, 8, impl.WithCacheNamespace("ns"))
+	if err := h.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if stats := cache.Stats(); stats.Entries != 13 || h.Bytes() != 2*interf.SectorSize {
+		t.Fatalf("wrong range: %d bytes, %+v", h.Bytes(), stats)
+	}
+
+	// empty range
+	h, _ = impl.Prefetch(f, s, cache, int64(len(data)), 100, 1)
+	if err := h.Wait(); err != nil || h.Bytes() != 0 {
+		t.Fatalf("wrong empty range: %v", err)
+	}
+
+	// invalid input
+	if _, err := impl.Prefetch(f, s, nil, 0, -1, 1); err == nil {
+		t.Fatal("no error without cache")
+	}
+	if _, err := impl.Prefetch(f, s, cache, -1, -1, 1); err == nil {
+		t.Fatal("no error with negative offset")
+	}
+}
+
+func TestPrefetch_Cancel(t *testing.T) {
+	_, inner := newFaultyTestData(t)
+	f := inner.Files().All()[0]
+	cache := impl.NewCache(0)
+
+	// 50 ms per sector
+	s := impl.NewSlowService(inner, impl.SlowConfig{ConnBandwidth: 20 * interf.SectorSize}, impl.DebugOff)
+	h, _ := impl.Prefetch(f, s, cache, 0, -1, 1)
+	time.Sleep(75 * time.Millisecond)
+	h.Cancel()
+	h.Cancel() // no effect
+
+	if err := h.Wait(); err != impl.ErrPrefetchCanceled {
+		t.Fatalf("wrong error: %v", err)
+	}
+	if n := cache.Stats().Entries; n < 1 || n > 5 {
+		t.Fatalf("wrong number of sectors: %d", n)
+	}
+}
+
+func TestPrefetch_Error(t *testing.T) {
+	_, inner := newFaultyTestData(t)
+	f := inner.Files().All()[0]
+
+	s := impl.NewFaultyService(inner, impl.FaultPlan{Open: impl.Fault{Probability: 1}}, impl.DebugOff)
+	h, _ := impl.Prefetch(f, s, impl.NewCache(0), 0, -1, 2)
+	if err := h.Wait(); err != impl.ErrInjected {
+		t.Fatalf("wrong error: %v", err)
+	}
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+
+func TestRace_Prefetch(t *testing.T) {
+	_, s := newFaultyTestData(t)
+	f := s.Files().All()[0]
+	cache := impl.NewCache(0)
+
+	var wg sync.WaitGroup
+	wg.Add(5)
+	for n := 0; n < 5; n++ {
+		go func() {
+			//------------------------------
+			for i := 0; i < 20; i++ {
+				h, err := impl.Prefetch(f, s, cache, 0, -1, 4)
+				if err != nil {
+					t.Fail()
+					continue
+				}
+				if i%2 == 0 {
+					h.Cancel()
+				}
+				_ = h.Wait()
+				_ = h.Bytes()
+			}
+			//------------------------------
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+}
@@ -2,6 +2,7 @@ package impl
 
 import (
 	"bytes"
+	"context"
 	"crypto/md5"
 	"crypto/rand"
 	"encoding/base64"
@@ -16,8 +17,9 @@ import (
 	"time"
 )
 
-// interface check: interf.Service
+// interface check: interf.Service, interf.ContextService
 var _ interf.Service = (*_RamService)(nil)
+var _ interf.ContextService = (*_RamService)(nil)
 
 // @see interf.Service
 //
@@ -29,11 +31,14 @@ type _RamService struct {
 	files    interf.Files
 	data     map[string][]byte
 	mux      *sync.RWMutex
+	opts     []ReaderAtOption // for ReaderAt() and MultiReaderAt()
 }
 
 // NewRamService return the RAM implementation of interf.Service.
 // The data are only in RAM. This implementation is mainly for testing.
-func NewRamService(cache interf.Cache, debugLvl uint8) interf.Service {
+// The state can be saved with Snapshot() and restored with LoadRamService() (@see Snapshotter).
+// The options are used for ReaderAt() and MultiReaderAt() (@see ReaderAtOption).
+func NewRamService(cache interf.Cache, debugLvl uint8, opts ...ReaderAtOption) interf.Service {
 	return &_RamService{
 		cache:    cache,
 		debugLvl: debugLvl,
@@ -41,6 +46,7 @@ func NewRamService(cache interf.Cache, debugLvl uint8) interf.Service {
 		files:    NewFiles(nil),
 		data:     make(map[string][]byte),
 		mux:      new(sync.RWMutex),
+		opts:     opts,
 	}
 }
 
@@ -50,6 +56,7 @@ func (s *_RamService) Update() error {
 	s.mux.Lock() // WRITE Lock
 	defer s.mux.Unlock()
 
+	InvalidateChanged(s.cache, s.files, s.hidden, s.opts...) // remove stale sectors
 	s.files = s.hidden
 	return nil
 }
@@ -128,6 +135,10 @@ func (s *_RamService) Trash(file interf.File) error {
 	delete(byId, file.Id())
 	s.hidden = NewFiles(byId)
 
+	// remove stale sectors
+	if s.cache != nil {
+		s.cache.InvalidateFile(ScopedFileId(file.Id(), s.opts...))
+	}
 	return nil
 }
 
@@ -162,7 +173,7 @@ func (s *_RamService) LimitedReader(file interf.File, off int64, n int64) (io.Re
 }
 
 func (s *_RamService) ReaderAt(file interf.File) (interf.ReaderAt, error) {
-	return NewReaderAt(file, s, s.cache, s.debugLvl)
+	return NewReaderAt(file, s, s.cache, s.debugLvl, s.opts...)
 }
 
 func (s *_RamService) MultiReaderAt(list []interf.File) (interf.ReaderAt, error) {
@@ -171,7 +182,7 @@ func (s *_RamService) MultiReaderAt(list []interf.File) (interf.ReaderAt, error)
 		return s.ReaderAt(list[0])
 	} else {
 		// MultiReaderAt
-		return NewMultiReaderAt(list, s, s.cache, s.debugLvl)
+		return NewMultiReaderAt(list, s, s.cache, s.debugLvl, s.opts...)
 	}
 }
 
@@ -199,3 +210,35 @@ func genId() string {
 
 	return "1pl-" + s[0:14] + "-" + s[14:28]
 }
+
+//-----------  IMPLEMENTATION:  @see interf.ContextService  ----------------------------------------------------------//
+
+// UpdateContext behaves like Update (the RAM update can't hang).
+func (s *_RamService) UpdateContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.Update()
+}
+
+// SaveContext behaves like Save, but the cancellation of ctx aborts the copy of r.
+func (s *_RamService) SaveContext(ctx context.Context, name string, r io.Reader, max int64) (interf.File, error) {
+	return s.Save(name, NewContextSource(ctx, r), max)
+}
+
+// ReaderContext behaves like Reader, but the cancellation of ctx closes the reader.
+func (s *_RamService) ReaderContext(ctx context.Context, file interf.File, off int64) (io.ReadCloser, error) {
+	return s.LimitedReaderContext(ctx, file, off, 0)
+}
+
+// LimitedReaderContext behaves like LimitedReader, but the cancellation of ctx closes the reader.
+func (s *_RamService) LimitedReaderContext(ctx context.Context, file interf.File, off int64, n int64) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r, err := s.LimitedReader(file, off, n)
+	if err != nil {
+		return nil, err
+	}
+	return NewContextReader(ctx, r), nil
+}
@@ -0,0 +1,149 @@
+package impl
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	interf "github.com/SchnorcherSepp/storage/interfaces"
+	"io"
+	"sync"
+)
+
+// Snapshotter is implemented by services that can write their complete state to a stream.
+// The RAM service (@see NewRamService) implements this interface, the snapshot can be loaded with LoadRamService().
+//
+// Example of use:
+//   s := impl.NewRamService(cache, impl.DebugOff)
+//   _ = impl.InitDemo(s)
+//   err := s.(impl.Snapshotter).Snapshot(fh)
+type Snapshotter interface {
+
+	// Snapshot writes all files (visible and hidden index) and all data to w.
+	// This method is thread-safe.
+	Snapshot(w io.Writer) error
+}
+
+// interface check: Snapshotter
+var _ Snapshotter = (*_RamService)(nil)
+
+// ramSnapshotVersion identifies the snapshot format.
+const ramSnapshotVersion = "impl/RamService/1"
+
+// _RamSnapshot is the header of a snapshot. The data blobs follow in the order of DataIds.
+type _RamSnapshot struct {
+	Version string
+	Hidden  []_SnapshotFile // all saved files (visible after the next Update())
+	Files   []_SnapshotFile // visible files (state of the last Update())
+	DataIds []string
+}
+
+// _SnapshotFile is a helper with exported attributes for serialization.
+type _SnapshotFile struct {
+	Id      string
+	Name    string
+	ModTime int64
+	Size    int64
+	Md5     string
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+
+// Snapshot writes all files (visible and hidden index) and all data to w.
+// The format is a gob stream: a header followed by one message per data blob.
+// This method is thread-safe.
+func (s *_RamService) Snapshot(w io.Writer) error {
+	s.mux.RLock() // READ Lock
+	defer s.mux.RUnlock()
+
+	// header
+	snap := _RamSnapshot{
+		Version: ramSnapshotVersion,
+		Hidden:  toSnapshotFiles(s.hidden),
+		Files:   toSnapshotFiles(s.files),
+		DataIds: make([]string, 0, len(s.data)),
+	}
+	for id := range s.data {
+		snap.DataIds = append(snap.DataIds, id)
+	}
+
+	enc := gob.NewEncoder(w)
+	if err := enc.Encode(snap); err != nil {
+		return err
+	}
+
+	// data blobs (one message per blob)
+	for _, id := range snap.DataIds {
+		if err := enc.Encode(s.data[id]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadRamService reads a snapshot (@see Snapshotter) and returns the RAM implementation of interf.Service
+// with the restored state. The options are used for ReaderAt() and MultiReaderAt() (@see ReaderAtOption).
+func LoadRamService(r io.Reader, cache interf.Cache, debugLvl uint8, opts ...ReaderAtOption) (interf.Service, error) {
+	if r == nil {
+		return nil, errors.New("nil reader")
+	}
+	dec := gob.NewDecoder(r)
+
+	// header
+	snap := new(_RamSnapshot)
+	if err := dec.Decode(snap); err != nil {
+		return nil, err
+	}
+	if snap.Version != ramSnapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version '%s'", snap.Version)
+	}
+
+	// data blobs
+	data := make(map[string][]byte, len(snap.DataIds))
+	for _, id := range snap.DataIds {
+		var b []byte
+		if err := dec.Decode(&b); err != nil {
+			return nil, err
+		}
+		if b == nil {
+			b = make([]byte, 0) // gob doesn't transmit empty slices
+		}
+		data[id] = b
+	}
+
+	return &_RamService{
+		cache:    cache,
+		debugLvl: debugLvl,
+		hidden:   fromSnapshotFiles(snap.Hidden),
+		files:    fromSnapshotFiles(snap.Files),
+		data:     data,
+		mux:      new(sync.RWMutex),
+		opts:     opts,
+	}, nil
+}
+
+//--------  Helper  --------------------------------------------------------------------------------------------------//
+
+// toSnapshotFiles converts interf.Files for serialization.
+func toSnapshotFiles(files interf.Files) []_SnapshotFile {
+	all := files.All()
+	list := make([]_SnapshotFile, 0, len(all))
+	for _, f := range all {
+		list = append(list, _SnapshotFile{
+			Id:      f.Id(),
+			Name:    f.Name(),
+			ModTime: f.ModTime(),
+			Size:    f.Size(),
+			Md5:     f.Md5(),
+		})
+	}
+	return list
+}
+
+// fromSnapshotFiles converts the serialized files back to interf.Files.
+func fromSnapshotFiles(list []_SnapshotFile) interf.Files {
+	byId := make(map[string]interf.File, len(list))
+	for _, v := range list {
+		byId[v.Id] = NewFile(v.Id, v.Name, v.ModTime, v.Size, v.Md5)
+	}
+	return NewFiles(byId)
+}
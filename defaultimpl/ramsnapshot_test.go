@@ -0,0 +1,133 @@
+package impl_test
+
+import (
+	"bytes"
+	impl "github.com/SchnorcherSepp/storage/defaultimpl"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRamService_Snapshot(t *testing.T) {
+	s := impl.NewRamService(nil, impl.DebugOff)
+
+	// visible, hidden, trashed and empty files
+	f1, err := s.Save("visible.dat", strings.NewReader("Test Bytes Foo Bar"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f2, err := s.Save("trashed.dat", strings.NewReader("trash"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f3, err := s.Save("empty.dat", strings.NewReader(""), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = s.Update()
+	if err := s.Trash(f2); err != nil {
+		t.Fatal(err)
+	}
+	f4, err := s.Save("hidden.dat", strings.NewReader("hidden"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// snapshot
+	buf := new(bytes.Buffer)
+	if err := s.(impl.Snapshotter).Snapshot(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// load
+	l, err := impl.LoadRamService(buf, impl.NewCache(1), impl.DebugOff)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// visible list: state of the last Update()
+	if len(l.Files().All()) != 3 {
+		t.Fatalf("wrong visible file count: %d", len(l.Files().All()))
+	}
+	if f, err := l.Files().ById(f1.Id()); err != nil || f.Name() != "visible.dat" || f.Size() != 18 || f.Md5() != f1.Md5() || f.ModTime() != f1.ModTime() {
+		t.Fatalf("wrong file: %v", err)
+	}
+	if _, err := l.Files().ById(f4.Id()); err == nil {
+		t.Fatal("hidden file is visible")
+	}
+
+	// data
+	r, err := l.Reader(f1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(r)
+	_ = r.Close()
+	if string(b) != "Test Bytes Foo Bar" {
+		t.Fatalf("wrong data: %s", b)
+	}
+	if f, err := l.Files().ById(f3.Id()); err != nil || f.Size() != 0 {
+		t.Fatalf("wrong empty file: %v", err)
+	}
+
+	// hidden list: visible after Update()
+	_ = l.Update()
+	if len(l.Files().All()) != 3 {
+		t.Fatalf("wrong file count: %d", len(l.Files().All()))
+	}
+	if _, err := l.Files().ById(f2.Id()); err == nil {
+		t.Fatal("trashed file is visible")
+	}
+	rAt, err := l.ReaderAt(f4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rAt.Close()
+	b = make([]byte, 6)
+	if n, _ := rAt.ReadAt(b, 0); n != 6 || string(b) != "hidden" {
+		t.Fatalf("wrong data: %s", b)
+	}
+}
+
+func TestLoadRamService_Invalid(t *testing.T) {
+	if _, err := impl.LoadRamService(nil, nil, impl.DebugOff); err == nil {
+		t.Fatal("no error with nil reader")
+	}
+	if _, err := impl.LoadRamService(strings.NewReader("no snapshot"), nil, impl.DebugOff); err == nil {
+		t.Fatal("no error with invalid data")
+	}
+
+	// truncated snapshot
+	s := impl.NewRamService(nil, impl.DebugOff)
+	_, _ = s.Save("a.dat", strings.NewReader("Test Bytes Foo Bar"), 0)
+	buf := new(bytes.Buffer)
+	_ = s.(impl.Snapshotter).Snapshot(buf)
+	if _, err := impl.LoadRamService(bytes.NewReader(buf.Bytes()[:buf.Len()-5]), nil, impl.DebugOff); err == nil {
+		t.Fatal("no error with truncated snapshot")
+	}
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+
+func TestRace_RamService_Snapshot(t *testing.T) {
+	s := impl.NewRamService(nil, impl.DebugOff)
+
+	var wg sync.WaitGroup
+	wg.Add(5)
+	for n := 0; n < 5; n++ {
+		go func() {
+			//------------------------------
+			for i := 0; i < 10; i++ {
+				_, _ = s.Save("race.dat", strings.NewReader("race"), 0)
+				_ = s.Update()
+				if err := s.(impl.Snapshotter).Snapshot(ioutil.Discard); err != nil {
+					t.Fail()
+				}
+			}
+			//------------------------------
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+}
@@ -1,6 +1,7 @@
 package impl
 
 import (
+	"context"
 	"errors"
 	interf "github.com/SchnorcherSepp/storage/interfaces"
 	"github.com/oxtoacart/bpool"
@@ -11,8 +12,9 @@ import (
 	"time"
 )
 
-// interface check: interf.ReaderAt
+// interface check: interf.ReaderAt, interf.ContextReaderAt
 var _ interf.ReaderAt = (*_ReaderAt)(nil)
+var _ interf.ContextReaderAt = (*_ReaderAt)(nil)
 
 // @see interf.ReaderAt
 //
@@ -20,26 +22,60 @@ var _ interf.ReaderAt = (*_ReaderAt)(nil)
 // A cache must be used internally for random read access.
 // It may also be necessary to open several internal connections to the storage.
 type _ReaderAt struct {
-	mux   *sync.Mutex  // protect 'inner'
-	inner []*_Reader   // open connections to the file (backbone)
-	stat  *_ReaderStat // collects statistical data about internal processes
+	mux   *sync.Mutex         // protect 'inner', 'busy', 'opening' and the read-ahead state
+	cond  *sync.Cond          // signals a returned connection (L = mux)
+	inner []*_Reader          // open idle connections to the file (backbone)
+	busy  map[*_Reader]uint64 // checked out connections and the requested sector (not in 'inner')
+	stat  *_ReaderStat        // collects statistical data about internal processes
+
+	opening int // number of connections being opened
+
+	file      interf.File          // for new connections
+	service   interf.ReaderService // storage Service (for new connections)
+	cache     interf.Cache         // for caching sectors, can be nil !
+	cacheId   string               // the (scoped) file id for the cache (@see ReaderAtOption)
+	pool      *bpool.BytePool      // the byte pool avoids allocating memory
+	readAhead uint64               // read-ahead window in sectors, 0 = disabled (@see WithReadAhead)
+	retry     *RetryPolicy         // retry of failed sector reads, nil = disabled (@see WithRetry)
+
+	sectorSize int64      // bytes per sector (@see WithSectorSize)
+	maxJump    uint64     // max. skipped sectors of a connection (@see WithMaxSectorJump)
+	expire     int        // expiry of the cached sectors in seconds, 0 = default of the cache (@see WithCacheExpire)
+	verify     *_Verifier // md5 verification, nil = disabled (@see WithVerify)
+
+	idleTimeout time.Duration // close idle connections, 0 = disabled (@see WithIdleTimeout)
+	reaped      bool          // registered at the reaper (only with idle connections)
+
+	// read-ahead state
+	closed    bool   // no read-ahead and no idle connections after Close()
+	seqNext   uint64 // first sector of the next sequential ReadAt()
+	seqCount  int    // number of sequential ReadAt() calls in a row
+	aheadNext uint64 // next sector of the read-ahead
+	aheadEnd  uint64 // end of the read-ahead window (exclusive)
+	aheadRun  bool   // the read-ahead goroutine is running
+}
 
-	file    interf.File          // for new connections
-	service interf.ReaderService // storage Service (for new connections)
-	cache   interf.Cache         // for caching sectors, can be nil !
-	pool    *bpool.BytePool      // the byte pool avoids allocating memory
+// readAheadTrigger is the number of sequential ReadAt() calls that start the read-ahead.
+const readAheadTrigger = 2
 
-}
+// maxBusyWait is the max. distance (in sectors) to a busy connection, to wait for it instead of opening a new one.
+const maxBusyWait = 16
 
 // NewReaderAt creates a new interf.ReaderAt object for random read access to the file.
 // No connections are made before the first call of ReadAt().
 // Is cache = nil, the cache is disabled.
-func NewReaderAt(file interf.File, service interf.ReaderService, cache interf.Cache, debugLvl uint8) (interf.ReaderAt, error) {
+// Parallel ReadAt() calls use parallel connections (max. interf.MaxReadersPerFile, @see WithMaxReaders).
+// The options are optional (@see ReaderAtOption).
+func NewReaderAt(file interf.File, service interf.ReaderService, cache interf.Cache, debugLvl uint8, opts ...ReaderAtOption) (interf.ReaderAt, error) {
 	// check input
 	// the cache can be nil!
 	if file == nil || service == nil {
 		return nil, errors.New("can't create new ReaderAt with file=nil or service=nil")
 	}
+	conf := newReaderAtConfig(opts)
+	if err := conf.validate(cache); err != nil {
+		return nil, err
+	}
 
 	// ReaderAt statistic
 	stat := &_ReaderStat{
@@ -53,21 +89,41 @@ func NewReaderAt(file interf.File, service interf.ReaderService, cache interf.Ca
 	if cache != nil {
 		pool = cache.Pool()
 	} else {
-		pool = bpool.NewBytePool(25, interf.SectorSize)
+		pool = bpool.NewBytePool(25, int(conf.sector()))
+	}
+
+	// md5 verification (optional)
+	var verify *_Verifier
+	if conf.verify {
+		verify = newVerifier(file)
 	}
 
 	// return new ReaderAt
 	stat.RAtNew(file.Id(), cache != nil) // DEBUG
-	return &_ReaderAt{
-		mux:   new(sync.Mutex),
-		inner: make([]*_Reader, interf.MaxReadersPerFile),
+	mux := new(sync.Mutex)
+	r := &_ReaderAt{
+		mux:   mux,
+		cond:  sync.NewCond(mux),
+		inner: make([]*_Reader, conf.readers()),
+		busy:  make(map[*_Reader]uint64),
 		stat:  stat,
 
-		file:    file,
-		service: service,
-		cache:   cache,
-		pool:    pool,
-	}, nil
+		file:      file,
+		service:   service,
+		cache:     cache,
+		cacheId:   conf.cacheId(file),
+		pool:      pool,
+		readAhead: conf.readAhead,
+		retry:     conf.retry,
+
+		sectorSize: conf.sector(),
+		maxJump:    conf.jump(),
+		expire:     conf.expire,
+		verify:     verify,
+
+		idleTimeout: conf.idleTimeout,
+	}
+	return r, nil
 }
 
 // @see interf.ReaderAt
@@ -76,6 +132,11 @@ func (r *_ReaderAt) Close() error {
 	defer r.mux.Unlock()
 
 	r.stat.RAtClosing(r.file.Id()) // DEBUG
+	r.closed = true                // stop read-ahead
+	if r.reaped {
+		reaper.remove(r)
+		r.reaped = false
+	}
 	if r.inner != nil {
 		for i, v := range r.inner {
 			if v != nil {
@@ -85,6 +146,9 @@ func (r *_ReaderAt) Close() error {
 			}
 		}
 	}
+	for c := range r.busy {
+		c.drop = true // closed after use
+	}
 
 	r.stat.PrintStatAfterClose(r.file.Id()) // DEBUG
 	return nil
@@ -92,22 +156,36 @@ func (r *_ReaderAt) Close() error {
 
 // @see interf.ReaderAt
 func (r *_ReaderAt) ReadAt(p []byte, off int64) (n int, err error) {
+	return r.ReadAtContext(context.Background(), p, off)
+}
+
+// @see interf.ContextReaderAt
+//
+// ReadAtContext behaves like ReadAt, but the cancellation of ctx aborts the read.
+// A connection that is reading during the cancellation is closed.
+func (r *_ReaderAt) ReadAtContext(ctx context.Context, p []byte, off int64) (n int, err error) {
 	if len(p) == 0 {
 		return 0, nil // read nothing -> return nothing
 	}
 
 	// buffer from pool
-	buf := r.pool.Get()
-	defer r.pool.Put(buf)
+	pBuf := r.pool.Get()
+	defer r.pool.Put(pBuf)
+	buf := pBuf[:r.sectorSize]
 
 	// read sectors
 	sector, innerOff := r.calcSector(off)
 	read := 0
 
 	r.stat.RAtReq(r.file.Id(), off, len(p), sector, innerOff) // DEBUG
+	w := newWatcher(ctx, r.wake)                              // one watcher for all sectors
+	defer w.stopWatch()
+	if off >= 0 {
+		r.detectSequential(sector, uint64(off+int64(len(p))-1)/uint64(r.sectorSize)) // read-ahead
+	}
 	for {
 		// read sector
-		b, err := r.getSector(buf, sector) // thread-safe
+		b, err := r.getSector(w, buf, sector) // thread-safe
 
 		// cut inner offset
 		if len(b) < innerOff {
@@ -131,6 +209,15 @@ func (r *_ReaderAt) ReadAt(p []byte, off int64) (n int, err error) {
 			if err == io.EOF && len(p) == read && n > 0 {
 				err = nil // a full buffer with data is never io.EOF
 			}
+			// ... verify the md5 hash (optional)
+			if r.verify != nil && read > 0 && off >= 0 {
+				if errV := r.verify.write(p[:read], off); errV != nil {
+					r.stat.RAtVerify(r.file.Id(), errV) // DEBUG
+					if errV != errVerified && (err == nil || err == io.EOF) {
+						err = errV
+					}
+				}
+			}
 			// write debug and return
 			r.stat.RAtRet(r.file.Id(), off, len(p), read, err) // DEBUG
 			return read, err
@@ -150,32 +237,121 @@ func (r *_ReaderAt) Stat() map[string]uint64 {
 //--------  HELPER  --------------------------------------------------------------------------------------------------//
 
 // getSector returns the requested sector.
-// This method doesn't allocate memory when the capacity of buf is greater or equal to value (see SectorSize).
-func (r *_ReaderAt) getSector(buf []byte, sector uint64) ([]byte, error) {
-	r.mux.Lock() // LOCK
-	defer r.mux.Unlock()
+// This method doesn't allocate memory when the capacity of buf is greater or equal to value (see WithSectorSize).
+func (r *_ReaderAt) getSector(w *_Watcher, buf []byte, sector uint64) ([]byte, error) {
+	return r.readSector(w, buf, sector, false)
+}
 
-	// ask cache
-	if r.cache != nil {
-		b, err := r.cache.Get(r.file.Id(), sector, buf)
-		r.stat.CacheGet(r.file.Id(), sector, len(buf), len(b), err) // DEBUG
-		if err == nil {
-			return b, nil
+// readSector returns the requested sector (@see trySector).
+// With a RetryPolicy, failed attempts are repeated with a new connection at the failed sector.
+func (r *_ReaderAt) readSector(w *_Watcher, buf []byte, sector uint64, ahead bool) ([]byte, error) {
+	for attempt := 1; ; attempt++ {
+		b, err := r.trySector(w, buf, sector, ahead)
+		if err == nil || r.retry == nil || !r.retry.retryable(err) {
+			return b, err
+		}
+		if attempt >= r.retry.MaxAttempts {
+			r.stat.RAtRetryFail(r.file.Id(), sector, attempt, err) // DEBUG
+			return b, err
+		}
+		r.stat.RAtRetry(r.file.Id(), sector, attempt, err) // DEBUG
+		if errW := r.retry.wait(w.ctx, attempt); errW != nil {
+			return buf[:0], errW // canceled
 		}
 	}
+}
+
+// trySector returns the requested sector from the cache or a connection.
+// The connection is checked out: the download runs without the lock, so parallel calls use parallel connections.
+// A read-ahead (ahead=true) stops after Close() with io.ErrClosedPipe.
+func (r *_ReaderAt) trySector(w *_Watcher, buf []byte, sector uint64, ahead bool) ([]byte, error) {
+	ctx := w.ctx
+	var c *_Reader
+	for c == nil {
+		if err := ctx.Err(); err != nil {
+			return buf[:0], err // canceled
+		}
+
+		// ask cache
+		if r.cache != nil {
+			b, err := r.cache.Get(r.cacheId, sector, buf)
+			r.stat.CacheGet(r.file.Id(), sector, len(buf), len(b), err) // DEBUG
+			if err == nil {
+				return b, nil
+			}
+		}
+
+		r.mux.Lock() // LOCK
+		if ahead && r.closed {
+			r.mux.Unlock() // UNLOCK
+			return buf[:0], io.ErrClosedPipe
+		}
 
-	// Get best connection
-	c := r.bestConn(sector)
-	if c == nil {
-		// no reader found, create new one
-		var err error
-		c, err = r.addConn(sector)
+		// Get best connection
+		c = r.bestConn(sector)
+		if c == nil && r.mustWait(sector) {
+			if err := ctx.Err(); err != nil {
+				r.mux.Unlock()      // UNLOCK
+				return buf[:0], err // canceled (the watcher can't wake up a call that isn't waiting yet)
+			}
+			w.waiting()    // wake up on cancellation
+			r.cond.Wait()  // a busy connection can read the sector soon or all connections are busy
+			r.mux.Unlock() // UNLOCK
+			continue       // ask cache again
+		}
+		if c != nil {
+			r.checkout(c, sector)
+			r.mux.Unlock() // UNLOCK
+			break
+		}
+		r.closeOldest() // keep max. connections (@see WithMaxReaders)
+		r.opening++
+		r.mux.Unlock() // UNLOCK
+
+		// no reader found, create new one (without lock)
+		inner, err := openAsync(ctx, func() (io.ReadCloser, error) {
+			return r.service.Reader(r.file, int64(sector)*r.sectorSize) // not bound to ctx (reuse)
+		})
+		r.stat.RAtAdd(r.file.Id(), sector, err) // DEBUG
+
+		r.mux.Lock() // LOCK
+		r.opening--
 		if err != nil {
 			// only if service.Reader() fail
+			r.cond.Broadcast()
+			r.mux.Unlock() // UNLOCK
 			return buf[:0], err
 		}
+		c = newInnerReader(inner, sector)
+		c.drop = r.closed // Close() was called during the opening
+		r.busy[c] = sector
+		r.mux.Unlock() // UNLOCK
 	}
 
+	// return the connection after use
+	defer r.checkin(c)
+
+	// read (the cancellation of ctx closes the connection)
+	w.watch(c.c)
+	b, err := r.readConn(c, buf, sector)
+	if w.unwatch() {
+		_ = c.Close() // closed by ctx
+		if err != nil {
+			return buf[:0], ctx.Err()
+		}
+	}
+	return b, err
+}
+
+// wake wakes up all waiting calls (e.g. after a cancellation, @see _Watcher).
+func (r *_ReaderAt) wake() {
+	r.mux.Lock() // LOCK
+	r.cond.Broadcast()
+	r.mux.Unlock() // UNLOCK
+}
+
+// readConn reads the sector with the checked out connection. Skipped sectors are cached.
+func (r *_ReaderAt) readConn(c *_Reader, buf []byte, sector uint64) ([]byte, error) {
 	// check reader distance (off == reqOff?)
 	for c.sector < sector {
 		logSector := c.sector
@@ -183,8 +359,8 @@ func (r *_ReaderAt) getSector(buf []byte, sector uint64) ([]byte, error) {
 		r.stat.RAtSectorSkip(r.file.Id(), logSector, n, err) // DEBUG
 
 		if r.cache != nil && n > 0 && (err == nil || err == io.EOF) {
-			errSet := r.cache.Set(r.file.Id(), c.sector-1, buf[:n])        // don't waste VALID data
-			r.stat.CacheSet(r.file.Id(), c.sector-1, len(buf[:n]), errSet) // DEBUG
+			errSet := cacheSet(r.cache, r.cacheId, c.sector-1, buf[:n], r.expire) // don't waste VALID data
+			r.stat.CacheSet(r.file.Id(), c.sector-1, len(buf[:n]), errSet)        // DEBUG
 		}
 
 		if err != nil {
@@ -204,13 +380,147 @@ func (r *_ReaderAt) getSector(buf []byte, sector uint64) ([]byte, error) {
 
 	// cache
 	if r.cache != nil && n > 0 && (err == nil || err == io.EOF) {
-		errSet := r.cache.Set(r.file.Id(), c.sector-1, buf[:n])
+		errSet := cacheSet(r.cache, r.cacheId, c.sector-1, buf[:n], r.expire)
 		r.stat.CacheSet(r.file.Id(), c.sector-1, len(buf[:n]), errSet) // DEBUG
 	}
 
 	return buf[:n], err
 }
 
+// mustWait returns true if a busy connection can read the sector soon or if no more connections are allowed.
+// The caller must hold the lock.
+func (r *_ReaderAt) mustWait(sector uint64) bool {
+	if len(r.busy)+r.opening >= len(r.inner) {
+		return true // max. connections
+	}
+	for _, s := range r.busy {
+		if sector >= s && sector <= s+maxBusyWait {
+			return true
+		}
+	}
+	return false
+}
+
+// closeOldest closes the oldest idle connection if the max. number of connections is reached.
+// The caller must hold the lock.
+func (r *_ReaderAt) closeOldest() {
+	idle := 0
+	for _, v := range r.inner {
+		if v != nil {
+			idle++
+		}
+	}
+	if idle+len(r.busy)+r.opening < len(r.inner) {
+		return // ok
+	}
+
+	r.sortByAge()
+	for i := len(r.inner) - 1; i >= 0; i-- {
+		if r.inner[i] != nil {
+			_ = r.inner[i].Close()
+			r.inner[i] = nil
+			return
+		}
+	}
+}
+
+// checkout removes the connection from the list of idle connections. The caller must hold the lock.
+func (r *_ReaderAt) checkout(c *_Reader, sector uint64) {
+	for i, v := range r.inner {
+		if v == c {
+			r.inner[i] = nil
+		}
+	}
+	r.busy[c] = sector
+}
+
+// checkin returns a checked out connection to the list of idle connections (@see addConn).
+// Broken connections and connections of a closed ReaderAt are closed.
+func (r *_ReaderAt) checkin(c *_Reader) {
+	r.mux.Lock() // LOCK
+	defer r.mux.Unlock()
+
+	delete(r.busy, c)
+	if c.drop || c.c == nil || r.closed {
+		_ = c.Close()
+	} else {
+		r.addConn(c)
+		if r.idleTimeout > 0 && !r.reaped {
+			reaper.add(r) // close idle connections (@see WithIdleTimeout)
+			r.reaped = true
+		}
+	}
+	r.cond.Broadcast()
+}
+
+// detectSequential starts the read-ahead after sequential ReadAt() calls (@see WithReadAhead).
+// first and last are the sectors of the current ReadAt() call.
+func (r *_ReaderAt) detectSequential(first, last uint64) {
+	if r.readAhead == 0 || r.cache == nil {
+		return // disabled
+	}
+
+	r.mux.Lock() // LOCK
+	defer r.mux.Unlock()
+
+	// pattern: the next sector or the rest of the last sector
+	if first == r.seqNext || first+1 == r.seqNext {
+		r.seqCount++
+	} else {
+		r.seqCount = 0
+		r.aheadNext, r.aheadEnd = 0, 0 // stop the old window
+	}
+	r.seqNext = last + 1
+	if r.seqCount < readAheadTrigger || r.closed {
+		return
+	}
+
+	// move the window (not behind the end of the file)
+	if r.aheadNext < last+1 {
+		r.aheadNext = last + 1
+	}
+	r.aheadEnd = last + 1 + r.readAhead
+	if sectors := uint64((r.file.Size() + r.sectorSize - 1) / r.sectorSize); r.aheadEnd > sectors {
+		r.aheadEnd = sectors
+	}
+
+	// start
+	if !r.aheadRun && r.aheadNext < r.aheadEnd {
+		r.aheadRun = true
+		go r.readAheadLoop()
+	}
+}
+
+// readAheadLoop reads the sectors of the read-ahead window into the cache.
+// The loop ends at the end of the window, with an error or after Close().
+func (r *_ReaderAt) readAheadLoop() {
+	pBuf := r.pool.Get()
+	defer r.pool.Put(pBuf)
+	buf := pBuf[:r.sectorSize]
+	w := newWatcher(context.Background(), r.wake) // never canceled: no goroutine
+
+	for {
+		r.mux.Lock() // LOCK
+		if r.closed || r.aheadNext >= r.aheadEnd {
+			r.aheadRun = false
+			r.mux.Unlock() // UNLOCK
+			return
+		}
+		sector := r.aheadNext
+		r.aheadNext++
+		r.mux.Unlock() // UNLOCK
+
+		b, err := r.readSector(w, buf, sector, true)      // the sector is cached
+		r.stat.RAtAhead(r.file.Id(), sector, len(b), err) // DEBUG
+		if err != nil {
+			r.mux.Lock() // LOCK
+			r.aheadRun = false
+			r.mux.Unlock() // UNLOCK
+			return
+		}
+	}
+}
+
 // bestConn looks for an open connection that can be reused. Returns nil if no valid connection was found.
 // Attention: The returned connection does not have to exactly match the desired sector.
 func (r *_ReaderAt) bestConn(sector uint64) *_Reader {
@@ -224,7 +534,7 @@ func (r *_ReaderAt) bestConn(sector uint64) *_Reader {
 			continue
 		}
 		// skip: reqOff is before the position (can't read back) or too far away
-		if sector < v.sector || sector > v.sector+interf.MaxSectorJump {
+		if sector < v.sector || sector > v.sector+r.maxJump {
 			continue
 		}
 		// calc distance
@@ -272,9 +582,9 @@ func (r *_ReaderAt) sortByAge() {
 	})
 }
 
-// addConn opens a new reader/connection and places it first in the internal list.
+// addConn places the connection first in the internal list.
 // The oldest connection is closed.
-func (r *_ReaderAt) addConn(sector uint64) (*_Reader, error) {
+func (r *_ReaderAt) addConn(c *_Reader) {
 
 	// sort
 	r.sortByAge()
@@ -289,21 +599,34 @@ func (r *_ReaderAt) addConn(sector uint64) (*_Reader, error) {
 	for i := len(r.inner) - 1; i > 0; i-- {
 		r.inner[i] = r.inner[i-1]
 	}
-	r.inner[0] = nil
-
-	// create new connection
-	inner, err := r.service.Reader(r.file, int64(sector*interf.SectorSize))
-	r.stat.RAtAdd(r.file.Id(), sector, err) // DEBUG
+	r.inner[0] = c
+}
 
-	if err != nil {
-		// service.Reader() error
-		return nil, err
+// reapIdle closes the idle connections that are unused longer than the idle timeout (@see WithIdleTimeout).
+// Checked out connections aren't idle. Returns the number of closed connections.
+// The ReaderAt is unregistered from the reaper without idle connections (registered again by checkin).
+func (r *_ReaderAt) reapIdle(now int64) int {
+	r.mux.Lock() // LOCK
+	defer r.mux.Unlock()
 
-	} else {
-		// OK! Set connection and return
-		r.inner[0] = newInnerReader(inner, sector)
-		return r.inner[0], err
+	n := 0
+	idle := 0
+	for i, v := range r.inner {
+		if v != nil && v.c != nil && now-v.age > int64(r.idleTimeout) {
+			r.stat.RAtIdleClose(r.file.Id(), i, time.Duration(now-v.age)) // DEBUG
+			_ = v.Close()
+			r.inner[i] = nil
+			n++
+		}
+		if r.inner[i] != nil {
+			idle++
+		}
+	}
+	if idle == 0 && r.reaped {
+		reaper.remove(r)
+		r.reaped = false
 	}
+	return n
 }
 
 // calcSector calculates in which sector the first byte begins with a inner offset.
@@ -312,8 +635,8 @@ func (r *_ReaderAt) addConn(sector uint64) (*_Reader, error) {
 func (r *_ReaderAt) calcSector(offset int64) (sector uint64, innerOff int) {
 	if offset >= 0 {
 		// valid offset -> calc stuff
-		innerOff = int(offset % interf.SectorSize)
-		sector = uint64(offset-int64(innerOff)) / interf.SectorSize
+		innerOff = int(offset % r.sectorSize)
+		sector = uint64(offset-int64(innerOff)) / uint64(r.sectorSize)
 		return
 
 	} else {
@@ -332,6 +655,7 @@ type _Reader struct {
 	c      io.ReadCloser // connection to google drive (can be nil)
 	sector uint64        // position (sector number) for next read
 	age    int64         // time of last use (unix nano)
+	drop   bool          // close after checkin (@see _ReaderAt.Close)
 }
 
 // newInnerReader initialized a new _Reader. sector is the start sector (offset)
@@ -353,8 +677,8 @@ func (r *_Reader) Close() error {
 	return nil
 }
 
-// Read reads exactly len(buf) bytes from r into buf. If the given buffer is not exactly the
-// sector size, an error is returned. When Read encounters an error or end-of-file condition
+// Read reads exactly len(buf) bytes from r into buf (the buffer has the sector size, @see WithSectorSize).
+// If the given buffer is empty, an error is returned. When Read encounters an error or end-of-file condition
 // after successfully reading n > 0 bytes, it returns the number of bytes read AND the
 // (non-nil) error from the same call. Callers should always process the n > 0 bytes returned
 // before considering the error err.
@@ -364,12 +688,12 @@ func (r *_Reader) Read(buf []byte) (n int, err error) {
 		return 0, io.ErrClosedPipe
 	}
 	// check buffer size
-	if len(buf) != interf.SectorSize {
+	if len(buf) == 0 {
 		return 0, errors.New("wrong buffer size for reading a sector")
 	}
 
 	// read all: leave the loop with full buffer or an error
-	for n < interf.SectorSize && err == nil {
+	for n < len(buf) && err == nil {
 		var nn int
 		nn, err = r.c.Read(buf[n:])
 		n += nn
@@ -382,7 +706,7 @@ func (r *_Reader) Read(buf []byte) (n int, err error) {
 	}
 
 	// buffer is full, everything is fine
-	if n >= interf.SectorSize {
+	if n >= len(buf) {
 		return n, nil // ignore any errors that may have occurred
 	}
 
@@ -1,18 +1,23 @@
 package impl
 
 import (
+	"context"
 	interf "github.com/SchnorcherSepp/storage/interfaces"
 	"github.com/oxtoacart/bpool"
 	"io/ioutil"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func Test_bestConn(t *testing.T) {
 	r := _ReaderAt{
-		inner: make([]*_Reader, interf.MaxReadersPerFile),
-		stat:  new(_ReaderStat),
-		file:  NewFile("fileId", "name.file", 1234, 5678, "x0x0x0x0x0x0x0"),
+		inner:   make([]*_Reader, interf.MaxReadersPerFile),
+		stat:    new(_ReaderStat),
+		file:    NewFile("fileId", "name.file", 1234, 5678, "x0x0x0x0x0x0x0"),
+		maxJump: interf.MaxSectorJump,
 	}
 
 	r.inner[0] = newInnerReader(ioutil.NopCloser(nil), 22000) // 3
@@ -89,12 +94,18 @@ func Test_addConn(t *testing.T) {
 		pool:    bpool.NewBytePool(25, interf.SectorSize),
 	}
 
-	for i := 0; i < interf.MaxReadersPerFile; i++ {
-		// new
-		c, err := r.addConn(uint64(i))
+	newConn := func(sector uint64) *_Reader {
+		inner, err := s.Reader(f, int64(sector*interf.SectorSize))
 		if err != nil {
 			t.Errorf("%v", err)
 		}
+		return newInnerReader(inner, sector)
+	}
+
+	for i := 0; i < interf.MaxReadersPerFile; i++ {
+		// new
+		c := newConn(uint64(i))
+		r.addConn(c)
 
 		// check return
 		if c != r.inner[0] {
@@ -124,10 +135,7 @@ func Test_addConn(t *testing.T) {
 	}
 
 	// add new reader to full list
-	_, err = r.addConn(uint64(99))
-	if err != nil {
-		t.Errorf("%v", err)
-	}
+	r.addConn(newConn(99))
 	last := len(r.inner) - 1
 	if r.inner[last].sector != 1 || r.inner[0].sector != 99 {
 		t.Errorf("final error")
@@ -165,7 +173,7 @@ func Test_sortByAge(t *testing.T) {
 }
 
 func Test_calcSector(t *testing.T) {
-	r := _ReaderAt{}
+	r := _ReaderAt{sectorSize: interf.SectorSize}
 
 	// test 1
 	for sector := 0; sector < 50; sector++ {
@@ -188,3 +196,105 @@ func Test_calcSector(t *testing.T) {
 		t.Fatalf("invalid args test fail")
 	}
 }
+
+func Test_watcher(t *testing.T) {
+	var woken int32
+	wake := func() { atomic.AddInt32(&woken, 1) }
+
+	// never canceled: no goroutine
+	w := newWatcher(context.Background(), wake)
+	w.waiting()
+	w.watch(ioutil.NopCloser(nil))
+	if w.unwatch() || w.started {
+		t.Fatal("watcher started without cancellation")
+	}
+	w.stopWatch()
+
+	// lazy start: not before the first wait or read
+	ctx, cancel := context.WithCancel(context.Background())
+	w = newWatcher(ctx, wake)
+	if w.started {
+		t.Fatal("started too early")
+	}
+	w.watch(ioutil.NopCloser(nil))
+	if w.unwatch() || !w.started {
+		t.Fatal("not started")
+	}
+	stop := w.stop
+	w.watch(ioutil.NopCloser(nil))
+	if w.unwatch() || w.stop != stop {
+		t.Fatal("second goroutine")
+	}
+
+	// cancellation closes the connection in use and wakes up
+	c := &closeCounter{}
+	w.watch(c)
+	cancel()
+	for atomic.LoadInt32(&woken) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if !w.unwatch() || atomic.LoadInt32(&c.n) != 1 {
+		t.Fatal("connection not closed")
+	}
+
+	// a connection after the cancellation is closed immediately
+	c = &closeCounter{}
+	w.watch(c)
+	if !w.unwatch() || atomic.LoadInt32(&c.n) != 1 {
+		t.Fatal("connection not closed")
+	}
+	w.stopWatch()
+}
+
+// closeCounter counts the Close() calls.
+type closeCounter struct {
+	n int32
+}
+
+func (c *closeCounter) Close() error {
+	atomic.AddInt32(&c.n, 1)
+	return nil
+}
+
+func Test_reaper(t *testing.T) {
+	s := NewRamService(nil, DebugOff)
+	f, _ := s.Save("a.dat", strings.NewReader(strings.Repeat("data", interf.SectorSize)), 0) // the connection stays open
+	rAt, err := NewReaderAt(f, s, nil, DebugOff, WithIdleTimeout(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := rAt.(*_ReaderAt)
+	registered := func() bool {
+		reaper.mux.Lock()
+		defer reaper.mux.Unlock()
+		_, ok := reaper.readers[r]
+		return ok
+	}
+
+	// registered only with idle connections
+	if registered() {
+		t.Fatal("registered without connections")
+	}
+	_, _ = rAt.ReadAt(make([]byte, 4), 0)
+	reaper.mux.Lock()
+	running := reaper.running
+	reaper.mux.Unlock()
+	if !registered() || !running {
+		t.Fatal("not registered")
+	}
+
+	// unregistered after reaping
+	if r.reapIdle(time.Now().Add(2*time.Hour).UnixNano()) != 1 || registered() {
+		t.Fatal("still registered after reaping")
+	}
+
+	// unregistered after Close
+	_, _ = rAt.ReadAt(make([]byte, 4), 0)
+	if !registered() {
+		t.Fatal("not registered")
+	}
+	_ = rAt.Close()
+	if registered() {
+		t.Fatal("still registered")
+	}
+}
@@ -4,9 +4,12 @@ import (
 	impl "github.com/SchnorcherSepp/storage/defaultimpl"
 	interf "github.com/SchnorcherSepp/storage/interfaces"
 	"io"
+	"io/ioutil"
 	"log"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestNewReaderAt(t *testing.T) {
@@ -273,6 +276,108 @@ func Test_ReaderAt_ReadAt_EOF_Bug(t *testing.T) {
 
 //--------------------------------------------------------------------------------------------------------------------//
 
+func TestReaderAt_Parallel(t *testing.T) {
+	// 4 regions, too far apart for one connection
+	const regions, sectors = 4, 8
+	dist := int64(interf.MaxSectorJump+100) * interf.SectorSize
+	f := impl.NewFile("id", "pattern.dat", 0, regions*dist, "")
+	s := impl.NewSlowReaderService(new(patternService), impl.SlowConfig{
+		OpenLatency:   10 * time.Millisecond,
+		ConnBandwidth: 20 * interf.SectorSize, // 50 ms per sector
+	})
+
+	// readRegion reads all sectors of the region k sequentially
+	readRegion := func(rAt interf.ReaderAt, k int64) {
+		buf := make([]byte, interf.SectorSize)
+		for i := int64(0); i < sectors; i++ {
+			off := k*dist + i*interf.SectorSize
+			n, err := rAt.ReadAt(buf, off)
+			if n != len(buf) || err != nil || buf[0] != byte(off) || buf[n-1] != byte(off+int64(n)-1) {
+				t.Errorf("read error at %d: %v", off, err)
+			}
+		}
+	}
+
+	// serial
+	rAt, _ := impl.NewReaderAt(f, s, nil, impl.DebugOff)
+	start := time.Now()
+	for k := int64(0); k < regions; k++ {
+		readRegion(rAt, k)
+	}
+	serial := time.Since(start)
+	_ = rAt.Close()
+
+	// parallel: one connection per region
+	rAt, _ = impl.NewReaderAt(f, s, nil, impl.DebugOff)
+	start = time.Now()
+	var wg sync.WaitGroup
+	wg.Add(regions)
+	for k := int64(0); k < regions; k++ {
+		go func(k int64) {
+			readRegion(rAt, k)
+			wg.Done()
+		}(k)
+	}
+	wg.Wait()
+	parallel := time.Since(start)
+
+	if rAt.Stat()["RAtAdd"] != regions {
+		t.Fatalf("wrong stat: %v", rAt.Stat())
+	}
+	if parallel > serial/2 {
+		t.Fatalf("no parallel connections: serial=%v, parallel=%v", serial, parallel)
+	}
+	_ = rAt.Close()
+}
+
+func TestReaderAt_WaitForBusyConn(t *testing.T) {
+	f := impl.NewFile("id", "pattern.dat", 0, 100*interf.SectorSize, "")
+	s := impl.NewSlowReaderService(new(patternService), impl.SlowConfig{ConnBandwidth: 20 * interf.SectorSize})
+	rAt, _ := impl.NewReaderAt(f, s, impl.NewCache(0), impl.DebugOff)
+
+	// the same sector: one download
+	var wg sync.WaitGroup
+	wg.Add(5)
+	for n := 0; n < 5; n++ {
+		go func() {
+			if _, err := rAt.ReadAt(make([]byte, 10), 5); err != nil {
+				t.Error(err)
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+	if m := rAt.Stat(); m["RAtAdd"] != 1 || m["RAtSectorRet"] != 1 {
+		t.Fatalf("wrong stat: %v", m)
+	}
+	_ = rAt.Close()
+}
+
+func TestReaderAt_CloseWhileReading(t *testing.T) {
+	f := impl.NewFile("id", "pattern.dat", 0, 100*interf.SectorSize, "")
+	s := &countService{inner: impl.NewSlowReaderService(new(patternService), impl.SlowConfig{
+		OpenLatency:   50 * time.Millisecond,
+		ConnBandwidth: 20 * interf.SectorSize, // 50 ms per sector
+	})}
+
+	// Close() during the opening and during the download
+	for _, delay := range []time.Duration{10 * time.Millisecond, 70 * time.Millisecond} {
+		rAt, _ := impl.NewReaderAt(f, s, nil, impl.DebugOff)
+		done := make(chan struct{})
+		go func() {
+			_, _ = rAt.ReadAt(make([]byte, 10), 0)
+			close(done)
+		}()
+		time.Sleep(delay)
+		_ = rAt.Close()
+		<-done
+
+		if o, c := s.count(); o != c {
+			t.Fatalf("%v: connection not closed: opened=%d, closed=%d", delay, o, c)
+		}
+	}
+}
+
 func TestRace_ReaderAt(t *testing.T) {
 	f, s, _ := initTestFileAndTestService(t)
 
@@ -381,3 +486,69 @@ func (ts *testStat) Check(s string) {
 		ts.t.Errorf("%s: RAtAddErr: should=%d, is=%d", s, ts.RAtAddErr, m["RAtAddErr"])
 	}
 }
+
+// patternService is a interf.ReaderService for files of any size. The byte at offset off is byte(off).
+type patternService struct{}
+
+func (s *patternService) Reader(file interf.File, off int64) (io.ReadCloser, error) {
+	return s.LimitedReader(file, off, file.Size()-off)
+}
+
+func (s *patternService) LimitedReader(file interf.File, off int64, n int64) (io.ReadCloser, error) {
+	return ioutil.NopCloser(&patternReader{off: off, end: off + n}), nil
+}
+
+type patternReader struct {
+	off, end int64
+}
+
+func (r *patternReader) Read(p []byte) (int, error) {
+	if r.off >= r.end {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > r.end-r.off {
+		p = p[:r.end-r.off]
+	}
+	for i := range p {
+		p[i] = byte(r.off + int64(i))
+	}
+	r.off += int64(len(p))
+	return len(p), nil
+}
+
+// countService is a interf.ReaderService decorator that counts the opened and closed connections.
+type countService struct {
+	inner interf.ReaderService
+	open  int32 // atomic
+	close int32 // atomic
+}
+
+func (s *countService) Reader(file interf.File, off int64) (io.ReadCloser, error) {
+	return s.LimitedReader(file, off, file.Size()-off)
+}
+
+func (s *countService) LimitedReader(file interf.File, off int64, n int64) (io.ReadCloser, error) {
+	r, err := s.inner.LimitedReader(file, off, n)
+	if err != nil {
+		return r, err
+	}
+	atomic.AddInt32(&s.open, 1)
+	return &countReader{ReadCloser: r, s: s, once: new(sync.Once)}, nil
+}
+
+func (s *countService) count() (opened, closed int32) {
+	return atomic.LoadInt32(&s.open), atomic.LoadInt32(&s.close)
+}
+
+type countReader struct {
+	io.ReadCloser
+	s    *countService
+	once *sync.Once
+}
+
+func (r *countReader) Close() error {
+	r.once.Do(func() {
+		atomic.AddInt32(&r.s.close, 1)
+	})
+	return r.ReadCloser.Close()
+}
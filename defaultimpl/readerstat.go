@@ -7,6 +7,7 @@ import (
 	"log"
 	"strings"
 	"sync/atomic"
+	"time"
 )
 
 // DebugOff deactivates all debug messages. Errors, warnings or information are still printed.
@@ -37,6 +38,12 @@ type _ReaderStat struct {
 	_RAtBest       uint64
 	_RAtAdd        uint64
 	_RAtAddErr     uint64
+	_RAtAhead      uint64
+	_RAtRetry      uint64
+	_RAtRetryFail  uint64
+	_RAtVerify     uint64
+	_RAtVerifyErr  uint64
+	_RAtIdleClose  uint64
 }
 
 func (s *_ReaderStat) Stat() map[string]uint64 {
@@ -54,6 +61,12 @@ func (s *_ReaderStat) Stat() map[string]uint64 {
 		"RAtBest":       atomic.LoadUint64(&s._RAtBest),
 		"RAtAdd":        atomic.LoadUint64(&s._RAtAdd),
 		"RAtAddErr":     atomic.LoadUint64(&s._RAtAddErr),
+		"RAtAhead":      atomic.LoadUint64(&s._RAtAhead),
+		"RAtRetry":      atomic.LoadUint64(&s._RAtRetry),
+		"RAtRetryFail":  atomic.LoadUint64(&s._RAtRetryFail),
+		"RAtVerify":     atomic.LoadUint64(&s._RAtVerify),
+		"RAtVerifyErr":  atomic.LoadUint64(&s._RAtVerifyErr),
+		"RAtIdleClose":  atomic.LoadUint64(&s._RAtIdleClose),
 	}
 
 	// ignore zero values
@@ -179,3 +192,41 @@ func (s *_ReaderStat) RAtAdd(fileId string, sector uint64, err error) {
 		log.Printf("DEBUG: %s/stat.RAtAdd: id=%s, startSector=%d, err=%v", s.packageName, fileId, sector, err)
 	}
 }
+
+func (s *_ReaderStat) RAtAhead(fileId string, sector uint64, n int, err error) {
+	atomic.AddUint64(&s._RAtAhead, 1)
+	if s.debugLvl >= DebugHigh { // Debug level: high=2
+		log.Printf("DEBUG: %s/stat.RAtAhead: id=%s, sector=%d, n=%d/%d, err=%v", s.packageName, fileId, sector, n, interf.SectorSize, err)
+	}
+}
+
+func (s *_ReaderStat) RAtRetry(fileId string, sector uint64, attempt int, err error) {
+	atomic.AddUint64(&s._RAtRetry, 1)
+	if s.debugLvl >= DebugLow { // Debug level: low=1
+		log.Printf("DEBUG: %s/stat.RAtRetry: id=%s, sector=%d, attempt=%d, err=%v", s.packageName, fileId, sector, attempt, err)
+	}
+}
+
+func (s *_ReaderStat) RAtRetryFail(fileId string, sector uint64, attempts int, err error) {
+	atomic.AddUint64(&s._RAtRetryFail, 1)
+	if s.debugLvl >= DebugLow { // Debug level: low=1
+		log.Printf("DEBUG: %s/stat.RAtRetryFail: id=%s, sector=%d, attempts=%d, err=%v", s.packageName, fileId, sector, attempts, err)
+	}
+}
+
+func (s *_ReaderStat) RAtVerify(fileId string, err error) {
+	atomic.AddUint64(&s._RAtVerify, 1)
+	if err != errVerified {
+		atomic.AddUint64(&s._RAtVerifyErr, 1)
+		log.Printf("ERROR: %s/stat.RAtVerify: id=%s, err=%v", s.packageName, fileId, err) // Debug level: error=0
+	} else if s.debugLvl >= DebugLow { // Debug level: low=1
+		log.Printf("DEBUG: %s/stat.RAtVerify: id=%s, ok", s.packageName, fileId)
+	}
+}
+
+func (s *_ReaderStat) RAtIdleClose(fileId string, slot int, idle time.Duration) {
+	atomic.AddUint64(&s._RAtIdleClose, 1)
+	if s.debugLvl >= DebugLow { // Debug level: low=1
+		log.Printf("DEBUG: %s/stat.RAtIdleClose: id=%s, slot=%d, idle=%v", s.packageName, fileId, slot, idle)
+	}
+}
@@ -0,0 +1,197 @@
+package impl
+
+import (
+	"errors"
+	interf "github.com/SchnorcherSepp/storage/interfaces"
+	"github.com/oxtoacart/bpool"
+	"io"
+	"sync"
+)
+
+// ReadSeeker is a cursor over a interf.ReaderAt (@see NewReadSeeker).
+type ReadSeeker interface {
+	io.ReadSeeker
+	io.WriterTo
+}
+
+// interface check: ReadSeeker
+var _ ReadSeeker = (*_ReadSeeker)(nil)
+
+// seekerPools provides the buffers of WriteTo() for all cursors (a pool per sector size, @see WithSectorSize).
+var seekerPools = struct {
+	mux   *sync.Mutex // protect 'pools'
+	pools map[int64]*bpool.BytePool
+}{
+	mux:   new(sync.Mutex),
+	pools: make(map[int64]*bpool.BytePool),
+}
+
+// _ReadSeeker is a cursor with its own position.
+type _ReadSeeker struct {
+	rAt    interf.ReaderAt
+	size   int64
+	sector int64 // largest sector size of the ReaderAt (buffer size of WriteTo)
+	off    int64 // current position
+}
+
+// NewReadSeeker returns a cursor over the ReaderAt for the standard library (e.g. http.ServeContent).
+// size is the file size (used by io.SeekEnd). The cursor is not thread-safe, but many independent cursors
+// can share one ReaderAt. Closing the ReaderAt is the job of the caller.
+//
+// Example of use:
+//   rs := impl.NewReadSeeker(rAt, file.Size())
+//   http.ServeContent(w, req, file.Name(), time.Unix(file.ModTime(), 0), rs)
+func NewReadSeeker(rAt interf.ReaderAt, size int64) ReadSeeker {
+	if size < 0 {
+		size = 0
+	}
+	return &_ReadSeeker{
+		rAt:    rAt,
+		size:   size,
+		sector: sectorSizeOf(rAt),
+	}
+}
+
+// Read reads up to len(p) bytes at the current position (@see io.Reader).
+func (r *_ReadSeeker) Read(p []byte) (int, error) {
+	if r.off >= r.size {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if rest := r.size - r.off; int64(len(p)) > rest {
+		p = p[:rest]
+	}
+
+	n, err := r.rAt.ReadAt(p, r.off)
+	r.off += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil // the next call returns io.EOF
+	}
+	return n, err
+}
+
+// Seek sets the position for the next Read() (@see io.Seeker).
+// A position after the end is allowed, Read() returns io.EOF.
+func (r *_ReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+		// offset
+	case io.SeekCurrent:
+		offset += r.off
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	r.off = offset
+	return offset, nil
+}
+
+// WriteTo writes the data from the current position to the end of the file (@see io.WriterTo).
+// The data are read in sector-aligned chunks, so every chunk is a single sector of the ReaderAt.
+func (r *_ReadSeeker) WriteTo(w io.Writer) (int64, error) {
+	pool := seekerPool(r.sector)
+	buf := pool.Get()
+	defer pool.Put(buf)
+
+	var total int64
+	for r.off < r.size {
+		// chunk up to the next sector boundary of the inner ReaderAt
+		chunk := chunkSizeOf(r.rAt, r.off)
+		if chunk > r.sector {
+			chunk = r.sector
+		}
+		if rest := r.size - r.off; chunk > rest {
+			chunk = rest
+		}
+
+		// read
+		n, err := r.rAt.ReadAt(buf[:chunk], r.off)
+		if n > 0 {
+			nw, errW := w.Write(buf[:n])
+			r.off += int64(nw)
+			total += int64(nw)
+			if errW != nil {
+				return total, errW
+			}
+			if nw < n {
+				return total, io.ErrShortWrite
+			}
+		}
+
+		// exit
+		if err == io.EOF {
+			return total, nil // file is shorter than size
+		}
+		if err != nil {
+			return total, err
+		}
+		if n == 0 {
+			return total, io.ErrNoProgress
+		}
+	}
+	return total, nil
+}
+
+//--------  HELPER  --------------------------------------------------------------------------------------------------//
+
+// seekerPool returns the buffer pool for the sector size.
+func seekerPool(sector int64) *bpool.BytePool {
+	seekerPools.mux.Lock() // LOCK
+	defer seekerPools.mux.Unlock()
+
+	p, ok := seekerPools.pools[sector]
+	if !ok {
+		p = bpool.NewBytePool(25, int(sector))
+		seekerPools.pools[sector] = p
+	}
+	return p
+}
+
+// sectorSizeOf returns the largest sector size of the ReaderAt (@see WithSectorSize).
+// Other implementations use interf.SectorSize.
+func sectorSizeOf(rAt interf.ReaderAt) int64 {
+	switch r := rAt.(type) {
+	case *_ReaderAt:
+		return r.sectorSize
+	case *_SubReaderAt:
+		return sectorSizeOf(r.inner)
+	case *_MReaderAt:
+		var max int64
+		for _, v := range r.readers {
+			if size := sectorSizeOf(v); size > max {
+				max = size
+			}
+		}
+		if max > 0 {
+			return max
+		}
+	}
+	return interf.SectorSize
+}
+
+// chunkSizeOf returns the number of bytes from off to the next sector boundary of the ReaderAt.
+// The offset of a SubReaderAt and the file boundaries of a MultiReaderAt are taken into account.
+func chunkSizeOf(rAt interf.ReaderAt, off int64) int64 {
+	switch r := rAt.(type) {
+	case *_ReaderAt:
+		return r.sectorSize - off%r.sectorSize
+	case *_SubReaderAt:
+		return chunkSizeOf(r.inner, r.off+off)
+	case *_MReaderAt:
+		if fileNo := int(off / r.fileSize); fileNo < len(r.readers) {
+			fileOff := off % r.fileSize
+			chunk := chunkSizeOf(r.readers[fileNo], fileOff)
+			if rest := r.fileSize - fileOff; chunk > rest {
+				chunk = rest // up to the next file
+			}
+			return chunk
+		}
+	}
+	return interf.SectorSize - off%interf.SectorSize
+}
@@ -0,0 +1,196 @@
+package impl_test
+
+import (
+	"bytes"
+	impl "github.com/SchnorcherSepp/storage/defaultimpl"
+	interf "github.com/SchnorcherSepp/storage/interfaces"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+func TestNewReadSeeker(t *testing.T) {
+	data, s := newFaultyTestData(t)
+	f := s.Files().All()[0]
+	rAt, _ := impl.NewReaderAt(f, s, impl.NewCache(0), impl.DebugOff)
+	defer rAt.Close()
+
+	// io.Reader and io.Seeker behavior
+	if err := iotest.TestReader(impl.NewReadSeeker(rAt, f.Size()), data); err != nil {
+		t.Fatal(err)
+	}
+
+	// seek
+	rs := impl.NewReadSeeker(rAt, f.Size())
+	b := make([]byte, 10)
+	if pos, err := rs.Seek(-10, io.SeekEnd); err != nil || pos != f.Size()-10 {
+		t.Fatalf("wrong seek: %d, %v", pos, err)
+	}
+	if n, err := io.ReadFull(rs, b); n != 10 || err != nil || !bytes.Equal(b, data[len(data)-10:]) {
+		t.Fatalf("read error: %v", err)
+	}
+	if n, err := rs.Read(b); n != 0 || err != io.EOF {
+		t.Fatalf("wrong EOF: %v", err)
+	}
+	if pos, _ := rs.Seek(-20, io.SeekCurrent); pos != f.Size()-20 {
+		t.Fatalf("wrong seek: %d", pos)
+	}
+	if pos, _ := rs.Seek(f.Size()+100, io.SeekStart); pos != f.Size()+100 {
+		t.Fatalf("wrong seek: %d", pos)
+	}
+	if n, err := rs.Read(b); n != 0 || err != io.EOF {
+		t.Fatalf("wrong EOF after the end: %v", err)
+	}
+	if _, err := rs.Seek(-1, io.SeekStart); err == nil {
+		t.Fatal("no error with a negative position")
+	}
+	if _, err := rs.Seek(0, 99); err == nil {
+		t.Fatal("no error with an invalid whence")
+	}
+}
+
+func TestReadSeeker_WriteTo(t *testing.T) {
+	data, s := newFaultyTestData(t) // 10 sectors + 3 bytes
+	f := s.Files().All()[0]
+	rAt, _ := impl.NewReaderAt(f, s, nil, impl.DebugOff)
+	defer rAt.Close()
+
+	// sector-aligned chunks
+	rs := impl.NewReadSeeker(rAt, f.Size())
+	_, _ = rs.Seek(100, io.SeekStart)
+	buf := new(bytes.Buffer)
+	if n, err := io.Copy(buf, rs); n != f.Size()-100 || err != nil || !bytes.Equal(buf.Bytes(), data[100:]) {
+		t.Fatalf("wrong copy: %d, %v", n, err)
+	}
+	if st := rAt.Stat(); st["RAtReq"] != 11 || st["RAtAdd"] != 1 {
+		t.Fatalf("wrong stat: %v", st)
+	}
+	if n, err := rs.WriteTo(buf); n != 0 || err != nil {
+		t.Fatalf("wrong copy at the end: %d, %v", n, err)
+	}
+
+	// size is bigger than the file
+	rs = impl.NewReadSeeker(rAt, f.Size()+5000)
+	if n, err := rs.WriteTo(ioutil.Discard); n != f.Size() || err != nil {
+		t.Fatalf("wrong copy: %d, %v", n, err)
+	}
+}
+
+func TestReadSeeker_WriteTo_SectorSize(t *testing.T) {
+	data, s := newFaultyTestData(t)
+	f := s.Files().All()[0]
+	const sector = 4096
+	rAt, _ := impl.NewReaderAt(f, s, nil, impl.DebugOff, impl.WithSectorSize(sector))
+	defer rAt.Close()
+
+	// chunks aligned to the configured sector size: one sector per ReadAt()
+	rs := impl.NewReadSeeker(rAt, f.Size())
+	_, _ = rs.Seek(100, io.SeekStart)
+	buf := new(bytes.Buffer)
+	if n, err := rs.WriteTo(buf); n != f.Size()-100 || err != nil || !bytes.Equal(buf.Bytes(), data[100:]) {
+		t.Fatalf("wrong copy: %d, %v", n, err)
+	}
+	sectors := uint64((f.Size() + sector - 1) / sector)
+	if st := rAt.Stat(); st["RAtReq"] != sectors || st["RAtSectorRet"] != sectors {
+		t.Fatalf("wrong stat: %v", st)
+	}
+
+	// sub reader: sector size of the inner ReaderAt
+	sub, _ := impl.NewSubReaderAt(f, s, nil, impl.DebugOff, 0, f.Size(), impl.WithSectorSize(sector))
+	defer sub.Close()
+	buf.Reset()
+	if n, err := impl.NewReadSeeker(sub, f.Size()).WriteTo(buf); n != f.Size() || err != nil || !bytes.Equal(buf.Bytes(), data) {
+		t.Fatalf("wrong copy: %d, %v", n, err)
+	}
+}
+
+func TestReadSeeker_WriteTo_Unaligned(t *testing.T) {
+	data, s := newFaultyTestData(t)
+	f := s.Files().All()[0]
+	const sector = 4096
+	sectors := uint64((f.Size() + sector - 1) / sector)
+
+	// sub reader at an unaligned offset: one inner sector per ReadAt()
+	sub, _ := impl.NewSubReaderAt(f, s, nil, impl.DebugOff, 1000, f.Size()-1000, impl.WithSectorSize(sector))
+	defer sub.Close()
+	buf := new(bytes.Buffer)
+	if n, err := impl.NewReadSeeker(sub, f.Size()-1000).WriteTo(buf); n != f.Size()-1000 || err != nil || !bytes.Equal(buf.Bytes(), data[1000:]) {
+		t.Fatalf("wrong copy: %d, %v", n, err)
+	}
+	if st := sub.Stat(); st["RAtReq"] != sectors || st["RAtSectorRet"] != sectors {
+		t.Fatalf("wrong stat: %v", st)
+	}
+
+	// multi reader: the second file starts at an unaligned offset
+	if _, err := s.Save("b.dat", bytes.NewReader(data), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Update(); err != nil {
+		t.Fatal(err)
+	}
+	a, _ := s.Files().ByName("a.dat")
+	b, _ := s.Files().ByName("b.dat")
+	files := []interf.File{a, b}
+	multi, err := impl.NewMultiReaderAt(files, s, nil, impl.DebugOff, impl.WithSectorSize(sector))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer multi.Close()
+	buf.Reset()
+	if n, err := impl.NewReadSeeker(multi, 2*f.Size()).WriteTo(buf); n != 2*f.Size() || err != nil || !bytes.Equal(buf.Bytes(), append(data, data...)) {
+		t.Fatalf("wrong copy: %d, %v", n, err)
+	}
+	if st := multi.Stat(); st["[1] RAtReq"] != sectors || st["[1] RAtSectorRet"] != sectors {
+		t.Fatalf("wrong stat: %v", st)
+	}
+}
+
+func TestReadSeeker_ServeContent(t *testing.T) {
+	data, s := newFaultyTestData(t)
+	f := s.Files().All()[0]
+	rAt, _ := impl.NewReaderAt(f, s, impl.NewCache(0), impl.DebugOff)
+	defer rAt.Close()
+
+	req := httptest.NewRequest("GET", "/a.dat", nil)
+	req.Header.Set("Range", "bytes=20000-20099")
+	rec := httptest.NewRecorder()
+	http.ServeContent(rec, req, f.Name(), time.Unix(f.ModTime(), 0), impl.NewReadSeeker(rAt, f.Size()))
+
+	if rec.Code != http.StatusPartialContent || !bytes.Equal(rec.Body.Bytes(), data[20000:20100]) {
+		t.Fatalf("wrong response: %d, %d bytes", rec.Code, rec.Body.Len())
+	}
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+
+func TestRace_ReadSeeker(t *testing.T) {
+	data, s := newFaultyTestData(t)
+	f := s.Files().All()[0]
+	rAt, _ := impl.NewReaderAt(f, s, impl.NewCache(0), impl.DebugOff)
+	defer rAt.Close()
+
+	var wg sync.WaitGroup
+	wg.Add(5)
+	for n := 0; n < 5; n++ {
+		go func(n int) {
+			//------------------------------
+			for i := 0; i < 10; i++ {
+				rs := impl.NewReadSeeker(rAt, f.Size()) // own cursor
+				off := int64(n*1000 + i*3000)
+				_, _ = rs.Seek(off, io.SeekStart)
+				buf := new(bytes.Buffer)
+				if _, err := io.Copy(buf, rs); err != nil || !bytes.Equal(buf.Bytes(), data[off:]) {
+					t.Errorf("wrong copy at %d: %v", off, err)
+				}
+			}
+			//------------------------------
+			wg.Done()
+		}(n)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,103 @@
+package impl
+
+import (
+	"sync"
+	"time"
+)
+
+// reapMinInterval is the min. time between two runs of the idle reaper.
+const reapMinInterval = 10 * time.Millisecond
+
+// _Reaper closes the idle connections of all registered ReaderAt (@see WithIdleTimeout).
+// A ReaderAt is registered only while it has idle connections, so the map doesn't keep
+// a ReaderAt without Close() alive. The background goroutine runs only while at least one ReaderAt is registered.
+type _Reaper struct {
+	mux     *sync.Mutex             // protect 'readers' and 'running'
+	readers map[*_ReaderAt]struct{} // ReaderAt with idle connections (until reaped or Close)
+	running bool                    // the goroutine is running
+	wake    chan struct{}           // a new ReaderAt was registered (recalculate the interval)
+}
+
+// reaper is the global registry of all ReaderAt with an idle timeout.
+var reaper = &_Reaper{
+	mux:     new(sync.Mutex),
+	readers: make(map[*_ReaderAt]struct{}),
+	wake:    make(chan struct{}, 1),
+}
+
+// ReapIdleConns closes the idle connections of all ReaderAt with an idle timeout now (@see WithIdleTimeout).
+// The background reaper does the same periodically. Returns the number of closed connections.
+func ReapIdleConns() int {
+	return reaper.reap()
+}
+
+// add registers the ReaderAt and starts the goroutine.
+func (p *_Reaper) add(r *_ReaderAt) {
+	p.mux.Lock() // LOCK
+	defer p.mux.Unlock()
+
+	p.readers[r] = struct{}{}
+	if !p.running {
+		p.running = true
+		go p.loop()
+	}
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// remove unregisters the ReaderAt. The goroutine stops with the last ReaderAt.
+func (p *_Reaper) remove(r *_ReaderAt) {
+	p.mux.Lock() // LOCK
+	defer p.mux.Unlock()
+
+	delete(p.readers, r)
+}
+
+// loop runs the reaper at half of the smallest idle timeout.
+func (p *_Reaper) loop() {
+	for {
+		p.mux.Lock() // LOCK
+		if len(p.readers) == 0 {
+			p.running = false
+			p.mux.Unlock() // UNLOCK
+			return
+		}
+		interval := time.Duration(-1)
+		for r := range p.readers {
+			if interval < 0 || r.idleTimeout/2 < interval {
+				interval = r.idleTimeout / 2
+			}
+		}
+		p.mux.Unlock() // UNLOCK
+
+		if interval < reapMinInterval {
+			interval = reapMinInterval
+		}
+		t := time.NewTimer(interval)
+		select {
+		case <-t.C:
+			p.reap()
+		case <-p.wake:
+			t.Stop() // recalculate
+		}
+	}
+}
+
+// reap closes the idle connections of all registered ReaderAt.
+func (p *_Reaper) reap() int {
+	p.mux.Lock() // LOCK
+	list := make([]*_ReaderAt, 0, len(p.readers))
+	for r := range p.readers {
+		list = append(list, r)
+	}
+	p.mux.Unlock() // UNLOCK
+
+	n := 0
+	now := time.Now().UnixNano()
+	for _, r := range list {
+		n += r.reapIdle(now) // without the reaper lock
+	}
+	return n
+}
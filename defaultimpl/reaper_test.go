@@ -0,0 +1,127 @@
+package impl_test
+
+import (
+	impl "github.com/SchnorcherSepp/storage/defaultimpl"
+	interf "github.com/SchnorcherSepp/storage/interfaces"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWithIdleTimeout(t *testing.T) {
+	_, s := newFaultyTestData(t)
+	f := s.Files().All()[0]
+	b := make([]byte, 10)
+
+	// the background reaper closes the idle connection
+	rAt, err := impl.NewReaderAt(f, s, nil, impl.DebugOff, impl.WithIdleTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rAt.Close()
+	_, _ = rAt.ReadAt(b, 0)
+	waitFor(t, func() bool {
+		return rAt.Stat()["RAtIdleClose"] == 1
+	})
+
+	// the next read opens a new connection
+	_, _ = rAt.ReadAt(b, interf.SectorSize)
+	if st := rAt.Stat(); st["RAtAdd"] != 2 {
+		t.Fatalf("wrong stat: %v", st)
+	}
+
+	// an active connection isn't closed
+	rAt2, _ := impl.NewReaderAt(f, s, nil, impl.DebugOff, impl.WithIdleTimeout(time.Hour))
+	defer rAt2.Close()
+	_, _ = rAt2.ReadAt(b, 0)
+	impl.ReapIdleConns()
+	_, _ = rAt2.ReadAt(b, interf.SectorSize)
+	if st := rAt2.Stat(); st["RAtIdleClose"] != 0 || st["RAtAdd"] != 1 {
+		t.Fatalf("wrong stat: %v", st)
+	}
+
+	// without option
+	rAt3, _ := impl.NewReaderAt(f, s, nil, impl.DebugOff)
+	defer rAt3.Close()
+	_, _ = rAt3.ReadAt(b, 0)
+	time.Sleep(60 * time.Millisecond)
+	impl.ReapIdleConns()
+	if st := rAt3.Stat(); st["RAtIdleClose"] != 0 {
+		t.Fatalf("wrong stat: %v", st)
+	}
+
+	// invalid
+	if _, err := impl.NewReaderAt(f, s, nil, impl.DebugOff, impl.WithIdleTimeout(0)); err == nil {
+		t.Fatal("no error with timeout 0")
+	}
+}
+
+func TestReapIdleConns(t *testing.T) {
+	_, s := newFaultyTestData(t)
+	f := s.Files().All()[0]
+
+	// connections of several ReaderAt
+	list := make([]interf.ReaderAt, 3)
+	for i := range list {
+		list[i], _ = impl.NewReaderAt(f, s, nil, impl.DebugOff, impl.WithIdleTimeout(time.Millisecond))
+		_, _ = list[i].ReadAt(make([]byte, 10), 0)
+	}
+	time.Sleep(5 * time.Millisecond)
+	impl.ReapIdleConns() // the background reaper may be faster
+
+	for i, rAt := range list {
+		if st := rAt.Stat(); st["RAtIdleClose"] != 1 {
+			t.Fatalf("%d: wrong stat: %v", i, st)
+		}
+		_ = rAt.Close()
+	}
+}
+
+func TestWithIdleTimeout_Unclosed(t *testing.T) {
+	_, s := newFaultyTestData(t)
+	f := s.Files().All()[0]
+
+	// a ReaderAt without Close() is released after its idle connection was reaped
+	var collected int32
+	func() {
+		rAt, _ := impl.NewReaderAt(f, s, nil, impl.DebugOff, impl.WithIdleTimeout(time.Millisecond))
+		_, _ = rAt.ReadAt(make([]byte, 10), 0)
+		runtime.SetFinalizer(rAt, func(interface{}) { atomic.StoreInt32(&collected, 1) })
+	}()
+	waitFor(t, func() bool {
+		runtime.GC()
+		return atomic.LoadInt32(&collected) == 1
+	})
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+
+func TestRace_IdleTimeout(t *testing.T) {
+	_, s := newFaultyTestData(t)
+	f := s.Files().All()[0]
+
+	var wg sync.WaitGroup
+	wg.Add(5)
+	for n := 0; n < 5; n++ {
+		go func() {
+			//------------------------------
+			rAt, _ := impl.NewReaderAt(f, s, nil, impl.DebugOff, impl.WithIdleTimeout(time.Millisecond))
+			b := make([]byte, 100)
+			for i := 0; i < 50; i++ {
+				if _, err := rAt.ReadAt(b, int64(i*1000)); err != nil {
+					t.Error(err)
+				}
+				if i%10 == 0 {
+					impl.ReapIdleConns()
+					time.Sleep(2 * time.Millisecond)
+				}
+			}
+			_ = rAt.Close()
+			//------------------------------
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+}
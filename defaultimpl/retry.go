@@ -0,0 +1,94 @@
+package impl
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+	"time"
+)
+
+// RetryPolicy configures the retry of failed sector reads (@see WithRetry).
+// A failed read closes the connection, the retry opens a new connection at the failed sector.
+type RetryPolicy struct {
+	MaxAttempts int                  // max. number of attempts per sector (incl. the first one); <= 1 = no retry
+	BaseDelay   time.Duration        // delay before the first retry, doubled with every retry
+	MaxDelay    time.Duration        // upper limit of the delay (0 = unlimited)
+	Retryable   func(err error) bool // classifies the errors; nil = DefaultRetryable
+}
+
+// DefaultRetryPolicy tries every sector up to 4 times (the backoff waits max. 1.4 seconds).
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	BaseDelay:   200 * time.Millisecond,
+	MaxDelay:    2 * time.Second,
+}
+
+// DefaultRetryable returns false for errors that a new connection can't fix (also if wrapped):
+// io.EOF, io.ErrClosedPipe (closed ReaderAt), the errors of a canceled context
+// and the permanent errors os.ErrNotExist (e.g. a trashed file) and os.ErrPermission.
+// All other errors are transient (e.g. a network reset).
+func DefaultRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	for _, e := range []error{io.EOF, io.ErrClosedPipe, context.Canceled, context.DeadlineExceeded, os.ErrNotExist, os.ErrPermission} {
+		if errors.Is(err, e) {
+			return false
+		}
+	}
+	return true
+}
+
+// WithRetry enables the retry of failed sector reads: a transient error is not returned to the caller,
+// the sector is read again with a new connection (exponential backoff with jitter).
+// The cancellation of the context (@see interf.ContextReaderAt) stops the backoff.
+func WithRetry(policy RetryPolicy) ReaderAtOption {
+	return func(c *_ReaderAtConfig) {
+		if policy.MaxAttempts > 1 {
+			c.retry = &policy
+		}
+	}
+}
+
+// retryable applies the classifier of the policy.
+func (p *RetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return DefaultRetryable(err)
+}
+
+// backoff returns the delay before the next attempt (attempt is the number of the failed attempt, min. 1).
+// The jitter spreads the delay over [delay/2, delay], so parallel readers don't retry at the same time.
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < attempt && (p.MaxDelay <= 0 || d < p.MaxDelay); i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// wait sleeps before the next attempt. Returns ctx.Err() if the context is canceled before.
+func (p *RetryPolicy) wait(ctx context.Context, attempt int) error {
+	d := p.backoff(attempt)
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
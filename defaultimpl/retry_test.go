@@ -0,0 +1,173 @@
+package impl_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	impl "github.com/SchnorcherSepp/storage/defaultimpl"
+	interf "github.com/SchnorcherSepp/storage/interfaces"
+	"io"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fastRetry is a RetryPolicy without a noticeable delay.
+var fastRetry = impl.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 4 * time.Millisecond}
+
+func TestWithRetry(t *testing.T) {
+	data, inner := newFaultyTestData(t)
+	f := inner.Files().All()[0]
+
+	// the first connection dies in the middle of the second sector
+	s := impl.NewFaultyService(inner, impl.FaultPlan{
+		Cut:      impl.Fault{Schedule: []uint64{1}},
+		CutAfter: interf.SectorSize + interf.SectorSize/2,
+	}, impl.DebugOff)
+	rAt, _ := impl.NewReaderAt(f, s, nil, impl.DebugOff, impl.WithRetry(fastRetry))
+	defer rAt.Close()
+
+	buf := make([]byte, len(data))
+	if n, err := rAt.ReadAt(buf, 0); n != len(data) || err != nil || !bytes.Equal(buf, data) {
+		t.Fatalf("wrong ReadAt: n=%d, err=%v", n, err)
+	}
+	if st := rAt.Stat(); st["RAtRetry"] != 1 || st["RAtAdd"] != 2 || st["RAtRetryFail"] != 0 {
+		t.Fatalf("wrong stat: %v", st)
+	}
+
+	// open fails: give up after MaxAttempts
+	s = impl.NewFaultyService(inner, impl.FaultPlan{Open: impl.Fault{Probability: 1}}, impl.DebugOff)
+	rAt2, _ := impl.NewReaderAt(f, s, nil, impl.DebugOff, impl.WithRetry(fastRetry))
+	defer rAt2.Close()
+	if n, err := rAt2.ReadAt(buf, 0); n != 0 || err != impl.ErrInjected {
+		t.Fatalf("wrong ReadAt: n=%d, err=%v", n, err)
+	}
+	if st := rAt2.Stat(); st["RAtRetry"] != 2 || st["RAtAdd"] != 3 || st["RAtRetryFail"] != 1 {
+		t.Fatalf("wrong stat: %v", st)
+	}
+
+	// EOF isn't retried
+	if n, err := rAt.ReadAt(buf, int64(len(data))); n != 0 || err == nil {
+		t.Fatalf("wrong ReadAt: n=%d, err=%v", n, err)
+	}
+	if st := rAt.Stat(); st["RAtRetry"] != 1 {
+		t.Fatalf("wrong stat: %v", st)
+	}
+
+	// without policy (MaxAttempts <= 1)
+	rAt3, _ := impl.NewReaderAt(f, s, nil, impl.DebugOff, impl.WithRetry(impl.RetryPolicy{MaxAttempts: 1}))
+	defer rAt3.Close()
+	if _, err := rAt3.ReadAt(buf, 0); err != impl.ErrInjected {
+		t.Fatalf("wrong error: %v", err)
+	}
+	if st := rAt3.Stat(); st["RAtRetry"] != 0 || st["RAtAdd"] != 1 {
+		t.Fatalf("wrong stat: %v", st)
+	}
+}
+
+func TestWithRetry_Classifier(t *testing.T) {
+	_, inner := newFaultyTestData(t)
+	f := inner.Files().All()[0]
+
+	permanent := errors.New("permanent")
+	s := impl.NewFaultyService(inner, impl.FaultPlan{Open: impl.Fault{Probability: 1, Err: permanent}}, impl.DebugOff)
+	policy := fastRetry
+	policy.Retryable = func(err error) bool {
+		return err != permanent
+	}
+	rAt, _ := impl.NewReaderAt(f, s, nil, impl.DebugOff, impl.WithRetry(policy))
+	defer rAt.Close()
+
+	if _, err := rAt.ReadAt(make([]byte, 10), 0); err != permanent {
+		t.Fatalf("wrong error: %v", err)
+	}
+	if st := rAt.Stat(); st["RAtRetry"] != 0 || st["RAtAdd"] != 1 {
+		t.Fatalf("wrong stat: %v", st)
+	}
+
+	// default classifier (also wrapped errors)
+	for _, err := range []error{nil, context.Canceled, context.DeadlineExceeded, os.ErrNotExist, os.ErrPermission,
+		fmt.Errorf("wrapped: %w", io.EOF), fmt.Errorf("wrapped: %w", context.Canceled),
+		&os.PathError{Op: "open", Path: "x", Err: os.ErrNotExist}} {
+		if impl.DefaultRetryable(err) {
+			t.Fatalf("retryable: %v", err)
+		}
+	}
+	if !impl.DefaultRetryable(impl.ErrInjected) || !impl.DefaultRetryable(fmt.Errorf("wrapped: %w", impl.ErrInjected)) {
+		t.Fatal("not retryable")
+	}
+}
+
+func TestWithRetry_Trashed(t *testing.T) {
+	_, s := newFaultyTestData(t)
+	f := s.Files().All()[0]
+	rAt, _ := impl.NewReaderAt(f, s, nil, impl.DebugOff, impl.WithRetry(impl.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Hour}))
+	defer rAt.Close()
+
+	// a permanent error: no retry (no backoff)
+	_ = s.Trash(f)
+	if _, err := rAt.ReadAt(make([]byte, 10), 0); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("wrong error: %v", err)
+	}
+	if st := rAt.Stat(); st["RAtRetry"] != 0 {
+		t.Fatalf("wrong stat: %v", st)
+	}
+}
+
+func TestWithRetry_Cancel(t *testing.T) {
+	_, inner := newFaultyTestData(t)
+	f := inner.Files().All()[0]
+
+	// the backoff is longer than the deadline
+	s := impl.NewFaultyService(inner, impl.FaultPlan{Open: impl.Fault{Probability: 1}}, impl.DebugOff)
+	rAt, _ := impl.NewReaderAt(f, s, nil, impl.DebugOff, impl.WithRetry(impl.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Hour}))
+	defer rAt.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := impl.ReadAtContext(ctx, rAt, make([]byte, 10), 0); err != context.DeadlineExceeded {
+		t.Fatalf("wrong error: %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("backoff not aborted: %v", d)
+	}
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+
+func TestRace_Retry(t *testing.T) {
+	data, inner := newFaultyTestData(t)
+	f := inner.Files().All()[0]
+
+	// every second connection dies
+	s := impl.NewFaultyService(inner, impl.FaultPlan{
+		Seed:     1,
+		Cut:      impl.Fault{Probability: 0.5},
+		CutAfter: interf.SectorSize / 2,
+	}, impl.DebugOff)
+	policy := fastRetry
+	policy.MaxAttempts = 20
+	rAt, _ := impl.NewReaderAt(f, s, impl.NewCache(0), impl.DebugOff, impl.WithRetry(policy))
+	defer rAt.Close()
+
+	var wg sync.WaitGroup
+	wg.Add(5)
+	for n := 0; n < 5; n++ {
+		go func(n int) {
+			//------------------------------
+			b := make([]byte, 1000)
+			for i := 0; i < 30; i++ {
+				off := int64((i*7 + n) * 3000 % (len(data) - len(b)))
+				if _, err := rAt.ReadAt(b, off); err != nil || !bytes.Equal(b, data[off:off+int64(len(b))]) {
+					t.Errorf("read error at %d: %v", off, err)
+				}
+			}
+			//------------------------------
+			wg.Done()
+		}(n)
+	}
+	wg.Wait()
+}
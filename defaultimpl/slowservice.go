@@ -0,0 +1,236 @@
+package impl
+
+import (
+	interf "github.com/SchnorcherSepp/storage/interfaces"
+	"io"
+	"sync"
+	"time"
+)
+
+// interface check: interf.Service and interf.ReaderService
+var _ interf.Service = (*_SlowService)(nil)
+var _ interf.ReaderService = (*_SlowReaderService)(nil)
+
+// Clock is the time source of the slow service wrapper.
+// Tests can use a virtual clock that only advances in Sleep().
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+}
+
+// SystemClock is the real Clock (time.Now and time.Sleep).
+var SystemClock Clock = _SystemClock{}
+
+type _SystemClock struct{}
+
+func (_SystemClock) Now() time.Time        { return time.Now() }
+func (_SystemClock) Sleep(d time.Duration) { time.Sleep(d) }
+
+// SlowConfig configures the simulated network of NewSlowService() and NewSlowReaderService().
+// The zero value adds no delay.
+//
+// Example: Google Drive like connection (400 MBit/s, slow openings)
+//   conf := SlowConfig{
+//       OpenLatency:     300 * time.Millisecond,
+//       FirstByte:       100 * time.Millisecond,
+//       ConnBandwidth:   50 * 1024 * 1024,
+//       GlobalBandwidth: 50 * 1024 * 1024,
+//   }
+type SlowConfig struct {
+	OpenLatency     time.Duration // delay of every Reader() and LimitedReader() call
+	FirstByte       time.Duration // time to first byte: additional delay of the first Read() of a connection
+	ConnBandwidth   int64         // bytes per second of a single connection (0 = unlimited)
+	GlobalBandwidth int64         // bytes per second of all connections together (0 = unlimited)
+	Clock           Clock         // nil = SystemClock
+}
+
+// _SlowReaderService is a interf.ReaderService decorator that simulates a slow network.
+// Must be created with NewSlowReaderService().
+type _SlowReaderService struct {
+	inner  interf.ReaderService
+	conf   SlowConfig
+	global *_Bandwidth // shared by all connections
+}
+
+// _SlowService is a interf.Service decorator that simulates a slow network.
+// Must be created with NewSlowService().
+type _SlowService struct {
+	inner interf.Service
+	*_SlowReaderService
+	debugLvl uint8            // for ReaderAt() and MultiReaderAt()
+	opts     []ReaderAtOption // for ReaderAt() and MultiReaderAt()
+}
+
+// NewSlowReaderService wraps a reader service and delays all reader functions (@see SlowConfig).
+func NewSlowReaderService(inner interf.ReaderService, conf SlowConfig) interf.ReaderService {
+	if conf.Clock == nil {
+		conf.Clock = SystemClock
+	}
+	return &_SlowReaderService{
+		inner:  inner,
+		conf:   conf,
+		global: newBandwidth(conf.GlobalBandwidth),
+	}
+}
+
+// NewSlowService wraps a service and delays all reader functions (@see SlowConfig).
+// All other methods are passed through without delay.
+// ReaderAt() and MultiReaderAt() use the slow Reader() of this wrapper and the cache of the inner service.
+// The debug level and the options are used for ReaderAt() and MultiReaderAt() (@see ReaderAtOption).
+func NewSlowService(inner interf.Service, conf SlowConfig, debugLvl uint8, opts ...ReaderAtOption) interf.Service {
+	return &_SlowService{
+		inner:              inner,
+		_SlowReaderService: NewSlowReaderService(inner, conf).(*_SlowReaderService),
+		debugLvl:           debugLvl,
+		opts:               opts,
+	}
+}
+
+//-----------  IMPLEMENTATION:  @see interf.ReaderService  -----------------------------------------------------------//
+
+func (s *_SlowReaderService) Reader(file interf.File, off int64) (io.ReadCloser, error) {
+	s.conf.Clock.Sleep(s.conf.OpenLatency)
+
+	r, err := s.inner.Reader(file, off)
+	if err != nil {
+		return r, err
+	}
+	return s.wrap(r), nil
+}
+
+func (s *_SlowReaderService) LimitedReader(file interf.File, off int64, n int64) (io.ReadCloser, error) {
+	s.conf.Clock.Sleep(s.conf.OpenLatency)
+
+	r, err := s.inner.LimitedReader(file, off, n)
+	if err != nil {
+		return r, err
+	}
+	return s.wrap(r), nil
+}
+
+//-----------  IMPLEMENTATION:  @see interf.Service  -----------------------------------------------------------------//
+
+func (s *_SlowService) Update() error {
+	return updateScoped(s.inner, s.opts)
+}
+
+func (s *_SlowService) Files() interf.Files {
+	return s.inner.Files()
+}
+
+func (s *_SlowService) Save(name string, r io.Reader, max int64) (interf.File, error) {
+	return s.inner.Save(name, r, max)
+}
+
+func (s *_SlowService) Trash(file interf.File) error {
+	return trashScoped(s.inner, file, s.opts)
+}
+
+func (s *_SlowService) ReaderAt(file interf.File) (interf.ReaderAt, error) {
+	return NewReaderAt(file, s, s.inner.Cache(), s.debugLvl, s.opts...)
+}
+
+func (s *_SlowService) MultiReaderAt(list []interf.File) (interf.ReaderAt, error) {
+	if len(list) == 1 {
+		// use the normal ReaderAt for single files
+		return s.ReaderAt(list[0])
+	} else {
+		// MultiReaderAt
+		return NewMultiReaderAt(list, s, s.inner.Cache(), s.debugLvl, s.opts...)
+	}
+}
+
+func (s *_SlowService) Cache() interf.Cache {
+	return s.inner.Cache()
+}
+
+//--------  HELPER  --------------------------------------------------------------------------------------------------//
+
+// wrap returns a slow connection.
+func (s *_SlowReaderService) wrap(r io.ReadCloser) io.ReadCloser {
+	return &_SlowReader{
+		c:       r,
+		service: s,
+		conn:    newBandwidth(s.conf.ConnBandwidth),
+		first:   true,
+	}
+}
+
+// ------------------------------------------------------------------------------------------------------------------ //
+
+// interface check: io.ReadCloser
+var _ io.ReadCloser = (*_SlowReader)(nil)
+
+// _SlowReader is a connection with time to first byte and bandwidth limits.
+type _SlowReader struct {
+	c       io.ReadCloser
+	service *_SlowReaderService
+	conn    *_Bandwidth // per connection limit
+	first   bool        // true until the first Read()
+}
+
+func (r *_SlowReader) Read(p []byte) (int, error) {
+	clock := r.service.conf.Clock
+
+	// time to first byte
+	if r.first {
+		r.first = false
+		clock.Sleep(r.service.conf.FirstByte)
+	}
+
+	n, err := r.c.Read(p)
+
+	// transfer time: the slower limit wins
+	if n > 0 {
+		now := clock.Now()
+		done := r.conn.reserve(now, n)
+		if g := r.service.global.reserve(now, n); g.After(done) {
+			done = g
+		}
+		if d := done.Sub(now); d > 0 {
+			clock.Sleep(d)
+		}
+	}
+	return n, err
+}
+
+func (r *_SlowReader) Close() error {
+	return r.c.Close()
+}
+
+// ------------------------------------------------------------------------------------------------------------------ //
+
+// _Bandwidth schedules transfers with a fixed rate. A nil _Bandwidth is unlimited.
+type _Bandwidth struct {
+	mux  *sync.Mutex // protect 'next'
+	bps  int64       // bytes per second
+	next time.Time   // end of the last scheduled transfer
+}
+
+// newBandwidth returns a new limit or nil if bps is unlimited (<= 0).
+func newBandwidth(bps int64) *_Bandwidth {
+	if bps <= 0 {
+		return nil
+	}
+	return &_Bandwidth{
+		mux: new(sync.Mutex),
+		bps: bps,
+	}
+}
+
+// reserve schedules the transfer of n bytes and returns the time at which it is done.
+// Transfers are queued: a new transfer starts after the end of the previous one.
+func (b *_Bandwidth) reserve(now time.Time, n int) time.Time {
+	if b == nil {
+		return now // unlimited
+	}
+
+	b.mux.Lock() // LOCK
+	defer b.mux.Unlock()
+
+	if b.next.Before(now) {
+		b.next = now
+	}
+	b.next = b.next.Add(time.Duration(int64(n) * int64(time.Second) / b.bps))
+	return b.next
+}
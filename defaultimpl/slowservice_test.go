@@ -0,0 +1,172 @@
+package impl_test
+
+import (
+	"bytes"
+	impl "github.com/SchnorcherSepp/storage/defaultimpl"
+	interf "github.com/SchnorcherSepp/storage/interfaces"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSlowService_Latency(t *testing.T) {
+	data, inner := newFaultyTestData(t)
+	f := inner.Files().All()[0]
+
+	clock := newFakeClock()
+	s := impl.NewSlowService(inner, impl.SlowConfig{
+		OpenLatency:   100 * time.Millisecond,
+		FirstByte:     50 * time.Millisecond,
+		ConnBandwidth: int64(len(data)), // 1 sec for the whole file
+		Clock:         clock,
+	}, impl.DebugOff)
+
+	// open
+	start := clock.Now()
+	r, err := s.Reader(f, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := clock.Now().Sub(start); d != 100*time.Millisecond {
+		t.Fatalf("wrong open latency: %v", d)
+	}
+
+	// read all
+	b, err := ioutil.ReadAll(r)
+	_ = r.Close()
+	if err != nil || !bytes.Equal(b, data) {
+		t.Fatalf("read error: %v", err)
+	}
+	if d := clock.Now().Sub(start); d < 1149*time.Millisecond || d > 1151*time.Millisecond {
+		t.Fatalf("wrong read time: %v", d)
+	}
+
+	// LimitedReader: half of the file
+	start = clock.Now()
+	r, err = s.LimitedReader(f, 0, int64(len(data)/2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ = ioutil.ReadAll(r)
+	_ = r.Close()
+	if d := clock.Now().Sub(start); len(b) != len(data)/2 || d < 649*time.Millisecond || d > 651*time.Millisecond {
+		t.Fatalf("wrong read time: %v", d)
+	}
+
+	// other methods pass through without delay
+	start = clock.Now()
+	if _, err := s.Save("b.dat", bytes.NewReader(data), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Update(); err != nil || len(s.Files().All()) != 2 || clock.Now() != start {
+		t.Fatalf("update error: %v", err)
+	}
+}
+
+func TestSlowService_ReaderAt(t *testing.T) {
+	_, inner := newFaultyTestData(t)
+	f := inner.Files().All()[0]
+
+	// very slow openings: the ReaderAt should reuse the connection
+	clock := newFakeClock()
+	s := impl.NewSlowService(inner, impl.SlowConfig{OpenLatency: time.Second, Clock: clock}, impl.DebugOff)
+
+	rAt, err := s.ReaderAt(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rAt.Close()
+
+	start := clock.Now()
+	buf := make([]byte, 1000)
+	for off := int64(0); off < f.Size()-1000; off += 2 * interf.SectorSize { // forward jumps
+		if _, err := rAt.ReadAt(buf, off); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d := clock.Now().Sub(start); d != time.Second || rAt.Stat()["RAtAdd"] != 1 {
+		t.Fatalf("wrong connection count: %v, %v", d, rAt.Stat())
+	}
+}
+
+func TestSlowService_DebugLvl(t *testing.T) {
+	_, inner := newFaultyTestData(t)
+
+	if logs := readerAtLogs(t, impl.NewSlowService(inner, impl.SlowConfig{}, impl.DebugOff)); logs != "" {
+		t.Fatalf("logs with DebugOff: %s", logs)
+	}
+	if logs := readerAtLogs(t, impl.NewSlowService(inner, impl.SlowConfig{}, impl.DebugLow)); !strings.Contains(logs, "PrintStatAfterClose") {
+		t.Fatalf("no logs with DebugLow: %s", logs)
+	}
+}
+
+func TestSlowReaderService_GlobalBandwidth(t *testing.T) {
+	data, inner := newFaultyTestData(t)
+	f := inner.Files().All()[0]
+
+	const bps = 2 * 1024 * 1024 // the file takes ~80ms
+	for _, global := range []bool{false, true} {
+		conf := impl.SlowConfig{ConnBandwidth: bps}
+		if global {
+			conf.GlobalBandwidth = bps
+		}
+		s := impl.NewSlowReaderService(inner, conf)
+
+		// two connections in parallel
+		start := time.Now()
+		var wg sync.WaitGroup
+		wg.Add(2)
+		for i := 0; i < 2; i++ {
+			go func() {
+				r, err := s.Reader(f, 0)
+				if err == nil {
+					b, _ := ioutil.ReadAll(r)
+					_ = r.Close()
+					if !bytes.Equal(b, data) {
+						t.Fail()
+					}
+				}
+				wg.Done()
+			}()
+		}
+		wg.Wait()
+		d := time.Since(start)
+
+		// global: the connections share the bandwidth
+		want := time.Duration(int64(len(data)) * int64(time.Second) / bps)
+		if global {
+			want *= 2
+		}
+		if d < want*9/10 {
+			t.Fatalf("too fast (global=%v): %v < %v", global, d, want)
+		}
+	}
+}
+
+//--------  HELPER  --------------------------------------------------------------------------------------------------//
+
+// _FakeClock is a virtual clock that only advances in Sleep().
+type _FakeClock struct {
+	mux *sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *_FakeClock {
+	return &_FakeClock{mux: new(sync.Mutex), now: time.Date(2020, 3, 18, 12, 0, 0, 0, time.UTC)}
+}
+
+func (c *_FakeClock) Now() time.Time {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.now
+}
+
+func (c *_FakeClock) Sleep(d time.Duration) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.now = c.now.Add(d)
+}
+
+var _ impl.Clock = (*_FakeClock)(nil)
@@ -1,12 +1,14 @@
 package impl
 
 import (
+	"context"
 	interf "github.com/SchnorcherSepp/storage/interfaces"
 	"io"
 )
 
-// interface check: interf.ReaderAt
+// interface check: interf.ReaderAt, interf.ContextReaderAt
 var _ interf.ReaderAt = (*_SubReaderAt)(nil)
+var _ interf.ContextReaderAt = (*_SubReaderAt)(nil)
 
 // @see interf.ReaderAt
 //
@@ -23,10 +25,11 @@ type _SubReaderAt struct {
 // No connections are made before the first call of ReadAt().
 // Is cache = nil, the cache is disabled.
 // The offset off is the part start point and n the part size.
-func NewSubReaderAt(file interf.File, service interf.ReaderService, cache interf.Cache, debugLvl uint8, off, n int64) (interf.ReaderAt, error) {
+// The options are optional (@see ReaderAtOption).
+func NewSubReaderAt(file interf.File, service interf.ReaderService, cache interf.Cache, debugLvl uint8, off, n int64, opts ...ReaderAtOption) (interf.ReaderAt, error) {
 
 	// get normal ReaderAt
-	rAt, err := NewReaderAt(file, service, cache, debugLvl)
+	rAt, err := NewReaderAt(file, service, cache, debugLvl, opts...)
 
 	// build SubReaderAt
 	return &_SubReaderAt{
@@ -43,8 +46,13 @@ func (r *_SubReaderAt) Close() error {
 
 // @see interf.ReaderAt
 func (r *_SubReaderAt) ReadAt(p []byte, off int64) (n int, err error) {
+	return r.ReadAtContext(context.Background(), p, off)
+}
+
+// @see interf.ContextReaderAt
+func (r *_SubReaderAt) ReadAtContext(ctx context.Context, p []byte, off int64) (n int, err error) {
 	// inner call
-	n, err = r.inner.ReadAt(p, r.off+off)
+	n, err = ReadAtContext(ctx, r.inner, p, r.off+off)
 
 	// check n (enforce limit)
 	startP := r.off + off
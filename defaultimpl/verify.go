@@ -0,0 +1,185 @@
+package impl
+
+import (
+	"crypto/md5"
+	"errors"
+	"fmt"
+	interf "github.com/SchnorcherSepp/storage/interfaces"
+	"hash"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+)
+
+// ChecksumError is returned if the md5 hash of the read data doesn't match File.Md5().
+type ChecksumError struct {
+	FileId string // the file id
+	Want   string // File.Md5()
+	Got    string // md5 hash of the read data
+}
+
+// Error returns the error message.
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("checksum mismatch of file '%s': want md5 %s, got %s", e.FileId, e.Want, e.Got)
+}
+
+// NewVerifiedReader opens the whole file and calculates the md5 hash while reading.
+// At the end of the file, the hash is compared with File.Md5(): Read() returns a *ChecksumError
+// instead of io.EOF if they don't match. Files with an unknown md5 (empty) aren't verified.
+// The connection must be closed manually with Close() after use.
+//
+// Example of use:
+//   r, err := impl.NewVerifiedReader(service, file)
+//   ...
+//   _, err = io.Copy(dst, r)
+//   if _, ok := err.(*impl.ChecksumError); ok { ... }
+func NewVerifiedReader(service interf.ReaderService, file interf.File) (io.ReadCloser, error) {
+	if file == nil || service == nil {
+		return nil, errors.New("can't verify with file=nil or service=nil")
+	}
+
+	var rc io.ReadCloser = ioutil.NopCloser(strings.NewReader("")) // empty file: nothing to read
+	if file.Size() > 0 {
+		var err error
+		if rc, err = service.Reader(file, 0); err != nil {
+			return nil, err
+		}
+	}
+	return &_VerifiedReader{rc: rc, v: newVerifier(file)}, nil
+}
+
+// _VerifiedReader is a connection that verifies the md5 hash at the end of the file.
+type _VerifiedReader struct {
+	rc  io.ReadCloser
+	v   *_Verifier // nil = unknown md5
+	off int64      // bytes read
+}
+
+// Read returns a *ChecksumError instead of io.EOF if the md5 hash doesn't match.
+func (r *_VerifiedReader) Read(p []byte) (int, error) {
+	n, err := r.rc.Read(p)
+	if r.v == nil {
+		return n, err
+	}
+
+	errV := r.v.write(p[:n], r.off)
+	r.off += int64(n)
+	if err == io.EOF && errV == nil {
+		errV = r.v.finish() // shorter than File.Size()
+	}
+	if errV != nil && errV != errVerified {
+		return n, errV
+	}
+	return n, err
+}
+
+// Close closes the connection.
+func (r *_VerifiedReader) Close() error {
+	return r.rc.Close()
+}
+
+//--------  VERIFIER  ------------------------------------------------------------------------------------------------//
+
+// errVerified is the result of a successful verification (internal).
+var errVerified = errors.New("verified")
+
+// verifyMaxPending is the max. number of bytes a _Verifier buffers ahead of the hashed data.
+// Data after a larger gap aren't verified until they are read again.
+const verifyMaxPending = 4 * 1024 * 1024
+
+// _Verifier hashes the contiguous data from offset 0 and compares the hash at the end of the file.
+// Data after a gap are buffered until the gap is filled (e.g. out-of-order reads of a ReaderAt).
+type _Verifier struct {
+	mux     *sync.Mutex // protect all
+	file    interf.File
+	hash    hash.Hash
+	off     int64            // the data [0, off) are hashed
+	done    bool             // the hash was compared
+	pending map[int64][]byte // offset -> data after a gap (copy)
+	size    int64            // sum of all pending data
+}
+
+// newVerifier returns nil if the md5 of the file is unknown.
+func newVerifier(file interf.File) *_Verifier {
+	if file.Md5() == "" {
+		return nil
+	}
+	return &_Verifier{
+		mux:     new(sync.Mutex),
+		file:    file,
+		hash:    md5.New(),
+		pending: make(map[int64][]byte),
+	}
+}
+
+// write hashes the new part of the data p at offset off (an overlap is no problem).
+// Data after a gap are buffered up to verifyMaxPending bytes and hashed when the gap is filled.
+// At the end of the file, the hash is compared: returns errVerified or a *ChecksumError (only once).
+// Returns nil before the end of the file.
+func (v *_Verifier) write(p []byte, off int64) error {
+	v.mux.Lock() // LOCK
+	defer v.mux.Unlock()
+
+	end := off + int64(len(p))
+	if v.done || end <= v.off {
+		return nil // done or old data
+	}
+
+	// gap: buffer the data
+	if off > v.off {
+		if old, ok := v.pending[off]; !ok || len(old) < len(p) {
+			if v.size+int64(len(p)-len(old)) <= verifyMaxPending {
+				v.pending[off] = append([]byte(nil), p...)
+				v.size += int64(len(p) - len(old))
+			}
+		}
+		return nil
+	}
+
+	// hash the new data and all pending data without a gap
+	v.hash.Write(p[v.off-off:])
+	v.off = end
+	for next := true; next; {
+		next = false
+		for pOff, b := range v.pending {
+			if pOff > v.off {
+				continue // gap
+			}
+			if pEnd := pOff + int64(len(b)); pEnd > v.off {
+				v.hash.Write(b[v.off-pOff:])
+				v.off = pEnd
+				next = true
+			}
+			delete(v.pending, pOff)
+			v.size -= int64(len(b))
+		}
+	}
+
+	if v.off < v.file.Size() {
+		return nil // not finished
+	}
+	return v.compare()
+}
+
+// finish compares the hash now (e.g. at an early end of the file). Returns nil after the first result.
+func (v *_Verifier) finish() error {
+	v.mux.Lock() // LOCK
+	defer v.mux.Unlock()
+
+	if v.done {
+		return nil
+	}
+	return v.compare()
+}
+
+// compare returns errVerified or a *ChecksumError. The caller must hold the lock.
+func (v *_Verifier) compare() error {
+	v.done = true
+	v.pending, v.size = nil, 0
+	got := fmt.Sprintf("%x", v.hash.Sum(nil))
+	if !strings.EqualFold(got, v.file.Md5()) {
+		return &ChecksumError{FileId: v.file.Id(), Want: v.file.Md5(), Got: got}
+	}
+	return errVerified
+}
@@ -0,0 +1,166 @@
+package impl_test
+
+import (
+	"bytes"
+	impl "github.com/SchnorcherSepp/storage/defaultimpl"
+	interf "github.com/SchnorcherSepp/storage/interfaces"
+	"io/ioutil"
+	"sync"
+	"testing"
+)
+
+func TestNewVerifiedReader(t *testing.T) {
+	data, s := newFaultyTestData(t)
+	f := s.Files().All()[0]
+
+	// valid
+	r, err := impl.NewVerifiedReader(s, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err := ioutil.ReadAll(r); err != nil || !bytes.Equal(b, data) {
+		t.Fatalf("read error: %v", err)
+	}
+	_ = r.Close()
+
+	// wrong md5
+	wrong := impl.NewFile(f.Id(), f.Name(), f.ModTime(), f.Size(), "00112233445566778899aabbccddeeff")
+	r, _ = impl.NewVerifiedReader(s, wrong)
+	b, err := ioutil.ReadAll(r)
+	if e, ok := err.(*impl.ChecksumError); !ok || e.Want != wrong.Md5() || e.Got != f.Md5() || e.FileId != f.Id() {
+		t.Fatalf("wrong error: %v", err)
+	}
+	if !bytes.Equal(b, data) {
+		t.Fatal("wrong data")
+	}
+	_ = r.Close()
+
+	// corrupt stream
+	fs := impl.NewFaultyService(s, impl.FaultPlan{Corrupt: impl.Fault{Probability: 1}}, impl.DebugOff)
+	r, _ = impl.NewVerifiedReader(fs, f)
+	if _, err := ioutil.ReadAll(r); err == nil {
+		t.Fatal("no error")
+	}
+	_ = r.Close()
+
+	// unknown md5
+	unknown := impl.NewFile(f.Id(), f.Name(), f.ModTime(), f.Size(), "")
+	r, _ = impl.NewVerifiedReader(s, unknown)
+	if _, err := ioutil.ReadAll(r); err != nil {
+		t.Fatal(err)
+	}
+	_ = r.Close()
+
+	// empty file
+	empty, _ := s.Save("empty.dat", bytes.NewReader(nil), 0)
+	_ = s.Update()
+	r, _ = impl.NewVerifiedReader(s, empty)
+	if b, err := ioutil.ReadAll(r); err != nil || len(b) != 0 {
+		t.Fatalf("read error: %v", err)
+	}
+	_ = r.Close()
+
+	// invalid input
+	if _, err := impl.NewVerifiedReader(nil, f); err == nil {
+		t.Fatal("no error with service=nil")
+	}
+}
+
+func TestWithVerify(t *testing.T) {
+	data, s := newFaultyTestData(t)
+	f := s.Files().All()[0]
+	half := int64(len(data) / 2)
+
+	// valid, any order
+	rAt, _ := impl.NewReaderAt(f, s, impl.NewCache(0), impl.DebugOff, impl.WithVerify())
+	b := make([]byte, len(data))
+	_, _ = rAt.ReadAt(b[half:], half) // gap
+	if rAt.Stat()["RAtVerify"] != 0 {
+		t.Fatalf("verified too early: %v", rAt.Stat())
+	}
+	if n, err := rAt.ReadAt(b[:half], 0); n != int(half) || err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	if st := rAt.Stat(); st["RAtVerify"] != 1 || st["RAtVerifyErr"] != 0 {
+		t.Fatalf("wrong stat: %v", st)
+	}
+	_ = rAt.Close()
+
+	// reverse order: the result comes with the first sector
+	wrong := impl.NewFile(f.Id(), f.Name(), f.ModTime(), f.Size(), "00112233445566778899aabbccddeeff")
+	for _, file := range []interf.File{f, wrong} {
+		rAt, _ = impl.NewReaderAt(file, s, nil, impl.DebugOff, impl.WithVerify())
+		var err error
+		for off := len(data) / interf.SectorSize * interf.SectorSize; off >= 0 && err == nil; off -= interf.SectorSize {
+			_, err = rAt.ReadAt(b[off:], int64(off))
+			if off > 0 && err != nil {
+				t.Fatalf("read error at %d: %v", off, err)
+			}
+		}
+		if _, ok := err.(*impl.ChecksumError); ok != (file == wrong) {
+			t.Fatalf("wrong error: %v", err)
+		}
+		if st := rAt.Stat(); st["RAtVerify"] != 1 || !bytes.Equal(b, data) {
+			t.Fatalf("wrong stat: %v", st)
+		}
+		_ = rAt.Close()
+	}
+
+	// wrong md5
+	rAt, _ = impl.NewReaderAt(wrong, s, nil, impl.DebugOff, impl.WithVerify())
+	for off := 0; off < len(data); off += interf.SectorSize {
+		n, err := rAt.ReadAt(b[:interf.SectorSize], int64(off))
+		if off+n < len(data) && err != nil {
+			t.Fatalf("read error: %v", err)
+		}
+		if off+n == len(data) {
+			if _, ok := err.(*impl.ChecksumError); !ok || n != 3 {
+				t.Fatalf("wrong error: n=%d, err=%v", n, err)
+			}
+		}
+	}
+	if st := rAt.Stat(); st["RAtVerify"] != 1 || st["RAtVerifyErr"] != 1 {
+		t.Fatalf("wrong stat: %v", st)
+	}
+	if _, err := rAt.ReadAt(b, 0); err != nil {
+		t.Fatalf("error after the verification: %v", err)
+	}
+	_ = rAt.Close()
+
+	// disabled
+	rAt, _ = impl.NewReaderAt(wrong, s, nil, impl.DebugOff)
+	if _, err := rAt.ReadAt(b, 0); err != nil || rAt.Stat()["RAtVerify"] != 0 {
+		t.Fatalf("verified without option: %v", err)
+	}
+	_ = rAt.Close()
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+
+func TestRace_Verify(t *testing.T) {
+	data, s := newFaultyTestData(t)
+	f := s.Files().All()[0]
+	rAt, _ := impl.NewReaderAt(f, s, impl.NewCache(0), impl.DebugOff, impl.WithVerify())
+	defer rAt.Close()
+
+	var wg sync.WaitGroup
+	wg.Add(5)
+	for n := 0; n < 5; n++ {
+		go func() {
+			//------------------------------
+			b := make([]byte, 5000)
+			for off := 0; off < len(data); off += len(b) {
+				if _, err := rAt.ReadAt(b, int64(off)); err != nil && off+len(b) < len(data) {
+					t.Error(err)
+				}
+			}
+			//------------------------------
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+
+	if st := rAt.Stat(); st["RAtVerify"] != 1 || st["RAtVerifyErr"] != 0 {
+		t.Fatalf("wrong stat: %v", st)
+	}
+}
@@ -2,6 +2,7 @@ package gdrive
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	impl "github.com/SchnorcherSepp/storage/defaultimpl"
@@ -15,8 +16,9 @@ import (
 	"time"
 )
 
-// interface check: interf.Service
+// interface check: interf.Service, interf.ContextService
 var _ interf.Service = (*_GService)(nil)
+var _ interf.ContextService = (*_GService)(nil)
 
 // _GService the central interface to access the Google Drive storage.
 // Must be created with NewService().
@@ -31,6 +33,7 @@ type _GService struct {
 	initialized    bool
 	startPageToken string
 	skipFullInit   bool
+	readerOpts     []impl.ReaderAtOption
 }
 
 // NewGService returns an interface to Google Drive. The parent specifies the folder
@@ -39,7 +42,8 @@ type _GService struct {
 // With skipFullInit = true, the init update call ends with a successful loading of indexCacheFile.
 // readerCache=nil disable the cache for ReaderAt() and MultiReaderAt()
 // debugLvl (@see impl.DebugHigh and impl.DebugOff)
-func NewGService(parent, indexCacheFile string, skipFullInit bool, oauth *google.Service, readerCache interf.Cache, debugLvl uint8) interf.Service {
+// readerOpts are used for ReaderAt() and MultiReaderAt() (@see impl.ReaderAtOption)
+func NewGService(parent, indexCacheFile string, skipFullInit bool, oauth *google.Service, readerCache interf.Cache, debugLvl uint8, readerOpts ...impl.ReaderAtOption) interf.Service {
 	s := &_GService{
 		google:         oauth,
 		parent:         parent,
@@ -51,6 +55,7 @@ func NewGService(parent, indexCacheFile string, skipFullInit bool, oauth *google
 		initialized:    false,
 		startPageToken: "",
 		skipFullInit:   skipFullInit,
+		readerOpts:     readerOpts,
 	}
 
 	// root fix: replace root alias with valid folder id
@@ -77,14 +82,23 @@ func NewGService(parent, indexCacheFile string, skipFullInit bool, oauth *google
 // Folders and sub-folders are ignored. This method is very slow on the first call!
 // This method is thread-safe.
 func (s *_GService) Update() error {
+	return s.UpdateContext(context.Background())
+}
+
+// UpdateContext is the implementation of ContextService.UpdateContext()
+//
+// UpdateContext behaves like Update, but the cancellation of ctx aborts the running request.
+// The internal file index is unchanged after an aborted update.
+// This method is thread-safe.
+func (s *_GService) UpdateContext(ctx context.Context) error {
 	s.mux.RLock() // READ Lock
 	bl := s.initialized
 	s.mux.RUnlock()
 
 	if bl {
-		return s.updateFiles() // thread safe
+		return s.updateFiles(ctx) // thread safe
 	} else {
-		return s.initFiles() // thread safe
+		return s.initFiles(ctx) // thread safe
 	}
 }
 
@@ -112,6 +126,14 @@ func (s *_GService) Files() interf.Files {
 // Don't forget to call Update().
 // This method is thread-safe.
 func (s *_GService) Save(name string, r io.Reader, max int64) (file interf.File, err error) {
+	return s.SaveContext(context.Background(), name, r, max)
+}
+
+// SaveContext is the implementation of ContextService.SaveContext()
+//
+// SaveContext behaves like Save, but the cancellation of ctx aborts the upload.
+// This method is thread-safe.
+func (s *_GService) SaveContext(ctx context.Context, name string, r io.Reader, max int64) (file interf.File, err error) {
 	name = strings.TrimSpace(name)
 	if name == "" || r == nil {
 		return nil, errors.New("invalid input")
@@ -128,7 +150,7 @@ func (s *_GService) Save(name string, r io.Reader, max int64) (file interf.File,
 	if max > 0 {
 		r = io.LimitReader(r, max)
 	}
-	f, err = s.google.Files.Create(f).Media(r).Do()
+	f, err = s.google.Files.Create(f).Media(r).Context(ctx).Do()
 
 	// request error
 	if err != nil {
@@ -159,6 +181,9 @@ func (s *_GService) Trash(file interf.File) error {
 	}
 
 	_, err := s.google.Files.Update(id, &google.File{Trashed: true}).Do() // thread safe
+	if err == nil && s.readerCache != nil {
+		s.readerCache.InvalidateFile(impl.ScopedFileId(id, s.readerOpts...)) // remove stale sectors
+	}
 	return err
 }
 
@@ -168,12 +193,27 @@ func (s *_GService) Reader(file interf.File, off int64) (io.ReadCloser, error) {
 	return s.LimitedReader(file, off, interf.MaxFileSize)
 }
 
+// ReaderContext is the implementation of ContextReaderService.ReaderContext()
+// Delegate to LimitedReaderContext with n=interf.MaxFileSize
+func (s *_GService) ReaderContext(ctx context.Context, file interf.File, off int64) (io.ReadCloser, error) {
+	return s.LimitedReaderContext(ctx, file, off, interf.MaxFileSize)
+}
+
 // LimitedReader is the implementation of Service.LimitedReader()
 //
 // Reader enables read access to a file identified by the file id.
 // The connection must be closed manually with Close() after use.
 // This method is thread-safe.
 func (s *_GService) LimitedReader(file interf.File, off int64, n int64) (io.ReadCloser, error) {
+	return s.LimitedReaderContext(context.Background(), file, off, n)
+}
+
+// LimitedReaderContext is the implementation of ContextReaderService.LimitedReaderContext()
+//
+// LimitedReaderContext behaves like LimitedReader, but the request is bound to ctx:
+// the cancellation of ctx aborts the download and a blocked Read() of the body returns an error.
+// This method is thread-safe.
+func (s *_GService) LimitedReaderContext(ctx context.Context, file interf.File, off int64, n int64) (io.ReadCloser, error) {
 	if n < 1 {
 		// n = 0 -> no data requested -> return nothing
 		return ioutil.NopCloser(bytes.NewReader([]byte{})), nil
@@ -187,7 +227,7 @@ func (s *_GService) LimitedReader(file interf.File, off int64, n int64) (io.Read
 	get := s.google.Files.Get(id)
 	get.Header().Set("Range", fmt.Sprintf("bytes=%d-%d", off, off+n-1))
 
-	resp, err := get.Download()
+	resp, err := get.Context(ctx).Download()
 	if err != nil {
 		return nil, err
 	}
@@ -196,7 +236,7 @@ func (s *_GService) LimitedReader(file interf.File, off int64, n int64) (io.Read
 
 // ReaderAt is the implementation of Service.ReaderAt()
 func (s *_GService) ReaderAt(file interf.File) (interf.ReaderAt, error) {
-	return impl.NewReaderAt(file, s, s.readerCache, s.debugLvl)
+	return impl.NewReaderAt(file, s, s.readerCache, s.debugLvl, s.readerOpts...)
 }
 
 // MultiReaderAt is the implementation of Service.MultiReaderAt()
@@ -206,7 +246,7 @@ func (s *_GService) MultiReaderAt(list []interf.File) (interf.ReaderAt, error) {
 		return s.ReaderAt(list[0])
 	} else {
 		// MultiReaderAt
-		return impl.NewMultiReaderAt(list, s, s.readerCache, s.debugLvl)
+		return impl.NewMultiReaderAt(list, s, s.readerCache, s.debugLvl, s.readerOpts...)
 	}
 }
 
@@ -221,7 +261,7 @@ func (s *_GService) Cache() interf.Cache {
 // Folders and files from sub folders are ignored. This method can be VERY SLOW, but must be called
 // at least once when the program starts! After that you should work with updateFiles().
 // To speed up the initialization at program start, data from the indexcache file can be used.
-func (s *_GService) initFiles() error {
+func (s *_GService) initFiles(ctx context.Context) error {
 
 	// use indexcache
 	// loading the last state allows to speed up the process
@@ -239,7 +279,7 @@ func (s *_GService) initFiles() error {
 	s.mux.RUnlock() // <------------ R UNLOCK
 
 	if token != "" {
-		err := s.updateFiles() // thread safe
+		err := s.updateFiles(ctx) // thread safe
 		if err != nil {
 			log.Printf("ERROR: %s/initFiles: UpdateFileList() failed with indexcache: %v", packageName, err)
 		} else {
@@ -268,7 +308,7 @@ func (s *_GService) initFiles() error {
 	query := fmt.Sprintf("trashed = false and mimeType != '%s' and '%s' in parents", folderMimeType, s.parent)
 
 	// get a new StartPageToken to watch changes
-	startPageTokenObj, err := s.google.Changes.GetStartPageToken().Do() // thread safe
+	startPageTokenObj, err := s.google.Changes.GetStartPageToken().Context(ctx).Do() // thread safe
 	if err != nil {
 		log.Printf("ERROR: %s/initFiles: can't get StartPageToken: %v", packageName, err)
 		return err
@@ -284,7 +324,7 @@ func (s *_GService) initFiles() error {
 		// read a result page
 		fileList, err := s.google.Files.List().Q(query).PageToken(pageToken).
 			Spaces(spaces).Corpora(corpora).PageSize(int64(pageSize)).
-			Fields(fields).Do() // thread safe
+			Fields(fields).Context(ctx).Do() // thread safe
 
 		// error handling
 		if err != nil {
@@ -307,6 +347,7 @@ func (s *_GService) initFiles() error {
 
 	// FIN: set new list, save indexcache and return
 	s.mux.Lock() // <-------------- LOCK
+	old := s.files
 	s.files = impl.NewFiles(newList)
 	s.initialized = true
 	err = cacheSave(s, s.files)
@@ -315,6 +356,7 @@ func (s *_GService) initFiles() error {
 	if err != nil {
 		log.Printf("ERROR: %s/initFiles: cacheSave() failed: %v", packageName, err)
 	}
+	impl.InvalidateChanged(s.readerCache, old, s.Files(), s.readerOpts...) // remove stale sectors
 	return nil
 }
 
@@ -322,7 +364,7 @@ func (s *_GService) initFiles() error {
 
 // updateFiles only queries a delta of the internal file list of google drive.
 // This makes the function much faster than initFiles().
-func (s *_GService) updateFiles() error {
+func (s *_GService) updateFiles(ctx context.Context) error {
 
 	// check startPageToken
 	s.mux.RLock() // <-------------- R LOCK
@@ -354,7 +396,7 @@ func (s *_GService) updateFiles() error {
 	// loop to get all changes
 	for {
 		// read a result pages
-		changeList, err := s.google.Changes.List(pageToken).Spaces(spaces).PageSize(int64(pageSize)).Fields(fields).Do() // thread safe
+		changeList, err := s.google.Changes.List(pageToken).Spaces(spaces).PageSize(int64(pageSize)).Fields(fields).Context(ctx).Do() // thread safe
 		if err != nil {
 			log.Printf("ERROR: %s/updateFiles: can't read all result pages: %v", packageName, err)
 			return err
@@ -394,15 +436,17 @@ func (s *_GService) updateFiles() error {
 
 	//-----  THREAD SAFE  ----------------------------------------------------------------------
 	s.mux.Lock() // LOCK
-	defer s.mux.Unlock()
-
+	old := s.files
 	s.startPageToken = pageToken
 	s.files = impl.NewFiles(fileList)
 
 	// write new state to indexcache file
 	err := cacheSave(s, s.files)
+	s.mux.Unlock() // UNLOCK
+
 	if err != nil {
 		log.Printf("ERROR: %s/updateFiles: cacheSave() failed: %v", packageName, err)
 	}
+	impl.InvalidateChanged(s.readerCache, old, s.Files(), s.readerOpts...) // remove stale sectors
 	return nil
 }
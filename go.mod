@@ -1,10 +1,13 @@
 module github.com/SchnorcherSepp/storage
 
-		go 1.16
+go 1.16
 
-		require (
-		github.com/coocood/freecache v1.1.1
-		github.com/oxtoacart/bpool v0.0.0-20190530202638-03653db5a59c
-		golang.org/x/oauth2 v0.0.0-20210628180205-a41e5a781914
-		google.golang.org/api v0.50.0
-		)
+require (
+	github.com/coocood/freecache v1.1.1
+	github.com/oxtoacart/bpool v0.0.0-20190530202638-03653db5a59c
+	github.com/pkg/sftp v1.13.4
+	golang.org/x/crypto v0.0.0-20210421170649-83a5a9bb288b
+	golang.org/x/net v0.0.0-20210503060351-7fd8e65b6420
+	golang.org/x/oauth2 v0.0.0-20210628180205-a41e5a781914
+	google.golang.org/api v0.50.0
+)
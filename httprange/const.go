@@ -0,0 +1,4 @@
+package httprange
+
+// packageName is used for debug and error messages
+const packageName = "httprange"
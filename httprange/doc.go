@@ -0,0 +1,6 @@
+/*
+Package httprange provides a read-only storage service implementation for static web servers and CDN mirrors.
+The file index is loaded from a JSON or CSV manifest and the data is read with HTTP range requests.
+
+*/
+package httprange
@@ -0,0 +1,367 @@
+package httprange
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	impl "github.com/SchnorcherSepp/storage/defaultimpl"
+	interf "github.com/SchnorcherSepp/storage/interfaces"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// interface check: interf.Service
+var _ interf.Service = (*_HttpService)(nil)
+
+// ReadOnlyError is returned by all write methods (Save, Trash) of the read-only service.
+type ReadOnlyError struct {
+	Op string // the rejected method, e.g. 'Save'
+}
+
+func (e *ReadOnlyError) Error() string {
+	return fmt.Sprintf("%s/%s: read-only service", packageName, e.Op)
+}
+
+// ManifestEntry is a single file of the manifest.
+//
+// JSON: a list of entries or an object with the list in 'files'
+//   [{"id": "1", "name": "a.dat", "size": 5, "md5": "...", "url": "data/a.dat", "modTime": 1584535538}]
+//
+// CSV: the first line is the header (the column order is free, modTime is optional)
+//   id,name,size,md5,url,modTime
+//
+// Relative urls are resolved against the manifest url. If id is empty, the url is the id.
+type ManifestEntry struct {
+	Id      string `json:"id"`
+	Name    string `json:"name"`
+	Size    int64  `json:"size"`
+	Md5     string `json:"md5"`
+	Url     string `json:"url"`
+	ModTime int64  `json:"modTime"` // unix time; 0 = unknown
+}
+
+// _HttpService is a read-only service for static web servers.
+// Must be created with NewHttpService().
+type _HttpService struct {
+	manifest    string
+	client      *http.Client
+	readerCache interf.Cache
+	debugLvl    uint8
+	mux         *sync.RWMutex         // protect 'files' and 'urls'
+	files       interf.Files          // set by Update()
+	urls        map[string]string     // file id -> absolute url
+	readerOpts  []impl.ReaderAtOption // for ReaderAt() and MultiReaderAt()
+}
+
+// NewHttpService returns a read-only interface to the files of the manifest.
+// The manifest (JSON or CSV, @see ManifestEntry) is loaded with Update().
+// client=nil uses http.DefaultClient.
+// readerCache=nil disable the cache for ReaderAt() and MultiReaderAt()
+// debugLvl (@see impl.DebugHigh and impl.DebugOff)
+// readerOpts are used for ReaderAt() and MultiReaderAt() (@see impl.ReaderAtOption)
+func NewHttpService(manifestUrl string, client *http.Client, readerCache interf.Cache, debugLvl uint8, readerOpts ...impl.ReaderAtOption) interf.Service {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &_HttpService{
+		manifest:    manifestUrl,
+		client:      client,
+		readerCache: readerCache,
+		debugLvl:    debugLvl,
+		mux:         new(sync.RWMutex),
+		files:       impl.NewFiles(nil), // empty list, set by Update()
+		urls:        make(map[string]string),
+		readerOpts:  readerOpts,
+	}
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+
+// Update is the implementation of Service.Update()
+//
+// Update downloads and parses the manifest.
+// This method is thread-safe.
+func (s *_HttpService) Update() error {
+	base, err := url.Parse(s.manifest)
+	if err != nil {
+		return err
+	}
+
+	// download
+	resp, err := s.client.Get(s.manifest)
+	if err != nil {
+		log.Printf("ERROR: %s/Update: %v", packageName, err)
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("%s/Update: manifest: http %d", packageName, resp.StatusCode)
+		log.Printf("ERROR: %v", err)
+		return err
+	}
+
+	// parse
+	entries, err := parseManifest(resp.Body)
+	if err != nil {
+		log.Printf("ERROR: %s/Update: invalid manifest: %v", packageName, err)
+		return err
+	}
+
+	// build index
+	byId := make(map[string]interf.File)
+	urls := make(map[string]string)
+	for _, e := range entries {
+		ref, err := url.Parse(strings.TrimSpace(e.Url))
+		if err != nil || e.Url == "" {
+			log.Printf("WARNING: %s/Update: skip entry with invalid url '%s'", packageName, e.Url)
+			continue
+		}
+		abs := base.ResolveReference(ref).String()
+
+		id := e.Id
+		if id == "" {
+			id = abs
+		}
+		name := e.Name
+		if name == "" {
+			name = id
+		}
+		byId[id] = impl.NewFile(id, name, e.ModTime, e.Size, strings.ToLower(e.Md5)) // modTime 0 = unknown (stable)
+		urls[id] = abs
+	}
+	log.Printf("INFO: %s/Update: successful file update (%d files)", packageName, len(byId))
+
+	// set new index
+	s.mux.Lock() // LOCK
+	old := s.files
+	s.files = impl.NewFiles(byId)
+	s.urls = urls
+	s.mux.Unlock() // UNLOCK
+
+	impl.InvalidateChanged(s.readerCache, old, s.Files(), s.readerOpts...) // remove stale sectors
+	return nil
+}
+
+// Files is the implementation of Service.Files()
+//
+// Files returns all available files.
+// This method is offline and does not trigger a connection to the server.
+// The internal file index must be updated separately with Update().
+// This method is thread-safe.
+func (s *_HttpService) Files() interf.Files {
+	s.mux.RLock() // READ Lock
+	defer s.mux.RUnlock()
+
+	return s.files
+}
+
+// Save is the implementation of Service.Save()
+// The service is read-only and always returns *ReadOnlyError.
+func (s *_HttpService) Save(_ string, _ io.Reader, _ int64) (interf.File, error) {
+	return nil, &ReadOnlyError{Op: "Save"}
+}
+
+// Trash is the implementation of Service.Trash()
+// The service is read-only and always returns *ReadOnlyError.
+func (s *_HttpService) Trash(_ interf.File) error {
+	return &ReadOnlyError{Op: "Trash"}
+}
+
+// Reader is the implementation of Service.Reader()
+//
+// Reader enables read access to a file identified by the file id (GET with range).
+// The connection must be closed manually with Close() after use.
+// This method is thread-safe.
+func (s *_HttpService) Reader(file interf.File, off int64) (io.ReadCloser, error) {
+	return s.get(file, off, -1)
+}
+
+// LimitedReader is the implementation of Service.LimitedReader()
+//
+// LimitedReader enables read access to a file identified by the file id (GET with range),
+// but stops with EOF after n bytes.
+// The connection must be closed manually with Close() after use.
+// This method is thread-safe.
+func (s *_HttpService) LimitedReader(file interf.File, off int64, n int64) (io.ReadCloser, error) {
+	if n < 1 {
+		// n = 0 -> no data requested -> return nothing
+		return ioutil.NopCloser(bytes.NewReader([]byte{})), nil
+	}
+	return s.get(file, off, n)
+}
+
+// ReaderAt is the implementation of Service.ReaderAt()
+func (s *_HttpService) ReaderAt(file interf.File) (interf.ReaderAt, error) {
+	return impl.NewReaderAt(file, s, s.readerCache, s.debugLvl, s.readerOpts...)
+}
+
+// MultiReaderAt is the implementation of Service.MultiReaderAt()
+func (s *_HttpService) MultiReaderAt(list []interf.File) (interf.ReaderAt, error) {
+	if len(list) == 1 {
+		// use the normal ReaderAt for single files
+		return s.ReaderAt(list[0])
+	} else {
+		// MultiReaderAt
+		return impl.NewMultiReaderAt(list, s, s.readerCache, s.debugLvl, s.readerOpts...)
+	}
+}
+
+// Cache returns the internal cache instance. Can be NIL.
+func (s *_HttpService) Cache() interf.Cache {
+	return s.readerCache
+}
+
+//---------  Helper  -------------------------------------------------------------------------------------------------//
+
+// get opens a GET request with a range header (n=-1: until the end of the file).
+// A range behind the end of the file returns io.EOF.
+// If the server ignores the range header, the skipped data is read and discarded.
+func (s *_HttpService) get(file interf.File, off, n int64) (io.ReadCloser, error) {
+	if file == nil {
+		return nil, errors.New("nil file")
+	}
+
+	// get url
+	s.mux.RLock() // READ Lock
+	u, ok := s.urls[file.Id()]
+	s.mux.RUnlock()
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+
+	// request
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if n > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", off, off+n-1))
+	} else {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", off))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		return resp.Body, nil
+
+	case http.StatusOK:
+		// the server ignores the range
+		if _, err := io.CopyN(ioutil.Discard, resp.Body, off); err != nil {
+			_ = resp.Body.Close()
+			return nil, err // io.EOF if off is behind the end of the file
+		}
+		if n > 0 {
+			return impl.NewLimitedReadCloser(resp.Body, n), nil
+		}
+		return resp.Body, nil
+
+	case http.StatusRequestedRangeNotSatisfiable:
+		_ = resp.Body.Close()
+		return nil, io.EOF
+
+	case http.StatusNotFound:
+		_ = resp.Body.Close()
+		return nil, os.ErrNotExist
+
+	default:
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("%s/get: '%s': http %d", packageName, u, resp.StatusCode)
+	}
+}
+
+// parseManifest detects the format (JSON or CSV) and parses the manifest.
+func parseManifest(r io.Reader) ([]ManifestEntry, error) {
+	br := bufio.NewReader(r)
+
+	// detect format: first non-space char
+	var first byte
+	for {
+		b, err := br.ReadByte()
+		if err == io.EOF {
+			return nil, nil // empty manifest
+		}
+		if err != nil {
+			return nil, err
+		}
+		if b != ' ' && b != '\t' && b != '\r' && b != '\n' && b != 0xef && b != 0xbb && b != 0xbf { // skip BOM
+			first = b
+			_ = br.UnreadByte()
+			break
+		}
+	}
+
+	// JSON
+	if first == '[' {
+		var list []ManifestEntry
+		err := json.NewDecoder(br).Decode(&list)
+		return list, err
+	}
+	if first == '{' {
+		var obj struct {
+			Files []ManifestEntry `json:"files"`
+		}
+		err := json.NewDecoder(br).Decode(&obj)
+		return obj.Files, err
+	}
+
+	// CSV
+	cr := csv.NewReader(br)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	// header
+	col := make(map[string]int)
+	for i, h := range records[0] {
+		col[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	if _, ok := col["url"]; !ok {
+		return nil, errors.New("csv manifest without 'url' column")
+	}
+	get := func(rec []string, name string) string {
+		if i, ok := col[strings.ToLower(name)]; ok && i < len(rec) {
+			return strings.TrimSpace(rec[i])
+		}
+		return ""
+	}
+
+	// entries
+	list := make([]ManifestEntry, 0, len(records)-1)
+	for _, rec := range records[1:] {
+		size, err := strconv.ParseInt(get(rec, "size"), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid size in line %v: %v", rec, err)
+		}
+		modTime, _ := strconv.ParseInt(get(rec, "modTime"), 10, 64)
+		list = append(list, ManifestEntry{
+			Id:      get(rec, "id"),
+			Name:    get(rec, "name"),
+			Size:    size,
+			Md5:     get(rec, "md5"),
+			Url:     get(rec, "url"),
+			ModTime: modTime,
+		})
+	}
+	return list, nil
+}
@@ -0,0 +1,216 @@
+package httprange_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	impl "github.com/SchnorcherSepp/storage/defaultimpl"
+	"github.com/SchnorcherSepp/storage/httprange"
+	interf "github.com/SchnorcherSepp/storage/interfaces"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHttpService_JSON(t *testing.T) {
+	srv, data := newTestServer(t)
+	s := httprange.NewHttpService(srv.URL+"/manifest.json", nil, impl.NewCache(1), impl.DebugOff)
+
+	// empty index
+	if len(s.Files().All()) != 0 {
+		t.Fatal("index not empty")
+	}
+
+	// update
+	if err := s.Update(); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Files().All()) != 3 {
+		t.Fatalf("wrong file count: %d", len(s.Files().All()))
+	}
+	f, err := s.Files().ById("1")
+	if err != nil || f.Name() != "a.dat" || f.Size() != int64(len(data)) || f.ModTime() != 1584535538 || f.Md5() != "abc" {
+		t.Fatalf("wrong index: %v", err)
+	}
+	if f, err := s.Files().ById(srv.URL + "/data/b.dat"); err != nil || f.Name() != srv.URL+"/data/b.dat" {
+		t.Fatalf("wrong index: %v", err)
+	}
+
+	testRead(t, s, data)
+}
+
+func TestHttpService_CSV(t *testing.T) {
+	srv, data := newTestServer(t)
+	s := httprange.NewHttpService(srv.URL+"/manifest.csv", nil, nil, impl.DebugOff)
+
+	if err := s.Update(); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Files().All()) != 3 {
+		t.Fatalf("wrong file count: %d", len(s.Files().All()))
+	}
+	f, err := s.Files().ByName("a.dat")
+	if err != nil || f.Id() != "1" || f.Size() != int64(len(data)) || f.ModTime() != 1584535538 {
+		t.Fatalf("wrong index: %v", err)
+	}
+	if f, err := s.Files().ById("3"); err != nil || f.ModTime() != 0 { // unknown (not the manifest time)
+		t.Fatalf("wrong modTime: %v", err)
+	}
+
+	testRead(t, s, data)
+}
+
+func TestHttpService_KeepCache(t *testing.T) {
+	srv, data := newTestServer(t)
+	c := impl.NewCache(0)
+	s := httprange.NewHttpService(srv.URL+"/changed.json", nil, c, impl.DebugOff)
+	if err := s.Update(); err != nil {
+		t.Fatal(err)
+	}
+
+	// fill cache
+	f, _ := s.Files().ById("3")
+	rAt, _ := s.ReaderAt(f)
+	if _, err := rAt.ReadAt(make([]byte, 10), 0); err != nil {
+		t.Fatal(err)
+	}
+	_ = rAt.Close()
+
+	// a new Last-Modified of the manifest doesn't change the files
+	if err := s.Update(); err != nil {
+		t.Fatal(err)
+	}
+	if f, _ := s.Files().ById("3"); f.ModTime() != 0 || f.Size() != int64(len(data)) {
+		t.Fatalf("wrong index: %v", f)
+	}
+	if n := c.Stats().Entries; n != 1 {
+		t.Fatalf("cache flushed: %d entries", n)
+	}
+}
+
+func TestHttpService_ReadOnly(t *testing.T) {
+	srv, _ := newTestServer(t)
+	s := httprange.NewHttpService(srv.URL+"/manifest.json", nil, nil, impl.DebugOff)
+
+	var roErr *httprange.ReadOnlyError
+	if _, err := s.Save("x", strings.NewReader("x"), 0); !errors.As(err, &roErr) || roErr.Op != "Save" {
+		t.Fatalf("wrong error: %v", err)
+	}
+	if err := s.Trash(impl.NewFile("1", "a.dat", 0, 0, "")); !errors.As(err, &roErr) || roErr.Op != "Trash" {
+		t.Fatalf("wrong error: %v", err)
+	}
+}
+
+func TestHttpService_InvalidManifest(t *testing.T) {
+	srv, _ := newTestServer(t)
+
+	for _, m := range []string{"/missing.json", "/invalid.json", "/invalid.csv"} {
+		s := httprange.NewHttpService(srv.URL+m, nil, nil, impl.DebugOff)
+		if err := s.Update(); err == nil {
+			t.Fatalf("no error with %s", m)
+		}
+	}
+}
+
+//--------  HELPER  --------------------------------------------------------------------------------------------------//
+
+var testModTime = time.Date(2020, 3, 18, 12, 0, 0, 0, time.UTC)
+
+func testRead(t *testing.T, s interf.Service, data []byte) {
+	for _, id := range []string{"1", "3"} { // '3' ignores range requests
+		f, err := s.Files().ById(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// LimitedReader
+		r, err := s.LimitedReader(f, 1, 16)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(r)
+		_ = r.Close()
+		if err != nil || !bytes.Equal(b, data[1:17]) {
+			t.Fatalf("read error: %v", err)
+		}
+
+		// Reader over EOF
+		if _, err := s.Reader(f, int64(len(data))+1); err != io.EOF {
+			t.Fatalf("wrong error: %v", err)
+		}
+
+		// ReaderAt
+		rAt, err := s.ReaderAt(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, 100)
+		for _, off := range []int64{0, 100000, int64(len(data)) - 50, 77777} {
+			n, err := rAt.ReadAt(buf, off)
+			end := off + int64(n)
+			if err != nil && end != int64(len(data)) || !bytes.Equal(buf[:n], data[off:end]) {
+				t.Fatalf("ReadAt error: off=%d, n=%d, err=%v", off, n, err)
+			}
+		}
+		_ = rAt.Close()
+	}
+
+	// unknown file
+	if _, err := s.Reader(impl.NewFile("unknown", "", 0, 0, ""), 0); err != os.ErrNotExist {
+		t.Fatalf("wrong error: %v", err)
+	}
+}
+
+// newTestServer serves the manifests and the test data:
+//   /data/a.dat    (range support)
+//   /data/b.dat    (range support)
+//   /norange/a.dat (without range support)
+func newTestServer(t *testing.T) (*httptest.Server, []byte) {
+	data := make([]byte, 300*1024+3)
+	rand.New(rand.NewSource(1337)).Read(data)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/data/", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "data", testModTime, bytes.NewReader(data))
+	})
+	mux.HandleFunc("/norange/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(data)
+	})
+	mux.HandleFunc("/manifest.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Last-Modified", testModTime.Format(http.TimeFormat))
+		_, _ = fmt.Fprintf(w, `{"files": [
+			{"id": "1", "name": "a.dat", "size": %d, "md5": "ABC", "url": "data/a.dat", "modTime": 1584535538},
+			{"url": "/data/b.dat", "size": %d},
+			{"id": "3", "name": "c.dat", "size": %d, "url": "norange/a.dat"}
+		]}`, len(data), len(data), len(data))
+	})
+	mux.HandleFunc("/manifest.csv", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Last-Modified", testModTime.Format(http.TimeFormat))
+		_, _ = fmt.Fprintf(w, "name,id,size,md5,url,modTime\n"+
+			"a.dat,1,%d,abc,data/a.dat,1584535538\n"+
+			"b.dat,2,%d,,data/b.dat,\n"+
+			"c.dat,3,%d,,norange/a.dat,\n", len(data), len(data), len(data))
+	})
+	lastMod := testModTime
+	mux.HandleFunc("/changed.json", func(w http.ResponseWriter, r *http.Request) {
+		lastMod = lastMod.Add(time.Hour) // new Last-Modified with every request
+		w.Header().Set("Last-Modified", lastMod.Format(http.TimeFormat))
+		_, _ = fmt.Fprintf(w, `[{"id": "3", "name": "c.dat", "size": %d, "url": "norange/a.dat"}]`, len(data))
+	})
+	mux.HandleFunc("/invalid.json", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[{"id": 1}`))
+	})
+	mux.HandleFunc("/invalid.csv", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("id,name\n1,a.dat\n"))
+	})
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv, data
+}
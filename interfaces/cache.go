@@ -26,4 +26,28 @@ type Cache interface {
 
 	// Size returns the max. capacity of this cache in bytes.
 	Size() int64
+
+	// InvalidateFile removes all sectors of the file from the cache.
+	// Services call this method if a file is trashed or changed (@see impl.InvalidateChanged).
+	// A file id with a namespace removes only the sectors of the namespace (@see impl.ScopedFileId).
+	// Returns the number of removed sectors.
+	InvalidateFile(fileId string) int
+
+	// Stats returns the current statistics of this cache.
+	// Caches without an own index (e.g. impl.NewCache) return only the counters without Bytes and Files,
+	// because they would have to iterate over all entries (@see impl.FullStats).
+	Stats() CacheStats
+}
+
+// CacheStats is a snapshot of the cache statistics (@see Cache.Stats).
+// The counters are collected since the creation of the cache.
+type CacheStats struct {
+	Entries     int64            // number of stored sectors
+	Bytes       int64            // sum of all stored sector sizes
+	Hits        int64            // successful Get() calls
+	Misses      int64            // failed Get() calls
+	HitRate     float64          // Hits / (Hits + Misses)
+	Evictions   int64            // sectors removed because the cache was full
+	Expirations int64            // sectors removed because they expired (@see CacheExpireSeconds)
+	Files       map[string]int64 // file id -> number of stored sectors
 }
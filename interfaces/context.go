@@ -0,0 +1,48 @@
+package interf
+
+import (
+	"context"
+	"io"
+)
+
+// ContextReaderService is an optional interface of ReaderService with context-aware variants.
+// The helper functions of the default implementation (e.g. impl.ReaderContext) use these methods if available.
+type ContextReaderService interface {
+
+	// ReaderContext behaves like ReaderService.Reader, but the cancellation of ctx
+	// aborts the request and closes the connection (a blocked Read returns an error).
+	// This method is thread-safe.
+	ReaderContext(ctx context.Context, file File, off int64) (io.ReadCloser, error)
+
+	// LimitedReaderContext behaves like ReaderService.LimitedReader, but the cancellation of ctx
+	// aborts the request and closes the connection (a blocked Read returns an error).
+	// This method is thread-safe.
+	LimitedReaderContext(ctx context.Context, file File, off int64, n int64) (io.ReadCloser, error)
+}
+
+// ContextService is an optional interface of Service with context-aware variants.
+type ContextService interface {
+
+	// ContextReaderService implements
+	// - ReaderContext
+	// - LimitedReaderContext
+	ContextReaderService
+
+	// UpdateContext behaves like Service.Update, but the cancellation of ctx aborts the update.
+	// The internal file index is unchanged after an aborted update.
+	// This method is thread-safe.
+	UpdateContext(ctx context.Context) error
+
+	// SaveContext behaves like Service.Save, but the cancellation of ctx aborts the upload.
+	// This method is thread-safe.
+	SaveContext(ctx context.Context, name string, r io.Reader, max int64) (file File, err error)
+}
+
+// ContextReaderAt is an optional interface of ReaderAt with a context-aware variant.
+type ContextReaderAt interface {
+
+	// ReadAtContext behaves like ReaderAt.ReadAt, but the cancellation of ctx aborts the read
+	// and closes the internal connection. Returns ctx.Err() if the read was aborted.
+	// This method is thread-safe.
+	ReadAtContext(ctx context.Context, p []byte, off int64) (n int, err error)
+}
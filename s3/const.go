@@ -0,0 +1,17 @@
+package s3
+
+// packageName is used for debug and error messages
+const packageName = "s3"
+
+// MinPartSize is the smallest part size of a multipart upload (S3 limit, except for the last part).
+const MinPartSize = 5 * 1024 * 1024 // 5 MiB
+
+// DefaultPartSize is used if Config.PartSize is not set.
+// Save() uploads streams with a single PutObject if they are smaller than one part.
+const DefaultPartSize = 16 * 1024 * 1024 // 16 MiB
+
+// readBufSize is the initial buffer size of Save(). The buffer grows up to the part size.
+const readBufSize = 64 * 1024 // 64 KiB
+
+// listPageSize split big file lists in pages (S3 max. 1000)
+const listPageSize = 1000
@@ -0,0 +1,5 @@
+/*
+Package s3 provides the storage service implementation for S3-compatible object storage (AWS S3, MinIO, ...).
+
+*/
+package s3
@@ -0,0 +1,643 @@
+package s3
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	impl "github.com/SchnorcherSepp/storage/defaultimpl"
+	interf "github.com/SchnorcherSepp/storage/interfaces"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// interface check: interf.Service
+var _ interf.Service = (*_S3Service)(nil)
+
+// Config defines the connection to a S3 bucket.
+type Config struct {
+	Endpoint  string // base url of the service, e.g. 'https://s3.eu-central-1.amazonaws.com' or 'http://localhost:9000'
+	Region    string // signing region, e.g. 'eu-central-1' (default: 'us-east-1')
+	Bucket    string // bucket name
+	Prefix    string // key prefix of the active files ('folder'), e.g. 'data/' (can be empty)
+	AccessKey string // access key id
+	SecretKey string // secret access key
+
+	// PathStyle uses 'endpoint/bucket/key' instead of 'bucket.endpoint/key' (MinIO, test servers).
+	PathStyle bool
+
+	// TrashPrefix is the key prefix for trashed files, e.g. 'trash/'.
+	// If it's empty, Trash() deletes the objects.
+	TrashPrefix string
+
+	// PartSize is the part size for multipart uploads (min. MinPartSize, default: DefaultPartSize).
+	PartSize int64
+
+	// Client is used for all requests (default: http.DefaultClient).
+	Client *http.Client
+}
+
+// _S3Service the central interface to access a S3 bucket.
+// Must be created with NewS3Service().
+type _S3Service struct {
+	conf        Config
+	readerCache interf.Cache
+	debugLvl    uint8
+	mux         *sync.RWMutex   // protect 'files'
+	saveMux     *sync.Mutex     // protect 'reserved'
+	reserved    map[string]bool // keys of running uploads (see Save)
+	files       interf.Files
+	readerOpts  []impl.ReaderAtOption // for ReaderAt() and MultiReaderAt()
+}
+
+// NewS3Service returns an interface to a S3-compatible bucket.
+// Only objects directly under conf.Prefix are files; 'sub folders' are ignored.
+// The file id is the object key without the prefix.
+// readerCache=nil disable the cache for ReaderAt() and MultiReaderAt()
+// debugLvl (@see impl.DebugHigh and impl.DebugOff)
+// readerOpts are used for ReaderAt() and MultiReaderAt() (@see impl.ReaderAtOption)
+func NewS3Service(conf Config, readerCache interf.Cache, debugLvl uint8, readerOpts ...impl.ReaderAtOption) interf.Service {
+	// defaults
+	if conf.Region == "" {
+		conf.Region = "us-east-1"
+	}
+	if conf.PartSize <= 0 {
+		conf.PartSize = DefaultPartSize
+	}
+	if conf.PartSize < MinPartSize {
+		conf.PartSize = MinPartSize
+	}
+	if conf.Client == nil {
+		conf.Client = http.DefaultClient
+	}
+	conf.Endpoint = strings.TrimSuffix(conf.Endpoint, "/")
+
+	return &_S3Service{
+		conf:        conf,
+		readerCache: readerCache,
+		debugLvl:    debugLvl,
+		mux:         new(sync.RWMutex),
+		saveMux:     new(sync.Mutex),
+		reserved:    make(map[string]bool),
+		files:       impl.NewFiles(nil), // empty list, set by Update()
+		readerOpts:  readerOpts,
+	}
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+
+// Update is the implementation of Service.Update()
+//
+// Update lists all objects under the prefix (ListObjectsV2 with pagination).
+// The Md5 of multipart objects is empty (the ETag is not the md5 hash of the content).
+// This method is thread-safe.
+func (s *_S3Service) Update() error {
+	byId := make(map[string]interf.File)
+	token := ""
+
+	for {
+		// request
+		q := url.Values{}
+		q.Set("list-type", "2")
+		q.Set("prefix", s.conf.Prefix)
+		q.Set("delimiter", "/")
+		q.Set("max-keys", strconv.Itoa(listPageSize))
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+
+		resp, err := s.do("GET", "", q, nil, -1, nil)
+		if err != nil {
+			log.Printf("ERROR: %s/Update: can't read all result pages: %v", packageName, err)
+			return err
+		}
+
+		// parse
+		page := new(_ListBucketResult)
+		err = xml.NewDecoder(resp.Body).Decode(page)
+		_ = resp.Body.Close()
+		if err != nil {
+			log.Printf("ERROR: %s/Update: invalid result page: %v", packageName, err)
+			return err
+		}
+
+		// add all results (files) to list
+		for _, o := range page.Contents {
+			id := strings.TrimPrefix(o.Key, s.conf.Prefix)
+			if id == "" || strings.HasSuffix(id, "/") {
+				continue // folder marker
+			}
+			if s.conf.TrashPrefix != "" && strings.HasPrefix(o.Key, s.conf.TrashPrefix) {
+				continue // trash is inside the prefix
+			}
+			byId[id] = impl.NewFile(id, id, o.LastModified.Unix(), o.Size, etagMd5(o.ETag))
+		}
+
+		// break loop (no more pages)
+		token = page.NextContinuationToken
+		if !page.IsTruncated || token == "" {
+			log.Printf("INFO: %s/Update: successful file update (%d files)", packageName, len(byId))
+			break
+		}
+	}
+
+	// set new list
+	s.mux.Lock() // LOCK
+	old := s.files
+	s.files = impl.NewFiles(byId)
+	s.mux.Unlock() // UNLOCK
+
+	impl.InvalidateChanged(s.readerCache, old, s.Files(), s.readerOpts...) // remove stale sectors
+	return nil
+}
+
+// Files is the implementation of Service.Files()
+//
+// Files returns all available files.
+// This method is offline and does not trigger a connection to the bucket.
+// The internal file index must be updated separately with Update().
+// This method is thread-safe.
+func (s *_S3Service) Files() interf.Files {
+	s.mux.RLock() // READ Lock
+	defer s.mux.RUnlock()
+
+	return s.files
+}
+
+// Save is the implementation of Service.Save()
+//
+// Save reads bytes from the io.Reader r and saves them as new object.
+// Streams smaller than one part are uploaded with PutObject, bigger streams with a multipart upload.
+// A key can't exist twice, so an existing name is extended with a counter (e.g. 'test (2).dat').
+// Don't forget to call Update().
+// This method is thread-safe.
+func (s *_S3Service) Save(name string, r io.Reader, max int64) (file interf.File, err error) {
+	name = strings.TrimSpace(name)
+	if name == "" || r == nil || strings.Contains(name, "/") {
+		return nil, errors.New("invalid input")
+	}
+
+	// limit reader
+	if max > 0 {
+		r = io.LimitReader(r, max)
+	}
+
+	// find and reserve a free key
+	id, err := s.reserveName(name)
+	if err != nil {
+		return nil, err
+	}
+	defer s.releaseName(id)
+	key := s.conf.Prefix + id
+
+	// read the first part (the buffer grows with the data: a small stream doesn't allocate a whole part)
+	hash := md5.New()
+	r = io.TeeReader(r, hash)
+	part, err := readPart(r, s.conf.PartSize)
+	if err != nil {
+		return nil, err
+	}
+
+	// upload
+	var size int64
+	if int64(len(part)) < s.conf.PartSize {
+		// small stream: PutObject
+		size = int64(len(part))
+		err = s.putObject(key, part)
+	} else {
+		// big stream: multipart upload (the part buffer is reused for all parts)
+		size, err = s.multipartUpload(key, part, r)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("upload error: %v", err)
+	}
+
+	// success
+	return impl.NewFile(id, id, time.Now().Unix(), size, hex.EncodeToString(hash.Sum(nil))), nil
+}
+
+// Trash is the implementation of Service.Trash()
+//
+// Trash moves the object to Config.TrashPrefix (CopyObject & DeleteObject)
+// or deletes the object if no TrashPrefix is configured.
+// Don't forget to call Update().
+// This method is thread-safe.
+func (s *_S3Service) Trash(file interf.File) error {
+	if file == nil || file.Id() == "" {
+		return errors.New("invalid input")
+	}
+	key := s.conf.Prefix + file.Id()
+
+	// copy to trash
+	if s.conf.TrashPrefix != "" {
+		trashKey := s.conf.TrashPrefix + file.Id() + "." + strconv.FormatInt(time.Now().UnixNano(), 10)
+		h := http.Header{}
+		h.Set("X-Amz-Copy-Source", "/"+s.conf.Bucket+"/"+uriEncode(key, false))
+
+		resp, err := s.do("PUT", trashKey, nil, h, -1, nil)
+		if err != nil {
+			return err
+		}
+		err = checkCopyResult(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	// delete
+	resp, err := s.do("DELETE", key, nil, nil, -1, nil)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+
+	// remove stale sectors
+	if s.readerCache != nil {
+		s.readerCache.InvalidateFile(impl.ScopedFileId(file.Id(), s.readerOpts...))
+	}
+	return nil
+}
+
+// Reader is the implementation of Service.Reader()
+//
+// Reader enables read access to a file identified by the file id (GetObject with range).
+// The connection must be closed manually with Close() after use.
+// This method is thread-safe.
+func (s *_S3Service) Reader(file interf.File, off int64) (io.ReadCloser, error) {
+	return s.get(file, off, -1)
+}
+
+// LimitedReader is the implementation of Service.LimitedReader()
+//
+// LimitedReader enables read access to a file identified by the file id (GetObject with range),
+// but stops with EOF after n bytes.
+// The connection must be closed manually with Close() after use.
+// This method is thread-safe.
+func (s *_S3Service) LimitedReader(file interf.File, off int64, n int64) (io.ReadCloser, error) {
+	if n < 1 {
+		// n = 0 -> no data requested -> return nothing
+		return ioutil.NopCloser(bytes.NewReader([]byte{})), nil
+	}
+	return s.get(file, off, n)
+}
+
+// ReaderAt is the implementation of Service.ReaderAt()
+func (s *_S3Service) ReaderAt(file interf.File) (interf.ReaderAt, error) {
+	return impl.NewReaderAt(file, s, s.readerCache, s.debugLvl, s.readerOpts...)
+}
+
+// MultiReaderAt is the implementation of Service.MultiReaderAt()
+func (s *_S3Service) MultiReaderAt(list []interf.File) (interf.ReaderAt, error) {
+	if len(list) == 1 {
+		// use the normal ReaderAt for single files
+		return s.ReaderAt(list[0])
+	} else {
+		// MultiReaderAt
+		return impl.NewMultiReaderAt(list, s, s.readerCache, s.debugLvl, s.readerOpts...)
+	}
+}
+
+// Cache returns the internal cache instance. Can be NIL.
+func (s *_S3Service) Cache() interf.Cache {
+	return s.readerCache
+}
+
+//---------  Helper  -------------------------------------------------------------------------------------------------//
+
+// get opens a GetObject request with a range header (n=-1: until the end of the object).
+// A range behind the end of the object returns io.EOF.
+// If the server (e.g. a proxy) ignores the range header, the skipped data is read and discarded.
+func (s *_S3Service) get(file interf.File, off, n int64) (io.ReadCloser, error) {
+	if file == nil || file.Id() == "" {
+		return nil, errors.New("invalid input")
+	}
+
+	h := http.Header{}
+	if n > 0 {
+		h.Set("Range", fmt.Sprintf("bytes=%d-%d", off, off+n-1))
+	} else {
+		h.Set("Range", fmt.Sprintf("bytes=%d-", off))
+	}
+
+	resp, err := s.do("GET", s.conf.Prefix+file.Id(), nil, h, -1, nil)
+	if err != nil {
+		if e, ok := err.(*_Error); ok && e.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+			return nil, io.EOF
+		}
+		return nil, err
+	}
+
+	// the server ignores the range
+	if resp.StatusCode != http.StatusPartialContent {
+		if _, err := io.CopyN(ioutil.Discard, resp.Body, off); err != nil {
+			_ = resp.Body.Close()
+			if err == io.EOF {
+				return nil, io.EOF
+			}
+			return nil, err
+		}
+		if n > 0 {
+			return impl.NewLimitedReadCloser(resp.Body, n), nil
+		}
+	}
+	return resp.Body, nil
+}
+
+// readPart reads up to partSize bytes. The buffer starts with readBufSize bytes and grows with the data
+// (max. partSize), so a small stream doesn't allocate a whole part.
+func readPart(r io.Reader, partSize int64) ([]byte, error) {
+	size := int64(readBufSize)
+	if size > partSize {
+		size = partSize
+	}
+	buf := make([]byte, 0, size)
+	for int64(len(buf)) < partSize {
+		// grow
+		if len(buf) == cap(buf) {
+			size = 2 * int64(cap(buf))
+			if size > partSize {
+				size = partSize
+			}
+			buf = append(make([]byte, 0, size), buf...)
+		}
+
+		// read
+		n, err := r.Read(buf[len(buf):cap(buf)])
+		buf = buf[:len(buf)+n]
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+// putObject uploads a small object in one request.
+func (s *_S3Service) putObject(key string, data []byte) error {
+	sum := md5.Sum(data)
+	h := http.Header{}
+	h.Set("Content-Md5", base64.StdEncoding.EncodeToString(sum[:]))
+	h.Set("Content-Type", "application/octet-stream")
+
+	resp, err := s.do("PUT", key, nil, h, int64(len(data)), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	return nil
+}
+
+// multipartUpload uploads the first part (already read) and all other parts from r.
+// The upload is aborted if an error occurs. Return the total size.
+func (s *_S3Service) multipartUpload(key string, first []byte, r io.Reader) (int64, error) {
+	// create multipart upload
+	h := http.Header{}
+	h.Set("Content-Type", "application/octet-stream")
+	resp, err := s.do("POST", key, url.Values{"uploads": {""}}, h, -1, nil)
+	if err != nil {
+		return 0, err
+	}
+	initRes := new(_InitiateMultipartUploadResult)
+	err = xml.NewDecoder(resp.Body).Decode(initRes)
+	_ = resp.Body.Close()
+	if err != nil {
+		return 0, err
+	}
+	uploadId := initRes.UploadId
+
+	// abort on error
+	abort := func(err error) (int64, error) {
+		resp, errA := s.do("DELETE", key, url.Values{"uploadId": {uploadId}}, nil, -1, nil)
+		if errA != nil {
+			log.Printf("ERROR: %s/multipartUpload: abort failed: %v", packageName, errA)
+		} else {
+			_ = resp.Body.Close()
+		}
+		return 0, err
+	}
+
+	// upload parts
+	complete := new(_CompleteMultipartUpload)
+	part := first
+	size := int64(0)
+	for no := 1; ; no++ {
+		// upload part
+		q := url.Values{"partNumber": {strconv.Itoa(no)}, "uploadId": {uploadId}}
+		resp, err := s.do("PUT", key, q, nil, int64(len(part)), bytes.NewReader(part))
+		if err != nil {
+			return abort(err)
+		}
+		_ = resp.Body.Close()
+		complete.Parts = append(complete.Parts, _CompletePart{PartNumber: no, ETag: resp.Header.Get("ETag")})
+		size += int64(len(part))
+
+		// read next part
+		if len(part) < len(first) {
+			break // last part was not full
+		}
+		n, err := io.ReadFull(r, part)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return abort(err)
+		}
+		if n == 0 {
+			break // no more data
+		}
+		part = part[:n]
+	}
+
+	// complete multipart upload
+	body, err := xml.Marshal(complete)
+	if err != nil {
+		return abort(err)
+	}
+	resp, err = s.do("POST", key, url.Values{"uploadId": {uploadId}}, nil, int64(len(body)), bytes.NewReader(body))
+	if err != nil {
+		return abort(err)
+	}
+	err = checkCopyResult(resp.Body) // CompleteMultipartUpload can fail with status 200
+	_ = resp.Body.Close()
+	if err != nil {
+		return abort(err)
+	}
+
+	return size, nil
+}
+
+// reserveName returns the name or (if the key already exists) the name with a counter.
+// Example: 'test.dat' -> 'test (2).dat'
+// The name is reserved for the running upload until releaseName() is called.
+func (s *_S3Service) reserveName(name string) (string, error) {
+	s.saveMux.Lock() // LOCK
+	defer s.saveMux.Unlock()
+
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+
+	newName := name
+	for i := 2; ; i++ {
+		if !s.reserved[newName] {
+			resp, err := s.do("HEAD", s.conf.Prefix+newName, nil, nil, -1, nil)
+			if err != nil {
+				if e, ok := err.(*_Error); ok && e.StatusCode == http.StatusNotFound {
+					s.reserved[newName] = true
+					return newName, nil
+				}
+				return "", err
+			}
+			_ = resp.Body.Close()
+		}
+		newName = fmt.Sprintf("%s (%d)%s", base, i, ext)
+	}
+}
+
+// releaseName removes the reservation of reserveName().
+func (s *_S3Service) releaseName(name string) {
+	s.saveMux.Lock() // LOCK
+	delete(s.reserved, name)
+	s.saveMux.Unlock() // UNLOCK
+}
+
+// do sends a signed request. key="" addresses the bucket.
+// Responses with a status code >= 300 are returned as *_Error.
+// size=-1 means unknown content length.
+func (s *_S3Service) do(method, key string, q url.Values, h http.Header, size int64, body io.Reader) (*http.Response, error) {
+	// build url
+	u, err := url.Parse(s.conf.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if s.conf.PathStyle {
+		u.Path = "/" + s.conf.Bucket + "/" + key
+	} else {
+		u.Host = s.conf.Bucket + "." + u.Host
+		u.Path = "/" + key
+	}
+	u.RawPath = uriEncode(u.Path, false)
+	if q != nil {
+		u.RawQuery = q.Encode()
+	}
+
+	// build request
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if size >= 0 {
+		req.ContentLength = size
+	}
+	for k, v := range h {
+		req.Header[k] = v
+	}
+	signV4(req, s.conf.AccessKey, s.conf.SecretKey, s.conf.Region, time.Now())
+
+	// send
+	resp, err := s.conf.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		return nil, newError(resp)
+	}
+	return resp, nil
+}
+
+// etagMd5 returns the md5 hash from the ETag or "" for multipart objects.
+func etagMd5(etag string) string {
+	etag = strings.Trim(etag, "\"")
+	if len(etag) != 32 || strings.Contains(etag, "-") {
+		return ""
+	}
+	return strings.ToLower(etag)
+}
+
+// checkCopyResult checks the body of CopyObject or CompleteMultipartUpload.
+// These requests can fail after the status 200 was sent.
+func checkCopyResult(body io.Reader) error {
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	e := new(_Error)
+	if xml.Unmarshal(b, e) == nil && e.XMLName.Local == "Error" {
+		e.StatusCode = http.StatusOK
+		return e
+	}
+	return nil
+}
+
+//---------  XML  ----------------------------------------------------------------------------------------------------//
+
+// _Error is the S3 error response.
+type _Error struct {
+	XMLName    xml.Name `xml:"Error"`
+	Code       string   `xml:"Code"`
+	Message    string   `xml:"Message"`
+	StatusCode int      `xml:"-"`
+}
+
+// newError reads the error response (the body may be empty, e.g. HEAD).
+func newError(resp *http.Response) error {
+	e := &_Error{StatusCode: resp.StatusCode}
+	b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	_ = xml.Unmarshal(b, e)
+	if e.Code == "" {
+		e.Code = http.StatusText(resp.StatusCode)
+	}
+	return e
+}
+
+func (e *_Error) Error() string {
+	msg := fmt.Sprintf("%s/%s: http %d", packageName, e.Code, e.StatusCode)
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+// Is makes errors.Is(err, os.ErrNotExist) work with missing objects.
+func (e *_Error) Is(target error) bool {
+	return target == os.ErrNotExist && (e.StatusCode == http.StatusNotFound || e.Code == "NoSuchKey")
+}
+
+type _ListBucketResult struct {
+	IsTruncated           bool          `xml:"IsTruncated"`
+	NextContinuationToken string        `xml:"NextContinuationToken"`
+	Contents              []_ListObject `xml:"Contents"`
+}
+
+type _ListObject struct {
+	Key          string    `xml:"Key"`
+	LastModified time.Time `xml:"LastModified"`
+	ETag         string    `xml:"ETag"`
+	Size         int64     `xml:"Size"`
+}
+
+type _InitiateMultipartUploadResult struct {
+	UploadId string `xml:"UploadId"`
+}
+
+type _CompleteMultipartUpload struct {
+	XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+	Parts   []_CompletePart `xml:"Part"`
+}
+
+type _CompletePart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
@@ -0,0 +1,451 @@
+package s3_test
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	impl "github.com/SchnorcherSepp/storage/defaultimpl"
+	interf "github.com/SchnorcherSepp/storage/interfaces"
+	"github.com/SchnorcherSepp/storage/s3"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+func TestS3Service_Save_Read_Trash(t *testing.T) {
+	fake, s := newTestService(t, "data/", "trash/")
+
+	// invalid input
+	if _, err := s.Save("", bytes.NewReader(nil), 0); err == nil {
+		t.Fatal("no error with empty name")
+	}
+	if _, err := s.Save("a/b", bytes.NewReader(nil), 0); err == nil {
+		t.Fatal("no error with slash in name")
+	}
+
+	// save small file
+	f1, err := s.Save("test.dat", bytes.NewReader([]byte("Test Bytes Foo Bar")), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f1.Id() != "test.dat" || f1.Size() != 18 || f1.Md5() != "bda184187bab92431f5f86e489b659f8" {
+		t.Fatalf("wrong file: %s, %d, %s", f1.Id(), f1.Size(), f1.Md5())
+	}
+
+	// save with same name and limit
+	f2, err := s.Save("test.dat", bytes.NewReader([]byte("Test Bytes Foo Bar")), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f2.Id() != "test (2).dat" || f2.Size() != 4 {
+		t.Fatalf("wrong file: %s, %d", f2.Id(), f2.Size())
+	}
+
+	// update
+	if err := s.Update(); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Files().All()) != 2 {
+		t.Fatalf("wrong file count: %d", len(s.Files().All()))
+	}
+	if f, err := s.Files().ByName("test.dat"); err != nil || f.Md5() != f1.Md5() {
+		t.Fatalf("wrong index: %v", err)
+	}
+
+	// LimitedReader with offset 1 and n=16
+	r, err := s.LimitedReader(f1, 1, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(r)
+	_ = r.Close()
+	if err != nil || string(b) != "est Bytes Foo Ba" {
+		t.Fatalf("read error: %s, %v", b, err)
+	}
+
+	// LimitedReader with n=0
+	r, err = s.LimitedReader(f1, 11, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ = ioutil.ReadAll(r)
+	_ = r.Close()
+	if len(b) != 0 {
+		t.Fatalf("read error: %s", b)
+	}
+
+	// Reader
+	r, err = s.Reader(f1, 11)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ = ioutil.ReadAll(r)
+	_ = r.Close()
+	if string(b) != "Foo Bar" {
+		t.Fatalf("read error: %s", b)
+	}
+
+	// Reader over EOF
+	if _, err := s.Reader(f2, 4); err == nil {
+		t.Fatal("no error")
+	}
+
+	// the server ignores the range header
+	fake.mux.Lock()
+	fake.noRange = true
+	fake.mux.Unlock()
+	r, err = s.LimitedReader(f1, 1, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ = ioutil.ReadAll(r)
+	_ = r.Close()
+	if string(b) != "est Bytes Foo Ba" {
+		t.Fatalf("read error: %s", b)
+	}
+	r, err = s.Reader(f1, 11)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ = ioutil.ReadAll(r)
+	_ = r.Close()
+	if string(b) != "Foo Bar" {
+		t.Fatalf("read error: %s", b)
+	}
+	if _, err := s.Reader(f2, 5); err != io.EOF {
+		t.Fatalf("wrong error: %v", err)
+	}
+	fake.mux.Lock()
+	fake.noRange = false
+	fake.mux.Unlock()
+
+	// Reader with unknown file
+	if _, err := s.Reader(impl.NewFile("unknown", "unknown", 0, 0, ""), 0); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("wrong error: %v", err)
+	}
+
+	// Trash
+	if err := s.Trash(f1); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Update(); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Files().All()) != 1 {
+		t.Fatalf("wrong file count: %d", len(s.Files().All()))
+	}
+	if fake.count("trash/test.dat.") != 1 {
+		t.Fatal("file not in trash")
+	}
+}
+
+func TestS3Service_Multipart(t *testing.T) {
+	fake, s := newTestService(t, "", "")
+
+	// 12 MiB + 1 byte = 3 parts (5 MiB part size)
+	data := make([]byte, 12*1024*1024+1)
+	rand.New(rand.NewSource(1337)).Read(data)
+
+	f, err := s.Save("big.dat", bytes.NewReader(data), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Size() != int64(len(data)) || f.Md5() != fmt.Sprintf("%x", md5.Sum(data)) {
+		t.Fatalf("wrong file: %d, %s", f.Size(), f.Md5())
+	}
+	if fake.parts != 3 {
+		t.Fatalf("wrong part count: %d", fake.parts)
+	}
+
+	// multipart objects have no md5
+	if err := s.Update(); err != nil {
+		t.Fatal(err)
+	}
+	f, err = s.Files().ById("big.dat")
+	if err != nil || f.Size() != int64(len(data)) || f.Md5() != "" {
+		t.Fatalf("wrong index: %v", err)
+	}
+
+	// random access with ReaderAt
+	rAt, err := s.ReaderAt(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rAt.Close()
+
+	buf := make([]byte, 100)
+	for _, off := range []int64{0, 5*1024*1024 - 50, 12 * 1024 * 1024, 77777} {
+		n, err := rAt.ReadAt(buf, off)
+		end := off + int64(n)
+		if err != nil && end != int64(len(data)) || !bytes.Equal(buf[:n], data[off:end]) {
+			t.Fatalf("ReadAt error: off=%d, n=%d, err=%v", off, n, err)
+		}
+	}
+
+	// Trash without TrashPrefix deletes the object
+	if err := s.Trash(f); err != nil {
+		t.Fatal(err)
+	}
+	if fake.count("") != 0 {
+		t.Fatal("object not deleted")
+	}
+
+	// smaller than one part: a single PutObject (the read buffer grows)
+	medium := data[:1024*1024+7]
+	if f, err := s.Save("medium.dat", iotest.OneByteReader(bytes.NewReader(medium[:1000])), 0); err != nil || f.Size() != 1000 {
+		t.Fatalf("wrong file: %v", err)
+	}
+	if f, err := s.Save("medium.dat", bytes.NewReader(medium), 0); err != nil || f.Md5() != fmt.Sprintf("%x", md5.Sum(medium)) {
+		t.Fatalf("wrong file: %v", err)
+	}
+	fake.mux.Lock()
+	ok := bytes.Equal(fake.objects["medium.dat"], medium[:1000]) && bytes.Equal(fake.objects["medium (2).dat"], medium)
+	fake.mux.Unlock()
+	if !ok || fake.parts != 3 {
+		t.Fatalf("wrong objects: %v, %d parts", ok, fake.parts)
+	}
+}
+
+func TestS3Service_Update_Pagination(t *testing.T) {
+	fake, s := newTestService(t, "p/", "p/.trash/")
+
+	for i := 0; i < 2500; i++ {
+		fake.put(fmt.Sprintf("p/file-%d.dat", i), []byte("x"))
+	}
+	fake.put("p/sub/ignore.dat", []byte("x"))
+	fake.put("p/.trash/ignore.dat", []byte("x"))
+	fake.put("other/ignore.dat", []byte("x"))
+
+	if err := s.Update(); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Files().All()) != 2500 {
+		t.Fatalf("wrong file count: %d", len(s.Files().All()))
+	}
+	if fake.lists != 3 {
+		t.Fatalf("wrong page count: %d", fake.lists)
+	}
+}
+
+//--------  HELPER  --------------------------------------------------------------------------------------------------//
+
+func newTestService(t *testing.T, prefix, trash string) (*fakeS3, interf.Service) {
+	fake := &fakeS3{
+		bucket:  "bucket",
+		objects: make(map[string][]byte),
+		uploads: make(map[string]map[int][]byte),
+	}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+
+	s := s3.NewS3Service(s3.Config{
+		Endpoint:    srv.URL,
+		Bucket:      "bucket",
+		Prefix:      prefix,
+		AccessKey:   "key",
+		SecretKey:   "secret",
+		PathStyle:   true,
+		TrashPrefix: trash,
+		PartSize:    1, // min. part size
+	}, impl.NewCache(1), impl.DebugOff)
+	return fake, s
+}
+
+// fakeS3 is a minimal in-process S3 server (path style) for the tests.
+type fakeS3 struct {
+	mux     sync.Mutex
+	bucket  string
+	objects map[string][]byte
+	uploads map[string]map[int][]byte
+	parts   int
+	lists   int
+	noRange bool // ignore the range header (e.g. a proxy)
+}
+
+func (f *fakeS3) put(key string, data []byte) {
+	f.mux.Lock()
+	f.objects[key] = data
+	f.mux.Unlock()
+}
+
+func (f *fakeS3) count(prefix string) int {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	n := 0
+	for k := range f.objects {
+		if strings.HasPrefix(k, prefix) {
+			n++
+		}
+	}
+	return n
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mux.Lock()
+	locked := true
+	defer func() {
+		if locked {
+			f.mux.Unlock()
+		}
+	}()
+
+	// check signature header
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=key/") {
+		f.error(w, http.StatusForbidden, "AccessDenied")
+		return
+	}
+
+	// bucket and key
+	p := strings.TrimPrefix(r.URL.Path, "/")
+	if !strings.HasPrefix(p, f.bucket) {
+		f.error(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+	key := strings.TrimPrefix(strings.TrimPrefix(p, f.bucket), "/")
+	q := r.URL.Query()
+	body, _ := ioutil.ReadAll(r.Body)
+
+	switch {
+	case r.Method == "GET" && key == "":
+		f.list(w, q)
+
+	case r.Method == "GET" || r.Method == "HEAD":
+		data, ok := f.objects[key]
+		if !ok {
+			f.error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		start, end := int64(0), int64(len(data))-1
+		if rng := r.Header.Get("Range"); rng != "" && !f.noRange {
+			parts := strings.SplitN(strings.TrimPrefix(rng, "bytes="), "-", 2)
+			start, _ = strconv.ParseInt(parts[0], 10, 64)
+			if parts[1] != "" {
+				end, _ = strconv.ParseInt(parts[1], 10, 64)
+			}
+			if start >= int64(len(data)) {
+				f.error(w, http.StatusRequestedRangeNotSatisfiable, "InvalidRange")
+				return
+			}
+			if end >= int64(len(data)) {
+				end = int64(len(data)) - 1
+			}
+			w.WriteHeader(http.StatusPartialContent)
+		}
+		f.mux.Unlock() // don't block other requests while the client reads slowly
+		locked = false
+		if r.Method == "GET" {
+			_, _ = w.Write(data[start : end+1])
+		}
+
+	case r.Method == "PUT" && q.Get("uploadId") != "":
+		no, _ := strconv.Atoi(q.Get("partNumber"))
+		f.uploads[q.Get("uploadId")][no] = body
+		f.parts++
+		w.Header().Set("ETag", fmt.Sprintf("\"%x\"", md5.Sum(body)))
+
+	case r.Method == "PUT" && r.Header.Get("X-Amz-Copy-Source") != "":
+		src := strings.TrimPrefix(r.Header.Get("X-Amz-Copy-Source"), "/"+f.bucket+"/")
+		data, ok := f.objects[src]
+		if !ok {
+			f.error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		f.objects[key] = data
+		_, _ = w.Write([]byte("<CopyObjectResult></CopyObjectResult>"))
+
+	case r.Method == "PUT":
+		f.objects[key] = body
+
+	case r.Method == "POST" && q["uploads"] != nil:
+		id := strconv.Itoa(len(f.uploads) + 1)
+		f.uploads[id] = make(map[int][]byte)
+		_, _ = fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", id)
+
+	case r.Method == "POST" && q.Get("uploadId") != "":
+		parts := f.uploads[q.Get("uploadId")]
+		var data []byte
+		for i := 1; i <= len(parts); i++ {
+			data = append(data, parts[i]...)
+		}
+		f.objects[key] = data
+		delete(f.uploads, q.Get("uploadId"))
+		_, _ = w.Write([]byte("<CompleteMultipartUploadResult></CompleteMultipartUploadResult>"))
+
+	case r.Method == "DELETE":
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		f.error(w, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, q map[string][]string) {
+	f.lists++
+	get := func(k string) string {
+		if v := q[k]; len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	}
+	prefix, delimiter := get("prefix"), get("delimiter")
+	maxKeys, _ := strconv.Atoi(get("max-keys"))
+	start, _ := strconv.Atoi(get("continuation-token"))
+
+	// sorted keys
+	keys := make([]string, 0)
+	for k := range f.objects {
+		rest := strings.TrimPrefix(k, prefix)
+		if strings.HasPrefix(k, prefix) && (delimiter == "" || !strings.Contains(rest, delimiter)) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	// page
+	type object struct {
+		Key          string
+		LastModified time.Time
+		ETag         string
+		Size         int
+	}
+	type result struct {
+		XMLName               xml.Name `xml:"ListBucketResult"`
+		IsTruncated           bool
+		NextContinuationToken string
+		Contents              []object
+	}
+	res := result{}
+	end := start + maxKeys
+	if end < len(keys) {
+		res.IsTruncated = true
+		res.NextContinuationToken = strconv.Itoa(end)
+	} else {
+		end = len(keys)
+	}
+	for _, k := range keys[start:end] {
+		etag := fmt.Sprintf("\"%x\"", md5.Sum(f.objects[k]))
+		if len(f.objects[k]) > 5*1024*1024 {
+			etag = "\"00000000000000000000000000000000-3\""
+		}
+		res.Contents = append(res.Contents, object{Key: k, LastModified: time.Now(), ETag: etag, Size: len(f.objects[k])})
+	}
+	_ = xml.NewEncoder(w).Encode(res)
+}
+
+func (f *fakeS3) error(w http.ResponseWriter, status int, code string) {
+	w.WriteHeader(status)
+	_, _ = fmt.Fprintf(w, "<Error><Code>%s</Code><Message>fake</Message></Error>", code)
+}
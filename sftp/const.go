@@ -0,0 +1,7 @@
+package sftp
+
+// packageName is used for debug and error messages
+const packageName = "sftp"
+
+// TrashFolder is the sub folder of the root directory in which Trash() moves the files.
+const TrashFolder = ".trash"
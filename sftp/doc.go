@@ -0,0 +1,5 @@
+/*
+Package sftp provides the storage service implementation for remote directories reachable via SSH (SFTP).
+
+*/
+package sftp
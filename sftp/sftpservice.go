@@ -0,0 +1,340 @@
+package sftp
+
+import (
+	"crypto/md5"
+	"errors"
+	"fmt"
+	impl "github.com/SchnorcherSepp/storage/defaultimpl"
+	interf "github.com/SchnorcherSepp/storage/interfaces"
+	psftp "github.com/pkg/sftp"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// interface check: interf.Service
+var _ interf.Service = (*_SftpService)(nil)
+
+// _SftpService the central interface to access a remote directory via SFTP.
+// Must be created with NewSftpService().
+type _SftpService struct {
+	client      *psftp.Client
+	rootDir     string
+	readerCache interf.Cache
+	debugLvl    uint8
+	mux         *sync.RWMutex // protect 'files' and 'saved'
+	saveMux     *sync.Mutex   // serialize the selection of new file names in Save()
+	files       interf.Files
+	saved       map[string]interf.File // files saved since the last Update (id -> file with md5)
+	readerOpts  []impl.ReaderAtOption  // for ReaderAt() and MultiReaderAt()
+}
+
+// NewSftpService returns an interface to the remote directory rootDir.
+// The client must be connected, e.g.:
+//   conn, _ := ssh.Dial("tcp", "example.com:22", sshConfig)
+//   client, _ := sftp.NewClient(conn)
+//
+// All files in rootDir are the storage files (the file id is the file name).
+// Folders, sub-folders and hidden files (prefix '.') are ignored.
+// readerCache=nil disable the cache for ReaderAt() and MultiReaderAt()
+// debugLvl (@see impl.DebugHigh and impl.DebugOff)
+// readerOpts are used for ReaderAt() and MultiReaderAt() (@see impl.ReaderAtOption)
+func NewSftpService(client *psftp.Client, rootDir string, readerCache interf.Cache, debugLvl uint8, readerOpts ...impl.ReaderAtOption) interf.Service {
+	return &_SftpService{
+		client:      client,
+		rootDir:     rootDir,
+		readerCache: readerCache,
+		debugLvl:    debugLvl,
+		mux:         new(sync.RWMutex),
+		saveMux:     new(sync.Mutex),
+		files:       impl.NewFiles(nil), // empty list, set by Update()
+		saved:       make(map[string]interf.File),
+		readerOpts:  readerOpts,
+	}
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+
+// Update is the implementation of Service.Update()
+//
+// Update lists the remote directory.
+// SFTP can't calculate hashes on the server, so the Md5 is only known for files
+// saved with this service (unchanged files keep the md5 of Save() or the last index).
+// This method is thread-safe.
+func (s *_SftpService) Update() error {
+	infos, err := s.client.ReadDir(s.rootDir)
+	if err != nil {
+		log.Printf("ERROR: %s/Update: %v", packageName, err)
+		return err
+	}
+
+	// the old index and the saved files are used to keep known md5 hashes
+	s.mux.RLock() // READ Lock
+	old := s.files
+	saved := make(map[string]interf.File, len(s.saved))
+	for id, f := range s.saved {
+		saved[id] = f
+	}
+	s.mux.RUnlock() // READ Unlock
+
+	// build new index
+	byId := make(map[string]interf.File)
+	for _, fi := range infos {
+		// skip folders and hidden files (like the trash and temp files)
+		if !fi.Mode().IsRegular() || strings.HasPrefix(fi.Name(), ".") {
+			continue
+		}
+
+		id := fi.Name()
+		modTime := fi.ModTime().Unix()
+
+		// keep hash of unchanged files
+		h := ""
+		if sf, ok := saved[id]; ok && sf.Size() == fi.Size() && sf.ModTime() == modTime {
+			h = sf.Md5()
+		} else if of, err := old.ById(id); err == nil && of.Size() == fi.Size() && of.ModTime() == modTime {
+			h = of.Md5()
+		}
+		byId[id] = impl.NewFile(id, id, modTime, fi.Size(), h)
+	}
+	log.Printf("INFO: %s/Update: successful file update (%d files)", packageName, len(byId))
+
+	// set new index
+	s.mux.Lock() // LOCK
+	old = s.files
+	s.files = impl.NewFiles(byId)
+	for id, f := range saved {
+		if s.saved[id] == f {
+			delete(s.saved, id) // in the index now (a newer Save() is kept)
+		}
+	}
+	s.mux.Unlock() // UNLOCK
+
+	impl.InvalidateChanged(s.readerCache, old, s.Files(), s.readerOpts...) // remove stale sectors
+	return nil
+}
+
+// Files is the implementation of Service.Files()
+//
+// Files returns all available files.
+// This method is offline and does not trigger a connection to the server.
+// The internal file index must be updated separately with Update().
+// This method is thread-safe.
+func (s *_SftpService) Files() interf.Files {
+	s.mux.RLock() // READ Lock
+	defer s.mux.RUnlock()
+
+	return s.files
+}
+
+// Save is the implementation of Service.Save()
+//
+// Save writes the data to a hidden temp file and renames it (a SFTP rename never overwrites).
+// A directory can't contain the same name twice, so an existing name is extended with a counter (e.g. 'test (2).dat').
+// Don't forget to call Update().
+// This method is thread-safe.
+func (s *_SftpService) Save(name string, r io.Reader, max int64) (file interf.File, err error) {
+	name = strings.TrimSpace(name)
+	if name == "" || r == nil || strings.Contains(name, "/") || strings.HasPrefix(name, ".") {
+		return nil, errors.New("invalid input")
+	}
+
+	// limit reader
+	if max > 0 {
+		r = io.LimitReader(r, max)
+	}
+
+	// write temp file (hidden, ignored by Update)
+	tmp := path.Join(s.rootDir, ".tmp-"+strconv.FormatInt(time.Now().UnixNano(), 36))
+	fh, err := s.client.Create(tmp)
+	if err != nil {
+		return nil, err
+	}
+	hash := md5.New()
+	size, err := io.Copy(fh, io.TeeReader(r, hash))
+	if errC := fh.Close(); err == nil {
+		err = errC
+	}
+	if err != nil {
+		_ = s.client.Remove(tmp)
+		return nil, fmt.Errorf("upload error: %v", err)
+	}
+
+	// find a free name and rename
+	s.saveMux.Lock() // LOCK
+	defer s.saveMux.Unlock()
+
+	id, err := s.rename(tmp, s.rootDir, name)
+	if err != nil {
+		_ = s.client.Remove(tmp)
+		return nil, err
+	}
+
+	// the modTime of the server (for Update)
+	modTime := time.Now().Unix()
+	if fi, err := s.client.Stat(path.Join(s.rootDir, id)); err == nil {
+		modTime = fi.ModTime().Unix()
+	}
+	file = impl.NewFile(id, id, modTime, size, fmt.Sprintf("%x", hash.Sum(nil)))
+
+	// remember the md5 for Update
+	s.mux.Lock() // LOCK
+	s.saved[id] = file
+	s.mux.Unlock() // UNLOCK
+	return file, nil
+}
+
+// Trash is the implementation of Service.Trash()
+//
+// Trash moves the file into the TrashFolder of the root directory.
+// Don't forget to call Update().
+// This method is thread-safe.
+func (s *_SftpService) Trash(file interf.File) error {
+	p, err := s.path(file)
+	if err != nil {
+		return err
+	}
+
+	// create trash
+	trash := path.Join(s.rootDir, TrashFolder)
+	if err := s.client.MkdirAll(trash); err != nil {
+		return err
+	}
+
+	// move
+	s.saveMux.Lock() // LOCK
+	defer s.saveMux.Unlock()
+
+	if _, err := s.rename(p, trash, file.Id()); err != nil {
+		return err
+	}
+	s.mux.Lock() // LOCK
+	delete(s.saved, file.Id())
+	s.mux.Unlock() // UNLOCK
+
+	// remove stale sectors
+	if s.readerCache != nil {
+		s.readerCache.InvalidateFile(impl.ScopedFileId(file.Id(), s.readerOpts...))
+	}
+	return nil
+}
+
+// Reader is the implementation of Service.Reader()
+//
+// Reader opens the remote file and seeks to the offset.
+// The connection must be closed manually with Close() after use.
+// This method is thread-safe.
+func (s *_SftpService) Reader(file interf.File, off int64) (io.ReadCloser, error) {
+	p, err := s.path(file)
+	if err != nil {
+		return nil, err
+	}
+
+	// open file
+	fh, err := s.client.Open(p)
+	if err != nil {
+		return nil, err
+	}
+
+	// check offset
+	fi, err := fh.Stat()
+	if err != nil {
+		_ = fh.Close()
+		return nil, err
+	}
+	if off >= fi.Size() {
+		_ = fh.Close()
+		return nil, io.EOF
+	}
+
+	// seek
+	if _, err := fh.Seek(off, io.SeekStart); err != nil {
+		_ = fh.Close()
+		return nil, err
+	}
+	return fh, nil
+}
+
+// LimitedReader is the implementation of Service.LimitedReader()
+//
+// LimitedReader opens the remote file and seeks to the offset, but stops with EOF after n bytes.
+// The connection must be closed manually with Close() after use.
+// This method is thread-safe.
+func (s *_SftpService) LimitedReader(file interf.File, off int64, n int64) (io.ReadCloser, error) {
+	if n < 1 {
+		// n = 0 -> no data requested -> return nothing
+		return ioutil.NopCloser(strings.NewReader("")), nil
+	}
+
+	r, err := s.Reader(file, off)
+	if err != nil {
+		return nil, err
+	}
+	return impl.NewLimitedReadCloser(r, n), nil
+}
+
+// ReaderAt is the implementation of Service.ReaderAt()
+func (s *_SftpService) ReaderAt(file interf.File) (interf.ReaderAt, error) {
+	return impl.NewReaderAt(file, s, s.readerCache, s.debugLvl, s.readerOpts...)
+}
+
+// MultiReaderAt is the implementation of Service.MultiReaderAt()
+func (s *_SftpService) MultiReaderAt(list []interf.File) (interf.ReaderAt, error) {
+	if len(list) == 1 {
+		// use the normal ReaderAt for single files
+		return s.ReaderAt(list[0])
+	} else {
+		// MultiReaderAt
+		return impl.NewMultiReaderAt(list, s, s.readerCache, s.debugLvl, s.readerOpts...)
+	}
+}
+
+// Cache returns the internal cache instance. Can be NIL.
+func (s *_SftpService) Cache() interf.Cache {
+	return s.readerCache
+}
+
+//---------  Helper  -------------------------------------------------------------------------------------------------//
+
+// path returns the full remote path of the file.
+// The file id must be a plain file name (no path elements, no hidden file).
+func (s *_SftpService) path(file interf.File) (string, error) {
+	if file == nil {
+		return "", errors.New("nil file")
+	}
+	id := file.Id()
+	if id == "" || strings.Contains(id, "/") || strings.HasPrefix(id, ".") {
+		return "", fmt.Errorf("invalid file id '%s'", id)
+	}
+	return path.Join(s.rootDir, id), nil
+}
+
+// rename moves the file src into the directory dir with the name or (if the name already exists)
+// the name with a counter. Example: 'test.dat' -> 'test (2).dat'
+// Return the final name.
+func (s *_SftpService) rename(src, dir, name string) (string, error) {
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+
+	newName := name
+	for i := 2; i < 10000; i++ {
+		dst := path.Join(dir, newName)
+		if _, err := s.client.Lstat(dst); os.IsNotExist(err) {
+			err := s.client.Rename(src, dst)
+			if err == nil {
+				return newName, nil
+			}
+			if _, errS := s.client.Lstat(dst); errS != nil {
+				return "", err // rename failed, but not because of the name
+			}
+		}
+		newName = fmt.Sprintf("%s (%d)%s", base, i, ext)
+	}
+	return "", fmt.Errorf("can't find a free name for '%s'", name)
+}
@@ -0,0 +1,304 @@
+package sftp_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	impl "github.com/SchnorcherSepp/storage/defaultimpl"
+	interf "github.com/SchnorcherSepp/storage/interfaces"
+	"github.com/SchnorcherSepp/storage/sftp"
+	psftp "github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"io/ioutil"
+	mrand "math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSftpService_Save_Read_Trash(t *testing.T) {
+	dir, s := newTestService(t)
+
+	// invalid input
+	if _, err := s.Save("", bytes.NewReader(nil), 0); err == nil {
+		t.Fatal("no error with empty name")
+	}
+	if _, err := s.Save("a/b", bytes.NewReader(nil), 0); err == nil {
+		t.Fatal("no error with slash in name")
+	}
+
+	// save small file
+	f1, err := s.Save("test.dat", bytes.NewReader([]byte("Test Bytes Foo Bar")), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f1.Id() != "test.dat" || f1.Size() != 18 || f1.Md5() != "bda184187bab92431f5f86e489b659f8" {
+		t.Fatalf("wrong file: %s, %d, %s", f1.Id(), f1.Size(), f1.Md5())
+	}
+
+	// save with same name and limit
+	f2, err := s.Save("test.dat", bytes.NewReader([]byte("Test Bytes Foo Bar")), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f2.Id() != "test (2).dat" || f2.Size() != 4 {
+		t.Fatalf("wrong file: %s, %d", f2.Id(), f2.Size())
+	}
+
+	// foreign file and sub folder
+	if err := ioutil.WriteFile(filepath.Join(dir, "foreign.dat"), []byte("foreign"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	// update
+	if err := s.Update(); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Files().All()) != 3 {
+		t.Fatalf("wrong file count: %d", len(s.Files().All()))
+	}
+	if f, err := s.Files().ById("foreign.dat"); err != nil || f.Size() != 7 || f.Md5() != "" {
+		t.Fatalf("wrong index: %v", err)
+	}
+	for _, saved := range []interf.File{f1, f2} { // md5 of Save()
+		if f, err := s.Files().ById(saved.Id()); err != nil || f.Md5() != saved.Md5() || f.ModTime() != saved.ModTime() {
+			t.Fatalf("wrong index: %s, %v", saved.Id(), err)
+		}
+	}
+
+	// a changed file loses the md5
+	p2 := filepath.Join(dir, "test (2).dat")
+	if err := ioutil.WriteFile(p2, []byte("Tes!"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(p2, time.Now(), time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Update(); err != nil {
+		t.Fatal(err)
+	}
+	if f, err := s.Files().ById("test (2).dat"); err != nil || f.Md5() != "" {
+		t.Fatalf("wrong index: %v", err)
+	}
+
+	// LimitedReader with offset 1 and n=16
+	r, err := s.LimitedReader(f1, 1, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(r)
+	_ = r.Close()
+	if err != nil || string(b) != "est Bytes Foo Ba" {
+		t.Fatalf("read error: %s, %v", b, err)
+	}
+
+	// Reader
+	r, err = s.Reader(f1, 11)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ = ioutil.ReadAll(r)
+	_ = r.Close()
+	if string(b) != "Foo Bar" {
+		t.Fatalf("read error: %s", b)
+	}
+
+	// Reader over EOF
+	if _, err := s.Reader(f2, 4); err != io.EOF {
+		t.Fatalf("wrong error: %v", err)
+	}
+
+	// Trash
+	if err := s.Trash(f1); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Update(); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Files().All()) != 2 {
+		t.Fatalf("wrong file count: %d", len(s.Files().All()))
+	}
+	if _, err := os.Stat(filepath.Join(dir, sftp.TrashFolder, "test.dat")); err != nil {
+		t.Fatalf("file not in trash: %v", err)
+	}
+
+	// Trash invalid id
+	if err := s.Trash(impl.NewFile("../x", "x", 0, 0, "")); err == nil {
+		t.Fatal("no error with invalid id")
+	}
+}
+
+func TestSftpService_ReaderAt(t *testing.T) {
+	_, s := newTestService(t)
+
+	// 1 MB random data
+	data := make([]byte, 1024*1024+7)
+	mrand.New(mrand.NewSource(1337)).Read(data)
+	f1, err := s.Save("a.dat", bytes.NewReader(data), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f2, err := s.Save("b.dat", bytes.NewReader([]byte("b")), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// random access
+	rAt, err := s.ReaderAt(f1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rAt.Close()
+
+	buf := make([]byte, 100)
+	for _, off := range []int64{0, 500000, 1024 * 1024, 77777, 20} {
+		n, err := rAt.ReadAt(buf, off)
+		end := off + int64(n)
+		if err != nil && end != int64(len(data)) || !bytes.Equal(buf[:n], data[off:end]) {
+			t.Fatalf("ReadAt error: off=%d, n=%d, err=%v", off, n, err)
+		}
+	}
+
+	// multi
+	mAt, err := s.MultiReaderAt([]interf.File{f1, f2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mAt.Close()
+	if n, err := mAt.ReadAt(buf[:2], int64(len(data))-1); n != 2 || err != nil || buf[1] != 'b' {
+		t.Fatalf("ReadAt error: n=%d, err=%v", n, err)
+	}
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+
+func TestRace_SftpService(t *testing.T) {
+	_, s := newTestService(t)
+
+	var wg sync.WaitGroup
+	wg.Add(5)
+	for n := 0; n < 5; n++ {
+		go func() {
+			//------------------------------
+			for i := 0; i < 10; i++ {
+				_, errS := s.Save("race.dat", bytes.NewReader([]byte("race")), 0)
+				errU := s.Update()
+				if errS != nil || errU != nil {
+					t.Fail()
+				}
+			}
+			//------------------------------
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+
+	// all files must exist
+	if err := s.Update(); err != nil || len(s.Files().All()) != 50 {
+		t.Fatalf("wrong file count: %d, %v", len(s.Files().All()), err)
+	}
+}
+
+//--------  HELPER  --------------------------------------------------------------------------------------------------//
+
+// newTestService starts a SSH server with the SFTP subsystem on localhost
+// and returns the temp root dir and a connected service.
+func newTestService(t *testing.T) (string, interf.Service) {
+	dir := t.TempDir()
+
+	// server config
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostKey, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if c.User() == "user" && string(pass) == "pass" {
+				return nil, nil
+			}
+			return nil, os.ErrPermission
+		},
+	}
+	conf.AddHostKey(hostKey)
+
+	// listen
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+	go serveSSH(l, conf)
+
+	// client
+	conn, err := ssh.Dial("tcp", l.Addr().String(), &ssh.ClientConfig{
+		User:            "user",
+		Auth:            []ssh.AuthMethod{ssh.Password("pass")},
+		HostKeyCallback: ssh.FixedHostKey(hostKey.PublicKey()),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := psftp.NewClient(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = client.Close()
+		_ = conn.Close()
+	})
+
+	return dir, sftp.NewSftpService(client, dir, impl.NewCache(1), impl.DebugOff)
+}
+
+// serveSSH accepts connections and starts the SFTP subsystem.
+func serveSSH(l net.Listener, conf *ssh.ServerConfig) {
+	for {
+		nConn, err := l.Accept()
+		if err != nil {
+			return // listener closed
+		}
+		go func() {
+			_, chans, reqs, err := ssh.NewServerConn(nConn, conf)
+			if err != nil {
+				return
+			}
+			go ssh.DiscardRequests(reqs)
+
+			for newChannel := range chans {
+				if newChannel.ChannelType() != "session" {
+					_ = newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+					continue
+				}
+				channel, requests, err := newChannel.Accept()
+				if err != nil {
+					return
+				}
+				go func(in <-chan *ssh.Request) {
+					for req := range in {
+						_ = req.Reply(req.Type == "subsystem" && string(req.Payload[4:]) == "sftp", nil)
+					}
+				}(requests)
+
+				server, err := psftp.NewServer(channel)
+				if err != nil {
+					return
+				}
+				go func() {
+					_ = server.Serve()
+					_ = server.Close()
+				}()
+			}
+		}()
+	}
+}
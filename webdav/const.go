@@ -0,0 +1,8 @@
+package webdav
+
+// packageName is used for debug and error messages
+const packageName = "webdav"
+
+// DefaultTrash is the name of the trash collection (sub folder of the base collection)
+// if Config.Trash is not set.
+const DefaultTrash = ".trash"
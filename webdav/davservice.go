@@ -0,0 +1,480 @@
+package webdav
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	impl "github.com/SchnorcherSepp/storage/defaultimpl"
+	interf "github.com/SchnorcherSepp/storage/interfaces"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// interface check: interf.Service
+var _ interf.Service = (*_DavService)(nil)
+
+// Config defines the connection to a WebDAV collection.
+type Config struct {
+	// URL of the collection with the active files,
+	// e.g. 'https://cloud.example.com/remote.php/dav/files/user/storage/'
+	URL string
+
+	Username string // basic auth (optional)
+	Password string // basic auth (optional)
+
+	// Trash is the name of the trash collection inside the URL collection (default: DefaultTrash).
+	Trash string
+
+	// Client is used for all requests (default: http.DefaultClient).
+	Client *http.Client
+}
+
+// _DavService the central interface to access a WebDAV collection.
+// Must be created with NewDavService().
+type _DavService struct {
+	conf        Config
+	base        *url.URL // parsed conf.URL (always with trailing slash)
+	readerCache interf.Cache
+	debugLvl    uint8
+	mux         *sync.RWMutex   // protect 'files'
+	saveMux     *sync.Mutex     // protect 'reserved'
+	reserved    map[string]bool // names of running uploads (see Save)
+	files       interf.Files
+	readerOpts  []impl.ReaderAtOption // for ReaderAt() and MultiReaderAt()
+}
+
+// NewDavService returns an interface to a WebDAV collection.
+// Only the files directly in the collection are processed; sub collections are ignored.
+// The file id is the file name.
+// readerCache=nil disable the cache for ReaderAt() and MultiReaderAt()
+// debugLvl (@see impl.DebugHigh and impl.DebugOff)
+// readerOpts are used for ReaderAt() and MultiReaderAt() (@see impl.ReaderAtOption)
+func NewDavService(conf Config, readerCache interf.Cache, debugLvl uint8, readerOpts ...impl.ReaderAtOption) (interf.Service, error) {
+	// defaults
+	if conf.Trash == "" {
+		conf.Trash = DefaultTrash
+	}
+	if conf.Client == nil {
+		conf.Client = http.DefaultClient
+	}
+
+	// parse url
+	base, err := url.Parse(conf.URL)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+		base.RawPath = ""
+	}
+
+	return &_DavService{
+		conf:        conf,
+		base:        base,
+		readerCache: readerCache,
+		debugLvl:    debugLvl,
+		mux:         new(sync.RWMutex),
+		saveMux:     new(sync.Mutex),
+		reserved:    make(map[string]bool),
+		files:       impl.NewFiles(nil), // empty list, set by Update()
+		readerOpts:  readerOpts,
+	}, nil
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+
+// Update is the implementation of Service.Update()
+//
+// Update reads the collection with PROPFIND (Depth: 1).
+// getetag is used as Md5 if it's a md5 hash, otherwise the Md5 is empty.
+// This method is thread-safe.
+func (s *_DavService) Update() error {
+	h := http.Header{}
+	h.Set("Depth", "1")
+	h.Set("Content-Type", "application/xml; charset=utf-8")
+
+	resp, err := s.do("PROPFIND", "", h, strings.NewReader(propfindBody))
+	if err != nil {
+		log.Printf("ERROR: %s/Update: PROPFIND failed: %v", packageName, err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	// parse
+	ms := new(_MultiStatus)
+	if err := xml.NewDecoder(resp.Body).Decode(ms); err != nil {
+		log.Printf("ERROR: %s/Update: invalid PROPFIND response: %v", packageName, err)
+		return err
+	}
+
+	// add all results (files) to list
+	byId := make(map[string]interf.File)
+	for _, r := range ms.Responses {
+		name, ok := s.name(r.Href)
+		if !ok || name == "" || strings.HasPrefix(name, ".") {
+			continue // the collection itself, sub collections, trash and other hidden files
+		}
+		for _, ps := range r.PropStats {
+			if !strings.Contains(ps.Status, " 200 ") || ps.Prop.ResourceType.Collection != nil {
+				continue
+			}
+			modTime := int64(0) // unknown (stable, @see impl.InvalidateChanged)
+			if t, err := http.ParseTime(ps.Prop.LastModified); err == nil {
+				modTime = t.Unix()
+			}
+			size, _ := strconv.ParseInt(strings.TrimSpace(ps.Prop.ContentLength), 10, 64)
+			byId[name] = impl.NewFile(name, name, modTime, size, etagMd5(ps.Prop.ETag))
+		}
+	}
+	log.Printf("INFO: %s/Update: successful file update (%d files)", packageName, len(byId))
+
+	// set new list
+	s.mux.Lock() // LOCK
+	old := s.files
+	s.files = impl.NewFiles(byId)
+	s.mux.Unlock() // UNLOCK
+
+	impl.InvalidateChanged(s.readerCache, old, s.Files(), s.readerOpts...) // remove stale sectors
+	return nil
+}
+
+// Files is the implementation of Service.Files()
+//
+// Files returns all available files.
+// This method is offline and does not trigger a connection to the server.
+// The internal file index must be updated separately with Update().
+// This method is thread-safe.
+func (s *_DavService) Files() interf.Files {
+	s.mux.RLock() // READ Lock
+	defer s.mux.RUnlock()
+
+	return s.files
+}
+
+// Save is the implementation of Service.Save()
+//
+// Save uploads the data with PUT (If-None-Match: *).
+// A collection can't contain the same name twice, so an existing name is extended with a counter (e.g. 'test (2).dat').
+// Don't forget to call Update().
+// This method is thread-safe.
+func (s *_DavService) Save(name string, r io.Reader, max int64) (file interf.File, err error) {
+	name = strings.TrimSpace(name)
+	if name == "" || r == nil || strings.Contains(name, "/") || strings.HasPrefix(name, ".") {
+		return nil, errors.New("invalid input")
+	}
+
+	// limit reader
+	if max > 0 {
+		r = io.LimitReader(r, max)
+	}
+
+	// find and reserve a free name
+	id, err := s.reserveName(name)
+	if err != nil {
+		return nil, err
+	}
+	defer s.releaseName(id)
+
+	// upload
+	hash := md5.New()
+	counter := &_Counter{}
+	h := http.Header{}
+	h.Set("Content-Type", "application/octet-stream")
+	h.Set("If-None-Match", "*") // never overwrite
+
+	resp, err := s.do("PUT", id, h, io.TeeReader(r, io.MultiWriter(hash, counter)))
+	if err != nil {
+		return nil, fmt.Errorf("upload error: %v", err)
+	}
+	_ = resp.Body.Close()
+
+	// success
+	return impl.NewFile(id, id, time.Now().Unix(), counter.n, hex.EncodeToString(hash.Sum(nil))), nil
+}
+
+// Trash is the implementation of Service.Trash()
+//
+// Trash moves the file into the trash collection (MKCOL & MOVE).
+// Don't forget to call Update().
+// This method is thread-safe.
+func (s *_DavService) Trash(file interf.File) error {
+	if file == nil || file.Id() == "" || strings.Contains(file.Id(), "/") {
+		return errors.New("invalid input")
+	}
+
+	// create trash collection (405: already exists)
+	resp, err := s.do("MKCOL", s.conf.Trash+"/", nil, nil)
+	if err != nil {
+		if e, ok := err.(*_Error); !ok || e.StatusCode != http.StatusMethodNotAllowed {
+			return err
+		}
+	} else {
+		_ = resp.Body.Close()
+	}
+
+	// move
+	h := http.Header{}
+	h.Set("Destination", s.url(s.conf.Trash+"/"+file.Id()+"."+strconv.FormatInt(time.Now().UnixNano(), 10)))
+	h.Set("Overwrite", "F")
+
+	resp, err = s.do("MOVE", file.Id(), h, nil)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+
+	// remove stale sectors
+	if s.readerCache != nil {
+		s.readerCache.InvalidateFile(impl.ScopedFileId(file.Id(), s.readerOpts...))
+	}
+	return nil
+}
+
+// Reader is the implementation of Service.Reader()
+//
+// Reader enables read access to a file identified by the file id (GET with range).
+// The connection must be closed manually with Close() after use.
+// This method is thread-safe.
+func (s *_DavService) Reader(file interf.File, off int64) (io.ReadCloser, error) {
+	return s.get(file, off, -1)
+}
+
+// LimitedReader is the implementation of Service.LimitedReader()
+//
+// LimitedReader enables read access to a file identified by the file id (GET with range),
+// but stops with EOF after n bytes.
+// The connection must be closed manually with Close() after use.
+// This method is thread-safe.
+func (s *_DavService) LimitedReader(file interf.File, off int64, n int64) (io.ReadCloser, error) {
+	if n < 1 {
+		// n = 0 -> no data requested -> return nothing
+		return ioutil.NopCloser(bytes.NewReader([]byte{})), nil
+	}
+	return s.get(file, off, n)
+}
+
+// ReaderAt is the implementation of Service.ReaderAt()
+func (s *_DavService) ReaderAt(file interf.File) (interf.ReaderAt, error) {
+	return impl.NewReaderAt(file, s, s.readerCache, s.debugLvl, s.readerOpts...)
+}
+
+// MultiReaderAt is the implementation of Service.MultiReaderAt()
+func (s *_DavService) MultiReaderAt(list []interf.File) (interf.ReaderAt, error) {
+	if len(list) == 1 {
+		// use the normal ReaderAt for single files
+		return s.ReaderAt(list[0])
+	} else {
+		// MultiReaderAt
+		return impl.NewMultiReaderAt(list, s, s.readerCache, s.debugLvl, s.readerOpts...)
+	}
+}
+
+// Cache returns the internal cache instance. Can be NIL.
+func (s *_DavService) Cache() interf.Cache {
+	return s.readerCache
+}
+
+//---------  Helper  -------------------------------------------------------------------------------------------------//
+
+// get opens a GET request with a range header (n=-1: until the end of the file).
+// A range behind the end of the file returns io.EOF.
+// If the server ignores the range header, the skipped data is read and discarded.
+func (s *_DavService) get(file interf.File, off, n int64) (io.ReadCloser, error) {
+	if file == nil || file.Id() == "" || strings.Contains(file.Id(), "/") {
+		return nil, errors.New("invalid input")
+	}
+
+	h := http.Header{}
+	if n > 0 {
+		h.Set("Range", fmt.Sprintf("bytes=%d-%d", off, off+n-1))
+	} else {
+		h.Set("Range", fmt.Sprintf("bytes=%d-", off))
+	}
+
+	resp, err := s.do("GET", file.Id(), h, nil)
+	if err != nil {
+		if e, ok := err.(*_Error); ok && e.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+			return nil, io.EOF
+		}
+		return nil, err
+	}
+
+	// the server ignores the range
+	if resp.StatusCode != http.StatusPartialContent {
+		if _, err := io.CopyN(ioutil.Discard, resp.Body, off); err != nil {
+			_ = resp.Body.Close()
+			if err == io.EOF {
+				return nil, io.EOF
+			}
+			return nil, err
+		}
+		if n > 0 {
+			return impl.NewLimitedReadCloser(resp.Body, n), nil
+		}
+	}
+	return resp.Body, nil
+}
+
+// reserveName returns the name or (if the name already exists) the name with a counter.
+// Example: 'test.dat' -> 'test (2).dat'
+// The name is reserved for the running upload until releaseName() is called.
+func (s *_DavService) reserveName(name string) (string, error) {
+	s.saveMux.Lock() // LOCK
+	defer s.saveMux.Unlock()
+
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+
+	newName := name
+	for i := 2; ; i++ {
+		if !s.reserved[newName] {
+			resp, err := s.do("HEAD", newName, nil, nil)
+			if err != nil {
+				if e, ok := err.(*_Error); ok && e.StatusCode == http.StatusNotFound {
+					s.reserved[newName] = true
+					return newName, nil
+				}
+				return "", err
+			}
+			_ = resp.Body.Close()
+		}
+		newName = fmt.Sprintf("%s (%d)%s", base, i, ext)
+	}
+}
+
+// releaseName removes the reservation of reserveName().
+func (s *_DavService) releaseName(name string) {
+	s.saveMux.Lock() // LOCK
+	delete(s.reserved, name)
+	s.saveMux.Unlock() // UNLOCK
+}
+
+// url returns the absolute url of a name in the collection.
+func (s *_DavService) url(name string) string {
+	u := *s.base
+	u.Path = s.base.Path + name
+	u.RawPath = ""
+	return u.String()
+}
+
+// name returns the file name of a href, if the href is a direct member of the collection.
+func (s *_DavService) name(href string) (string, bool) {
+	u, err := url.Parse(href)
+	if err != nil {
+		return "", false
+	}
+	if !strings.HasPrefix(u.Path, s.base.Path) {
+		return "", false
+	}
+	name := strings.TrimPrefix(u.Path, s.base.Path)
+	if strings.Contains(name, "/") {
+		return "", false // sub collection
+	}
+	return name, true
+}
+
+// do sends a request. name="" addresses the collection.
+// Responses with a status code >= 300 are returned as *_Error.
+func (s *_DavService) do(method, name string, h http.Header, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, s.url(name), body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range h {
+		req.Header[k] = v
+	}
+	if s.conf.Username != "" || s.conf.Password != "" {
+		req.SetBasicAuth(s.conf.Username, s.conf.Password)
+	}
+
+	resp, err := s.conf.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		_ = resp.Body.Close()
+		return nil, &_Error{Method: method, Name: name, StatusCode: resp.StatusCode}
+	}
+	return resp, nil
+}
+
+// etagMd5 returns the ETag if it's a md5 hash, otherwise "".
+func etagMd5(etag string) string {
+	etag = strings.Trim(strings.TrimPrefix(strings.TrimSpace(etag), "W/"), "\"")
+	if len(etag) != 32 {
+		return ""
+	}
+	if _, err := hex.DecodeString(etag); err != nil {
+		return ""
+	}
+	return strings.ToLower(etag)
+}
+
+// ------------------------------------------------------------------------------------------------------------------ //
+
+// _Error is a failed WebDAV request.
+type _Error struct {
+	Method     string
+	Name       string
+	StatusCode int
+}
+
+func (e *_Error) Error() string {
+	return fmt.Sprintf("%s/%s '%s': http %d %s", packageName, e.Method, e.Name, e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// Is makes errors.Is(err, os.ErrNotExist) work with missing files.
+func (e *_Error) Is(target error) bool {
+	return target == os.ErrNotExist && e.StatusCode == http.StatusNotFound
+}
+
+// _Counter counts the written bytes.
+type _Counter struct {
+	n int64
+}
+
+func (c *_Counter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
+
+//---------  XML  ----------------------------------------------------------------------------------------------------//
+
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:"><d:prop><d:resourcetype/><d:getetag/><d:getcontentlength/><d:getlastmodified/></d:prop></d:propfind>`
+
+type _MultiStatus struct {
+	XMLName   xml.Name    `xml:"DAV: multistatus"`
+	Responses []_Response `xml:"DAV: response"`
+}
+
+type _Response struct {
+	Href      string      `xml:"DAV: href"`
+	PropStats []_PropStat `xml:"DAV: propstat"`
+}
+
+type _PropStat struct {
+	Status string `xml:"DAV: status"`
+	Prop   _Prop  `xml:"DAV: prop"`
+}
+
+type _Prop struct {
+	ResourceType struct {
+		Collection *struct{} `xml:"DAV: collection"`
+	} `xml:"DAV: resourcetype"`
+	ETag          string `xml:"DAV: getetag"`
+	ContentLength string `xml:"DAV: getcontentlength"`
+	LastModified  string `xml:"DAV: getlastmodified"`
+}
@@ -0,0 +1,239 @@
+package webdav_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	impl "github.com/SchnorcherSepp/storage/defaultimpl"
+	interf "github.com/SchnorcherSepp/storage/interfaces"
+	"github.com/SchnorcherSepp/storage/webdav"
+	xwebdav "golang.org/x/net/webdav"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestNewDavService(t *testing.T) {
+	if _, err := webdav.NewDavService(webdav.Config{URL: "://invalid"}, nil, impl.DebugOff); err == nil {
+		t.Fatal("no error with invalid url")
+	}
+}
+
+func TestDavService_Save_Read_Trash(t *testing.T) {
+	fs, s := newTestService(t)
+
+	// invalid input
+	if _, err := s.Save("", bytes.NewReader(nil), 0); err == nil {
+		t.Fatal("no error with empty name")
+	}
+	if _, err := s.Save("a/b", bytes.NewReader(nil), 0); err == nil {
+		t.Fatal("no error with slash in name")
+	}
+
+	// save small file
+	f1, err := s.Save("test.dat", bytes.NewReader([]byte("Test Bytes Foo Bar")), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f1.Id() != "test.dat" || f1.Size() != 18 || f1.Md5() != "bda184187bab92431f5f86e489b659f8" {
+		t.Fatalf("wrong file: %s, %d, %s", f1.Id(), f1.Size(), f1.Md5())
+	}
+
+	// save with same name and limit
+	f2, err := s.Save("test.dat", bytes.NewReader([]byte("Test Bytes Foo Bar")), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f2.Id() != "test (2).dat" || f2.Size() != 4 {
+		t.Fatalf("wrong file: %s, %d", f2.Id(), f2.Size())
+	}
+
+	// sub collection is ignored
+	if err := fs.Mkdir(context.Background(), "/storage/sub", 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	// update
+	if err := s.Update(); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Files().All()) != 2 {
+		t.Fatalf("wrong file count: %d", len(s.Files().All()))
+	}
+	f, err := s.Files().ById("test (2).dat")
+	if err != nil || f.Size() != 4 || f.Name() != "test (2).dat" || f.ModTime() <= 0 {
+		t.Fatalf("wrong index: %v", err)
+	}
+
+	// LimitedReader with offset 1 and n=16
+	r, err := s.LimitedReader(f1, 1, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(r)
+	_ = r.Close()
+	if err != nil || string(b) != "est Bytes Foo Ba" {
+		t.Fatalf("read error: %s, %v", b, err)
+	}
+
+	// LimitedReader with n=0
+	r, err = s.LimitedReader(f1, 11, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ = ioutil.ReadAll(r)
+	_ = r.Close()
+	if len(b) != 0 {
+		t.Fatalf("read error: %s", b)
+	}
+
+	// Reader
+	r, err = s.Reader(f1, 11)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ = ioutil.ReadAll(r)
+	_ = r.Close()
+	if string(b) != "Foo Bar" {
+		t.Fatalf("read error: %s", b)
+	}
+
+	// Reader over EOF
+	if _, err := s.Reader(f2, 4); err != io.EOF {
+		t.Fatalf("wrong error: %v", err)
+	}
+
+	// Reader with unknown file
+	if _, err := s.Reader(impl.NewFile("unknown", "unknown", 0, 0, ""), 0); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("wrong error: %v", err)
+	}
+
+	// Trash
+	if err := s.Trash(f1); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Trash(f2); err != nil { // trash collection already exists
+		t.Fatal(err)
+	}
+	if err := s.Update(); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Files().All()) != 0 {
+		t.Fatalf("wrong file count: %d", len(s.Files().All()))
+	}
+	trash, err := fs.OpenFile(context.Background(), "/storage/"+webdav.DefaultTrash, os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, _ := trash.Readdir(-1)
+	if len(list) != 2 {
+		t.Fatalf("wrong trash count: %d", len(list))
+	}
+}
+
+func TestDavService_ReaderAt(t *testing.T) {
+	_, s := newTestService(t)
+
+	// 1 MB random data
+	data := make([]byte, 1024*1024+7)
+	rand.New(rand.NewSource(1337)).Read(data)
+	f1, err := s.Save("a.dat", bytes.NewReader(data), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f2, err := s.Save("b.dat", bytes.NewReader([]byte("b")), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// random access
+	rAt, err := s.ReaderAt(f1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rAt.Close()
+
+	buf := make([]byte, 100)
+	for _, off := range []int64{0, 500000, 1024 * 1024, 77777, 20} {
+		n, err := rAt.ReadAt(buf, off)
+		end := off + int64(n)
+		if err != nil && end != int64(len(data)) || !bytes.Equal(buf[:n], data[off:end]) {
+			t.Fatalf("ReadAt error: off=%d, n=%d, err=%v", off, n, err)
+		}
+	}
+
+	// multi
+	mAt, err := s.MultiReaderAt([]interf.File{f1, f2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mAt.Close()
+	if n, err := mAt.ReadAt(buf[:2], int64(len(data))-1); n != 2 || err != nil || buf[1] != 'b' {
+		t.Fatalf("ReadAt error: n=%d, err=%v", n, err)
+	}
+}
+
+//--------------------------------------------------------------------------------------------------------------------//
+
+func TestRace_DavService(t *testing.T) {
+	_, s := newTestService(t)
+
+	var wg sync.WaitGroup
+	wg.Add(5)
+	for n := 0; n < 5; n++ {
+		go func() {
+			//------------------------------
+			for i := 0; i < 10; i++ {
+				_, errS := s.Save("race.dat", bytes.NewReader([]byte("race")), 0)
+				errU := s.Update()
+				if errS != nil || errU != nil {
+					t.Fail()
+				}
+			}
+			//------------------------------
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+
+	// all files must exist
+	if err := s.Update(); err != nil || len(s.Files().All()) != 50 {
+		t.Fatalf("wrong file count: %d, %v", len(s.Files().All()), err)
+	}
+}
+
+//--------  HELPER  --------------------------------------------------------------------------------------------------//
+
+// newTestService starts a WebDAV server (memory file system) with basic auth.
+// The collection for the tests is '/storage/'.
+func newTestService(t *testing.T) (xwebdav.FileSystem, interf.Service) {
+	fs := xwebdav.NewMemFS()
+	if err := fs.Mkdir(context.Background(), "/storage", 0700); err != nil {
+		t.Fatal(err)
+	}
+	dav := &xwebdav.Handler{FileSystem: fs, LockSystem: xwebdav.NewMemLS()}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if u, p, ok := r.BasicAuth(); !ok || u != "user" || p != "pass" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		dav.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	s, err := webdav.NewDavService(webdav.Config{
+		URL:      srv.URL + "/storage",
+		Username: "user",
+		Password: "pass",
+	}, impl.NewCache(1), impl.DebugOff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fs, s
+}
@@ -0,0 +1,5 @@
+/*
+Package webdav provides the storage service implementation for WebDAV servers (Nextcloud, ownCloud, ...).
+
+*/
+package webdav